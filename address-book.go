@@ -0,0 +1,292 @@
+package gwcommon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CAddressBookFile - Stores the named external addresses, alongside cli.yaml
+	CAddressBookFile string = "address-book.json"
+)
+
+var (
+	// ErrAddressBookDuplicate - The address is already in the address book
+	ErrAddressBookDuplicate = errors.New("the address is already in the address book")
+	// ErrAddressBookNotFound - The address isn't in the address book
+	ErrAddressBookNotFound = errors.New("the address is not in the address book")
+)
+
+// AddressBookEntry - A named external address, e.g. an exchange deposit address
+type AddressBookEntry struct {
+	Name    string
+	Address string
+	Note    string `json:",omitempty"`
+	Created time.Time
+}
+
+// AddressBook - The user's named external addresses, kept in a local JSON file
+type AddressBook struct {
+	file    string
+	mu      sync.Mutex
+	entries []AddressBookEntry
+}
+
+// LoadAddressBook - Loads the address book from file, which doesn't need to exist yet
+func LoadAddressBook(file string) (*AddressBook, error) {
+	ab := &AddressBook{file: file}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ab, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &ab.entries); err != nil {
+		return nil, fmt.Errorf("unable to read address book %v: %v", file, err)
+	}
+	return ab, nil
+}
+
+// Entries - Returns the entries, sorted by name
+func (ab *AddressBook) Entries() []AddressBookEntry {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	entries := append([]AddressBookEntry(nil), ab.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries
+}
+
+// Find - Returns the entry for the address
+func (ab *AddressBook) Find(address string) (AddressBookEntry, bool) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if i := addressIndex(ab.entries, address); i >= 0 {
+		return ab.entries[i], true
+	}
+	return AddressBookEntry{}, false
+}
+
+// Add - Adds the entry and saves the address book. The address should be checked with ValidateAddress first.
+// If it can't be saved, the address book is left as it was
+func (ab *AddressBook) Add(e AddressBookEntry) error {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	entries, err := addEntry(ab.entries, e)
+	if err != nil {
+		return err
+	}
+	return ab.saveAs(entries)
+}
+
+// Update - Replaces the name and note of the entry with the same address, and saves the address book
+func (ab *AddressBook) Update(e AddressBookEntry) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	i := addressIndex(ab.entries, e.Address)
+	if i < 0 {
+		return ErrAddressBookNotFound
+	}
+	entries := append([]AddressBookEntry(nil), ab.entries...)
+	entries[i].Name = strings.TrimSpace(e.Name)
+	entries[i].Note = e.Note
+	return ab.saveAs(entries)
+}
+
+// Remove - Removes the entry for the address, and saves the address book
+func (ab *AddressBook) Remove(address string) error {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	i := addressIndex(ab.entries, address)
+	if i < 0 {
+		return ErrAddressBookNotFound
+	}
+	entries := append(append([]AddressBookEntry(nil), ab.entries[:i]...), ab.entries[i+1:]...)
+	return ab.saveAs(entries)
+}
+
+// ExportJSON - Writes the entries as a JSON array
+func (ab *AddressBook) ExportJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ab.Entries())
+}
+
+// ExportCSV - Writes the entries as CSV with a Name,Address,Note header
+func (ab *AddressBook) ExportCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Name", "Address", "Note"}); err != nil {
+		return err
+	}
+	for _, e := range ab.Entries() {
+		if err := cw.Write([]string{e.Name, e.Address, e.Note}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportJSON - Adds the entries in a JSON array written by ExportJSON, skipping addresses already in the address
+// book, and returns how many were added
+func (ab *AddressBook) ImportJSON(r io.Reader) (int, error) {
+	var entries []AddressBookEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return 0, fmt.Errorf("unable to read address book JSON: %v", err)
+	}
+	return ab.importEntries(entries)
+}
+
+// ImportCSV - Adds the entries in CSV with Name and Address columns, and optionally Note, skipping addresses
+// already in the address book, and returns how many were added. The columns can be in any order
+func (ab *AddressBook) ImportCSV(r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read address book CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	cols := map[string]int{"name": -1, "address": -1, "note": -1}
+	for i, h := range records[0] {
+		if _, ok := cols[strings.ToLower(strings.TrimSpace(h))]; ok {
+			cols[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+	}
+	if cols["name"] < 0 || cols["address"] < 0 {
+		return 0, errors.New("the CSV needs Name and Address columns")
+	}
+
+	field := func(rec []string, col string) string {
+		if i := cols[col]; i >= 0 && i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+	var entries []AddressBookEntry
+	for _, rec := range records[1:] {
+		entries = append(entries, AddressBookEntry{
+			Name:    field(rec, "name"),
+			Address: field(rec, "address"),
+			Note:    field(rec, "note"),
+		})
+	}
+	return ab.importEntries(entries)
+}
+
+func (ab *AddressBook) importEntries(entries []AddressBookEntry) (int, error) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	// Check everything first, so a bad file doesn't leave a partial import
+	for i, e := range entries {
+		if err := e.validate(); err != nil {
+			return 0, fmt.Errorf("entry %d: %v", i+1, err)
+		}
+	}
+
+	all := ab.entries
+	added := 0
+	for _, e := range entries {
+		next, err := addEntry(all, e)
+		if err == ErrAddressBookDuplicate {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		all = next
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	if err := ab.saveAs(all); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// addEntry - Returns a copy of entries with e added, leaving entries untouched
+func addEntry(entries []AddressBookEntry, e AddressBookEntry) ([]AddressBookEntry, error) {
+	if err := e.validate(); err != nil {
+		return nil, err
+	}
+	e.Name = strings.TrimSpace(e.Name)
+	e.Address = strings.TrimSpace(e.Address)
+	if addressIndex(entries, e.Address) >= 0 {
+		return nil, ErrAddressBookDuplicate
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	return append(append([]AddressBookEntry(nil), entries...), e), nil
+}
+
+func addressIndex(entries []AddressBookEntry, address string) int {
+	address = strings.TrimSpace(address)
+	for i, e := range entries {
+		if e.Address == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e AddressBookEntry) validate() error {
+	if strings.TrimSpace(e.Name) == "" {
+		return errors.New("a name is required")
+	}
+	address := strings.TrimSpace(e.Address)
+	if address == "" || strings.ContainsAny(address, " \t\r\n") {
+		return fmt.Errorf("invalid address %q", e.Address)
+	}
+	return nil
+}
+
+// saveAs - Writes entries to the file, and only once that's succeeded makes them the address book's entries.
+// Must be called with ab.mu held
+func (ab *AddressBook) saveAs(entries []AddressBookEntry) error {
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(ab.file), ".address-book-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ab.file); err != nil {
+		return err
+	}
+	ab.entries = entries
+	return nil
+}
@@ -0,0 +1,136 @@
+package gwcommon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func entryAddresses(entries []AddressBookEntry) []string {
+	var addrs []string
+	for _, e := range entries {
+		addrs = append(addrs, e.Address)
+	}
+	return addrs
+}
+
+func TestAddressBook(t *testing.T) {
+	file := filepath.Join(t.TempDir(), CAddressBookFile)
+	ab, err := LoadAddressBook(file)
+	if err != nil {
+		t.Fatalf("LoadAddressBook() error = %v", err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: " Exchange ", Address: " DExchange "}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: "bob", Address: "DBob", Note: "rent"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: "Again", Address: "DBob"}); err != ErrAddressBookDuplicate {
+		t.Errorf("Add() of the same address error = %v, want %v", err, ErrAddressBookDuplicate)
+	}
+	if err := ab.Update(AddressBookEntry{Name: "Bob", Address: "DBob"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Everything was saved
+	ab, err = LoadAddressBook(file)
+	if err != nil {
+		t.Fatalf("LoadAddressBook() error = %v", err)
+	}
+	entries := ab.Entries()
+	if got := entryAddresses(entries); !reflect.DeepEqual(got, []string{"DBob", "DExchange"}) {
+		t.Errorf("Entries() = %v, want sorted by name", got)
+	}
+	if e, ok := ab.Find("DExchange"); !ok || e.Name != "Exchange" || e.Created.IsZero() {
+		t.Errorf("Find() = %+v, %v", e, ok)
+	}
+	if e, _ := ab.Find("DBob"); e.Name != "Bob" || e.Note != "" {
+		t.Errorf("Find() after Update = %+v", e)
+	}
+
+	if err := ab.Remove("DBob"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := ab.Remove("DBob"); err != ErrAddressBookNotFound {
+		t.Errorf("Remove() again error = %v, want %v", err, ErrAddressBookNotFound)
+	}
+	if got := entryAddresses(ab.Entries()); !reflect.DeepEqual(got, []string{"DExchange"}) {
+		t.Errorf("Entries() after Remove = %v", got)
+	}
+}
+
+func TestAddressBookSaveFails(t *testing.T) {
+	file := filepath.Join(t.TempDir(), CAddressBookFile)
+	ab, err := LoadAddressBook(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: "Exchange", Address: "DExchange"}); err != nil {
+		t.Fatal(err)
+	}
+	// A folder where the file should be, so it can't be replaced
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(file, "in-the-way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := ab.Entries()
+
+	if err := ab.Add(AddressBookEntry{Name: "Bob", Address: "DBob"}); err == nil {
+		t.Fatal("Add() error = nil, want the save to fail")
+	}
+	if _, ok := ab.Find("DBob"); ok {
+		t.Error("Find() found the entry that couldn't be saved")
+	}
+	if err := ab.Update(AddressBookEntry{Name: "Renamed", Address: "DExchange"}); err == nil {
+		t.Fatal("Update() error = nil, want the save to fail")
+	}
+	if err := ab.Remove("DExchange"); err == nil {
+		t.Fatal("Remove() error = nil, want the save to fail")
+	}
+	if _, err := ab.ImportCSV(strings.NewReader("Name,Address\nBob,DBob\n")); err == nil {
+		t.Fatal("ImportCSV() error = nil, want the save to fail")
+	}
+	if got := ab.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %+v, want them unchanged %+v", got, want)
+	}
+
+	// Once it can be saved, the entry isn't a duplicate of one that never was
+	if err := os.RemoveAll(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: "Bob", Address: "DBob"}); err != nil {
+		t.Errorf("Add() error = %v", err)
+	}
+}
+
+func TestAddressBookImport(t *testing.T) {
+	ab, err := LoadAddressBook(filepath.Join(t.TempDir(), CAddressBookFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ab.Add(AddressBookEntry{Name: "Bob", Address: "DBob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Columns in any order, and addresses already there are skipped
+	n, err := ab.ImportCSV(strings.NewReader("Note,Address,Name\nrent,DBob,Bob again\n,DAlice,Alice\n"))
+	if err != nil || n != 1 {
+		t.Fatalf("ImportCSV() = %d, %v, want 1 added", n, err)
+	}
+	// A bad entry means nothing is imported
+	_, err = ab.ImportJSON(strings.NewReader(`[{"Name":"Carol","Address":"DCarol"},{"Name":"","Address":"DDave"}]`))
+	if err == nil {
+		t.Error("ImportJSON() with an entry without a name should fail")
+	}
+	if got := entryAddresses(ab.Entries()); !reflect.DeepEqual(got, []string{"DAlice", "DBob"}) {
+		t.Errorf("Entries() = %v", got)
+	}
+	if _, err := ab.ImportCSV(strings.NewReader("Address\nDCarol\n")); err == nil {
+		t.Error("ImportCSV() without a Name column should fail")
+	}
+}
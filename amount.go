@@ -0,0 +1,236 @@
+package gwcommon
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CSatsPerCoin - The number of base units in one coin
+	CSatsPerCoin int64 = 100000000
+
+	cCoinDecimals int = 8
+)
+
+// ErrAmountOverflow - The result of an Amount calculation doesn't fit in an int64
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// Amount - A coin amount in base units (sats), so amounts are exact rather than float64 approximations
+type Amount int64
+
+// AmountFormat - How Amount.Format lays out an amount
+type AmountFormat struct {
+	Decimals     int    // 0 to 8, the amount is rounded half away from zero to fit
+	TrimZeros    bool   // Drop trailing zero decimals, and the decimal separator if none are left
+	ThousandsSep string // e.g. "," or "", placed between groups of three whole digits
+	DecimalSep   string // Defaults to "."
+}
+
+var (
+	// cAmountRegex - What ParseAmount accepts, plain decimal notation with at most 8 decimals
+	cAmountRegex = regexp.MustCompile(`^-?\d+(\.\d{1,8})?$`)
+	// cJSONNumberRegex - A JSON number, which may have an exponent e.g. 1e-08 when the daemon writes it. The exponent is
+	// kept short, big.Rat would otherwise work out 10^n for any n it was sent
+	cJSONNumberRegex = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d{1,3})?$`)
+)
+
+// DefaultAmountFormat - All 8 decimals and no thousands separator, as the daemons show amounts
+var DefaultAmountFormat = AmountFormat{Decimals: cCoinDecimals}
+
+// ParseAmount - Converts a coin amount e.g. "-1.5" or "1.50000000" into an Amount without going through a float.
+// Only plain decimal notation is accepted, not hex, underscores or exponents, and anything finer than a sat is rejected
+// rather than rounded
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if !cAmountRegex.MatchString(s) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return parseAmountRat(s)
+}
+
+// parseAmountRat - Converts s, already checked to be a decimal number, into an Amount
+func parseAmountRat(s string) (Amount, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(CSatsPerCoin))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, cCoinDecimals)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("amount %q: %w", s, ErrAmountOverflow)
+	}
+	return Amount(r.Num().Int64()), nil
+}
+
+// UnmarshalJSON - Accepts a JSON number, as returned by the daemons, or a string. A number may use an exponent, a
+// string is parsed by ParseAmount
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	var v Amount
+	var err error
+	if uq, uerr := strconv.Unquote(s); uerr == nil {
+		v, err = ParseAmount(uq)
+	} else if cJSONNumberRegex.MatchString(s) {
+		v, err = parseAmountRat(s)
+	} else {
+		err = fmt.Errorf("invalid amount %s", s)
+	}
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// MarshalJSON - Writes the amount as a JSON number with 8 decimals, the same as the daemons
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// String - The amount with all 8 decimals e.g. -1.50000000
+func (a Amount) String() string {
+	return a.Format(DefaultAmountFormat)
+}
+
+// Format - Lays out the amount according to f
+func (a Amount) Format(f AmountFormat) string {
+	dec := f.Decimals
+	if dec < 0 {
+		dec = 0
+	}
+	if dec > cCoinDecimals {
+		dec = cCoinDecimals
+	}
+	decSep := f.DecimalSep
+	if decSep == "" {
+		decSep = "."
+	}
+
+	// Work with the magnitude as a uint64, so math.MinInt64 doesn't overflow
+	neg := a < 0
+	u := uint64(a)
+	if neg {
+		u = uint64(-a)
+	}
+	unit := uint64(1)
+	for i := dec; i < cCoinDecimals; i++ {
+		unit *= 10
+	}
+	u = (u + unit/2) / unit * unit
+
+	whole := strconv.FormatUint(u/uint64(CSatsPerCoin), 10)
+	if f.ThousandsSep != "" {
+		var sb strings.Builder
+		for i, c := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				sb.WriteString(f.ThousandsSep)
+			}
+			sb.WriteRune(c)
+		}
+		whole = sb.String()
+	}
+
+	s := whole
+	if dec > 0 {
+		frac := fmt.Sprintf("%0*d", dec, u%uint64(CSatsPerCoin)/unit)
+		if f.TrimZeros {
+			frac = strings.TrimRight(frac, "0")
+		}
+		if frac != "" {
+			s += decSep + frac
+		}
+	}
+	if neg && u != 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Add - Returns a + b
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+// Sub - Returns a - b
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if (b > 0 && a < math.MinInt64+b) || (b < 0 && a > math.MaxInt64+b) {
+		return 0, ErrAmountOverflow
+	}
+	return a - b, nil
+}
+
+// Mul - Returns a * n
+func (a Amount) Mul(n int64) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+	if (a == -1 && n == math.MinInt64) || (n == -1 && a == math.MinInt64) {
+		return 0, ErrAmountOverflow
+	}
+	c := a * Amount(n)
+	if c/Amount(n) != a {
+		return 0, ErrAmountOverflow
+	}
+	return c, nil
+}
+
+// Neg - Returns -a
+func (a Amount) Neg() (Amount, error) {
+	if a == math.MinInt64 {
+		return 0, ErrAmountOverflow
+	}
+	return -a, nil
+}
+
+// Abs - Returns the magnitude of a
+func (a Amount) Abs() (Amount, error) {
+	if a < 0 {
+		return a.Neg()
+	}
+	return a, nil
+}
+
+// SumAmounts - Returns the total of the amounts
+func SumAmounts(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// FiatValue - Returns the value of the amount at rate, the value of one coin e.g. from a PriceProvider
+func (a Amount) FiatValue(rate float64) float64 {
+	v, _ := a.fiatRat(rate).Float64()
+	return v
+}
+
+// FormatFiat - Returns the value of the amount at rate, rounded half away from zero to decimals places e.g. 2 for USD
+func (a Amount) FormatFiat(rate float64, decimals int) string {
+	return a.fiatRat(rate).FloatString(decimals)
+}
+
+func (a Amount) fiatRat(rate float64) *big.Rat {
+	r := new(big.Rat)
+	if math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return r
+	}
+	r.SetFloat64(rate)
+	return r.Mul(r, big.NewRat(int64(a), CSatsPerCoin))
+}
@@ -0,0 +1,116 @@
+package gwcommon
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: "1", want: 1e8},
+		{in: "-1.5", want: -15e7},
+		{in: " 0.00000001 ", want: 1},
+		{in: "1.50000000", want: 15e7},
+		{in: "007", want: 7e8},
+		{in: "92233720368.54775807", want: math.MaxInt64},
+		{in: "-92233720368.54775808", want: math.MinInt64},
+
+		// Finer than a sat
+		{in: "0.000000001", wantErr: true},
+		{in: "1.500000000", wantErr: true},
+
+		// Only plain decimal notation
+		{in: "0x10", wantErr: true},
+		{in: "0b11", wantErr: true},
+		{in: "0o7", wantErr: true},
+		{in: "1_000", wantErr: true},
+		{in: "1e3", wantErr: true},
+		{in: "1E-8", wantErr: true},
+		{in: "1/2", wantErr: true},
+		{in: "+1", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "1.", wantErr: true},
+		{in: "1,5", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmountOverflow(t *testing.T) {
+	for _, in := range []string{"92233720368.54775808", "-92233720368.54775809", "100000000000"} {
+		if _, err := ParseAmount(in); !errors.Is(err, ErrAmountOverflow) {
+			t.Errorf("ParseAmount(%q) error = %v, want %v", in, err, ErrAmountOverflow)
+		}
+	}
+}
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: `1.50000000`, want: 15e7},
+		{in: `"1.5"`, want: 15e7},
+		{in: `-0.1`, want: -1e7},
+		// Numbers may use an exponent, as a daemon may write small amounts
+		{in: `1e-08`, want: 1},
+		{in: `2.5E+2`, want: 250e8},
+		{in: `1e-9`, wantErr: true},
+		{in: `1e1000`, wantErr: true},
+		{in: `1e99999999`, wantErr: true},
+		// Strings are parsed strictly
+		{in: `"1e3"`, wantErr: true},
+		{in: `"0x10"`, wantErr: true},
+		{in: `0x10`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	// null leaves the amount alone
+	a := Amount(5)
+	if err := json.Unmarshal([]byte("null"), &a); err != nil || a != 5 {
+		t.Errorf("Unmarshal(null) = %d, %v", a, err)
+	}
+}
+
+func TestAmountJSONRoundTrip(t *testing.T) {
+	for _, a := range []Amount{0, 1, -15e7, math.MaxInt64, math.MinInt64} {
+		b, err := json.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Amount
+		if err := json.Unmarshal(b, &got); err != nil || got != a {
+			t.Errorf("round trip of %d via %s = %d, %v", a, b, got, err)
+		}
+	}
+}
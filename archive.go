@@ -0,0 +1,749 @@
+package gwcommon
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ulikunitz/xz"
+)
+
+// ArchiveFormat - The container, and for tar its compression, of an archive
+type ArchiveFormat int
+
+const (
+	AFUnknown ArchiveFormat = iota
+	AFZip
+	AFTar
+	AFTarGz
+	AFTarXz
+	AFTarBz2
+)
+
+const (
+	// cArchiveMaxBytes - The default limit on the total uncompressed size extracted, well above any coin release
+	cArchiveMaxBytes int64 = 2 << 30
+	// cArchiveSniffBytes - Enough to see the tar magic at offset 257
+	cArchiveSniffBytes int = 512
+	// cArchiveMaxLinkBytes - Zip stores symlink targets as the entry's content
+	cArchiveMaxLinkBytes int64 = 4096
+)
+
+var (
+	// ErrArchiveFormatUnknown - The file isn't a zip, tar, tar.gz, tar.xz or tar.bz2
+	ErrArchiveFormatUnknown = errors.New("unrecognised archive format")
+	// ErrArchiveTooLarge - Extracting would write more than the ExtractOptions.MaxBytes limit
+	ErrArchiveTooLarge = errors.New("the archive is larger than the extraction limit")
+	// ErrArchiveEntriesMissing - Some of the ExtractOptions.Only entries weren't in the archive
+	ErrArchiveEntriesMissing = errors.New("the archive does not contain all of the requested files")
+)
+
+// ExtractOptions - Controls how an archive is extracted
+type ExtractOptions struct {
+	// StripComponents - Removes this many leading directories from each entry, e.g. 1 to extract
+	// phore-1.6.5/bin/phored as bin/phored. Entries with no path left are skipped
+	StripComponents int
+	// SkipSymlinks - Ignores symlinks and hard links rather than creating them, e.g. on Windows
+	SkipSymlinks bool
+	// Only - If not empty, only entries with these paths, after StripComponents, or file names are extracted
+	// e.g. divid and divi-cli. Directories are only created as needed
+	Only []string
+	// MaxBytes - The most uncompressed data to write, defaults to cArchiveMaxBytes
+	MaxBytes int64
+}
+
+// Archive - A zip, tar, tar.gz, tar.xz or tar.bz2 file
+type Archive struct {
+	File   string
+	Format ArchiveFormat
+}
+
+// String - The format's usual name e.g. tar.gz
+func (f ArchiveFormat) String() string {
+	switch f {
+	case AFZip:
+		return "zip"
+	case AFTar:
+		return "tar"
+	case AFTarGz:
+		return "tar.gz"
+	case AFTarXz:
+		return "tar.xz"
+	case AFTarBz2:
+		return "tar.bz2"
+	}
+	return "unknown"
+}
+
+// Ext - The format's file extension e.g. .tar.gz
+func (f ArchiveFormat) Ext() string {
+	if f == AFUnknown {
+		return ""
+	}
+	return "." + f.String()
+}
+
+// ArchiveFormatFromName - Returns the format implied by the file's extension, for creating an archive
+func ArchiveFormatFromName(file string) ArchiveFormat {
+	name := strings.ToLower(file)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return AFZip
+	case strings.HasSuffix(name, ".tar"):
+		return AFTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return AFTarGz
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return AFTarXz
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return AFTarBz2
+	}
+	return AFUnknown
+}
+
+// DetectArchiveFormat - Returns the format of the archive from its magic bytes, rather than trusting its name
+func DetectArchiveFormat(b []byte) ArchiveFormat {
+	switch {
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+		return AFZip
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return AFTarGz
+	case bytes.HasPrefix(b, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return AFTarXz
+	case bytes.HasPrefix(b, []byte("BZh")):
+		return AFTarBz2
+	case len(b) >= 262 && string(b[257:262]) == "ustar":
+		return AFTar
+	}
+	return AFUnknown
+}
+
+// OpenArchive - Returns the archive in file, with its format detected from its content
+func OpenArchive(file string) (*Archive, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, cArchiveSniffBytes)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	format := DetectArchiveFormat(b[:n])
+	if format == AFUnknown {
+		return nil, fmt.Errorf("%v: %w", file, ErrArchiveFormatUnknown)
+	}
+	return &Archive{File: file, Format: format}, nil
+}
+
+// ExtractArchive - Extracts the archive in file into dest, whatever its format, and returns the paths written
+func ExtractArchive(file, dest string, opts ExtractOptions) ([]string, error) {
+	a, err := OpenArchive(file)
+	if err != nil {
+		return nil, err
+	}
+	return a.Extract(dest, opts)
+}
+
+// Extract - Extracts the archive into dest, which is created if needed, and returns the paths written.
+// Entries that would end up outside dest are rejected, and file permissions and modification times are kept
+func (a *Archive) Extract(dest string, opts ExtractOptions) ([]string, error) {
+	x, err := newArchiveExtractor(dest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Format == AFZip {
+		zr, err := zip.OpenReader(a.File)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if err := x.extractZip(&zr.Reader); err != nil {
+			return x.files, err
+		}
+		return x.files, x.finish()
+	}
+
+	f, err := os.Open(a.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := decompressTar(bufio.NewReader(f), a.Format)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if err := x.extractTar(tar.NewReader(r)); err != nil {
+		return x.files, err
+	}
+	return x.files, x.finish()
+}
+
+func decompressTar(r io.Reader, format ArchiveFormat) (io.ReadCloser, error) {
+	switch format {
+	case AFTar:
+		return ioutil.NopCloser(r), nil
+	case AFTarGz:
+		return gzip.NewReader(r)
+	case AFTarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case AFTarBz2:
+		return bzip2.NewReader(r, nil)
+	}
+	return nil, ErrArchiveFormatUnknown
+}
+
+// CreateArchive - Writes the files, and the contents of any directories among them, to a new archive in file.
+// Entries are named by their paths as given, without any leading /
+func CreateArchive(file string, format ArchiveFormat, files []string) (*Archive, error) {
+	if format == AFUnknown {
+		return nil, ErrArchiveFormatUnknown
+	}
+
+	// Write to a temp file first, so a failure doesn't leave half an archive behind
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".archive-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == AFZip {
+		err = createZip(tmp, files)
+	} else {
+		err = createTar(tmp, format, files)
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, err
+	}
+	return &Archive{File: file, Format: format}, nil
+}
+
+func createZip(w io.Writer, files []string) error {
+	zw := zip.NewWriter(w)
+	err := walkArchiveFiles(files, func(path, name string, fi os.FileInfo) error {
+		header, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if fi.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, link)
+			return err
+		case fi.Mode().IsRegular():
+			return copyFileTo(fw, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func createTar(w io.Writer, format ArchiveFormat, files []string) error {
+	var cw io.WriteCloser
+	var err error
+	switch format {
+	case AFTar:
+		cw = nopWriteCloser{w}
+	case AFTarGz:
+		cw = gzip.NewWriter(w)
+	case AFTarXz:
+		cw, err = xz.NewWriter(w)
+	case AFTarBz2:
+		cw, err = bzip2.NewWriter(w, nil)
+	default:
+		err = ErrArchiveFormatUnknown
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+	err = walkArchiveFiles(files, func(path, name string, fi os.FileInfo) error {
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			var err error
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if fi.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			return copyFileTo(tw, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// walkArchiveFiles - Calls fn for each of the files, and everything inside any directories, with the entry name
+func walkArchiveFiles(files []string, fn func(path, name string, fi os.FileInfo) error) error {
+	for _, file := range files {
+		err := filepath.Walk(file, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(strings.TrimPrefix(filepath.Clean(path), filepath.VolumeName(path)))
+			name = strings.TrimLeft(name, "/")
+			if name == "" || name == "." {
+				return nil
+			}
+			return fn(path, name, fi)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add %v to the archive: %v", file, err)
+		}
+	}
+	return nil
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type archiveEntryKind int
+
+const (
+	aekOther archiveEntryKind = iota
+	aekDir
+	aekFile
+	aekSymlink
+	aekHardlink
+)
+
+type archiveEntry struct {
+	name     string
+	linkname string
+	kind     archiveEntryKind
+	mode     os.FileMode
+	modTime  time.Time
+}
+
+type archiveDirTime struct {
+	path  string
+	mtime time.Time
+}
+
+// archiveExtractor - Writes entries from any of the archive formats into dest
+type archiveExtractor struct {
+	dest    string
+	opts    ExtractOptions
+	limit   int64
+	written int64
+	found   map[string]bool
+	files   []string
+	// Directory times are set last, as creating their contents changes them
+	dirTimes []archiveDirTime
+}
+
+func newArchiveExtractor(dest string, opts ExtractOptions) (*archiveExtractor, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	x := &archiveExtractor{dest: dest, opts: opts, limit: opts.MaxBytes, found: map[string]bool{}}
+	if x.limit <= 0 {
+		x.limit = cArchiveMaxBytes
+	}
+	return x, nil
+}
+
+func (x *archiveExtractor) extractTar(tr *tar.Reader) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read archive: %v", err)
+		}
+
+		e := archiveEntry{
+			name:     header.Name,
+			linkname: header.Linkname,
+			mode:     header.FileInfo().Mode().Perm(),
+			modTime:  header.ModTime,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			e.kind = aekDir
+		case tar.TypeReg, tar.TypeRegA:
+			e.kind = aekFile
+		case tar.TypeSymlink:
+			e.kind = aekSymlink
+		case tar.TypeLink:
+			e.kind = aekHardlink
+		}
+		if err := x.extract(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *archiveExtractor) extractZip(zr *zip.Reader) error {
+	for _, f := range zr.File {
+		e := archiveEntry{
+			name:    f.Name,
+			mode:    f.Mode().Perm(),
+			modTime: f.Modified,
+			kind:    aekFile,
+		}
+		if e.modTime.IsZero() {
+			e.modTime = f.ModTime()
+		}
+		switch {
+		case f.FileInfo().IsDir():
+			e.kind = aekDir
+		case f.Mode()&os.ModeSymlink != 0:
+			e.kind = aekSymlink
+		case !f.Mode().IsRegular():
+			e.kind = aekOther
+		}
+
+		if err := x.extractZipFile(f, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *archiveExtractor) extractZipFile(f *zip.File, e archiveEntry) error {
+	if e.kind != aekFile && e.kind != aekSymlink {
+		return x.extract(e, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if e.kind == aekSymlink {
+		b, err := ioutil.ReadAll(io.LimitReader(rc, cArchiveMaxLinkBytes))
+		if err != nil {
+			return err
+		}
+		e.linkname = string(b)
+	}
+	return x.extract(e, rc)
+}
+
+func (x *archiveExtractor) extract(e archiveEntry, r io.Reader) error {
+	rel, err := archiveEntryPath(e.name, x.opts.StripComponents)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return nil
+	}
+	if len(x.opts.Only) > 0 && (e.kind == aekDir || !x.wanted(rel)) {
+		return nil
+	}
+	target := filepath.Join(x.dest, rel)
+	if err := checkExtractParents(x.dest, rel); err != nil {
+		return err
+	}
+
+	switch e.kind {
+	case aekDir:
+		if err := os.MkdirAll(target, e.mode|0700); err != nil {
+			return err
+		}
+		x.dirTimes = append(x.dirTimes, archiveDirTime{target, e.modTime})
+
+	case aekFile:
+		if err := x.writeFile(target, e.mode, r); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, e.modTime, e.modTime); err != nil {
+			return err
+		}
+
+	case aekSymlink:
+		if x.opts.SkipSymlinks {
+			return nil
+		}
+		if err := checkSymlinkTarget(x.dest, filepath.Dir(target), e.linkname); err != nil {
+			return fmt.Errorf("%s: %v", e.name, err)
+		}
+		if err := prepareExtractTarget(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(e.linkname, target); err != nil {
+			return err
+		}
+
+	case aekHardlink:
+		if x.opts.SkipSymlinks {
+			return nil
+		}
+		linkRel, err := archiveEntryPath(e.linkname, x.opts.StripComponents)
+		if err != nil || linkRel == "" {
+			return fmt.Errorf("%s: hard link to %s points outside the destination", e.name, e.linkname)
+		}
+		// A symlink in the way would make the link to somewhere else, and a hard link to a symlink would
+		// resolve its target from the link's directory rather than the original's
+		if err := checkExtractParents(x.dest, linkRel); err != nil {
+			return fmt.Errorf("%s: %v", e.name, err)
+		}
+		source := filepath.Join(x.dest, linkRel)
+		if fi, err := os.Lstat(source); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: hard link to symlink %s is not allowed", e.name, e.linkname)
+		}
+		if err := prepareExtractTarget(target); err != nil {
+			return err
+		}
+		if err := os.Link(source, target); err != nil {
+			return err
+		}
+
+	default:
+		// Devices, fifos and the like have no place in a download, so are left out
+		return nil
+	}
+	x.files = append(x.files, target)
+	return nil
+}
+
+// wanted - Whether the entry is one of the Only entries, matching by path or file name
+func (x *archiveExtractor) wanted(rel string) bool {
+	slashed := filepath.ToSlash(rel)
+	base := filepath.Base(rel)
+	for _, o := range x.opts.Only {
+		if o == slashed || o == base {
+			x.found[o] = true
+			return true
+		}
+	}
+	return false
+}
+
+// writeFile - Writes the file, counting towards the size limit. The size in the header isn't trusted, so the limit
+// is applied to what is actually decompressed
+func (x *archiveExtractor) writeFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := prepareExtractTarget(target); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, x.limit-x.written+1))
+	x.written += n
+	if err == nil && x.written > x.limit {
+		err = ErrArchiveTooLarge
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(target)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The umask may have removed some of the bits
+	return os.Chmod(target, mode)
+}
+
+func (x *archiveExtractor) finish() error {
+	for i := len(x.dirTimes) - 1; i >= 0; i-- {
+		os.Chtimes(x.dirTimes[i].path, x.dirTimes[i].mtime, x.dirTimes[i].mtime)
+	}
+
+	var missing []string
+	for _, o := range x.opts.Only {
+		if !x.found[o] {
+			missing = append(missing, o)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %v", ErrArchiveEntriesMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// archiveEntryPath - Returns the cleaned relative path of an archive entry with strip leading directories removed,
+// or an error if it's absolute or climbs out of the archive. A blank path means the entry should be skipped
+func archiveEntryPath(name string, strip int) (string, error) {
+	name = strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%s: absolute paths are not allowed", name)
+	}
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch p {
+		case "", ".":
+		case "..":
+			return "", fmt.Errorf("%s: illegal file path", name)
+		default:
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) <= strip {
+		return "", nil
+	}
+	return filepath.Join(parts[strip:]...), nil
+}
+
+// checkExtractParents - Makes sure none of the directories above rel are symlinks, which an earlier entry could have
+// created to redirect later ones outside dest
+func checkExtractParents(dest, rel string) error {
+	dir := dest
+	parts := strings.Split(filepath.Dir(rel), string(os.PathSeparator))
+	for _, p := range parts {
+		if p == "." {
+			continue
+		}
+		dir = filepath.Join(dir, p)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: extracting through a symlink is not allowed", rel)
+		}
+	}
+	return nil
+}
+
+// checkSymlinkTarget - Makes sure a symlink in dir to linkname stays inside dest once the OS resolves it. The target
+// is walked the way the OS does, a part at a time against what's already on disk, as cleaning it first would hide
+// e.g. "l/.." where l is a link. It may not go through an existing symlink, and may not use ".." after a part that
+// doesn't exist yet, as a later entry could make that part a symlink. Links to links are allowed, as they were
+// checked in the same way when they were extracted
+func checkSymlinkTarget(dest, dir, linkname string) error {
+	linkname = strings.Replace(linkname, "\\", "/", -1)
+	if strings.HasPrefix(linkname, "/") || filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return fmt.Errorf("symlink to absolute path %s is not allowed", linkname)
+	}
+
+	parts := strings.Split(linkname, "/")
+	path := dir
+	exists := true
+	for i, p := range parts {
+		switch p {
+		case "", ".":
+			continue
+		case "..":
+			if !exists {
+				return fmt.Errorf("symlink to %s goes up from a directory that doesn't exist yet", linkname)
+			}
+			path = filepath.Dir(path)
+		default:
+			path = filepath.Join(path, p)
+		}
+		if !isWithinDir(dest, path) {
+			return fmt.Errorf("symlink to %s points outside the destination", linkname)
+		}
+		if !exists || p == ".." {
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			exists = false
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 && i < len(parts)-1 {
+			return fmt.Errorf("symlink to %s goes through the symlink %s", linkname, p)
+		}
+	}
+	return nil
+}
+
+// prepareExtractTarget - Creates the parent directories, and removes anything already at target that isn't a
+// directory, so an existing symlink can't be written through
+func prepareExtractTarget(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+		return os.Remove(target)
+	}
+	return nil
+}
+
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
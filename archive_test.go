@@ -0,0 +1,502 @@
+package gwcommon
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTarEntry - An entry for makeTestTarGz
+type testTarEntry struct {
+	name string
+	link string
+	body string
+	typ  byte
+	mode int64
+}
+
+func makeTestTarGz(t *testing.T, entries []testTarEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		h := &tar.Header{
+			Name:     e.name,
+			Linkname: e.link,
+			Typeflag: e.typ,
+			Mode:     mode,
+			Size:     int64(len(e.body)),
+			ModTime:  time.Unix(1500000000, 0),
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// newExtractDest - Returns an empty dest, with a secret file next to it that extraction must never reach
+func newExtractDest(t *testing.T) (dest, secret string) {
+	dir := t.TempDir()
+	secret = filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dest = filepath.Join(dir, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dest, secret
+}
+
+// assertNothingEscapes - Fails if anything in dest resolves to somewhere outside it
+func assertNothingEscapes(t *testing.T, dest string) {
+	t.Helper()
+	real, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filepath.Walk(dest, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dest {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			// Dangling, so it doesn't lead anywhere
+			return nil
+		}
+		if !isWithinDir(real, resolved) {
+			t.Errorf("%v resolves to %v, outside the destination", path, resolved)
+		}
+		// A hard link to a file outside dest can't be told apart by path, so check it's not the secret
+		if b, err := ioutil.ReadFile(path); err == nil && string(b) == "secret" {
+			t.Errorf("%v is the secret outside the destination", path)
+		}
+		return nil
+	})
+}
+
+func skipSymlinkTestOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+}
+
+func TestExtractTarGzLinkEscape(t *testing.T) {
+	skipSymlinkTestOnWindows(t)
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+	}{
+		{
+			// a/l is the destination itself, so a/l/.. is its parent, and x would be a hard link to the secret
+			name: "symlink through symlink then hard link",
+			entries: []testTarEntry{
+				{name: "a/l", link: "..", typ: tar.TypeSymlink},
+				{name: "m", link: "a/l/..", typ: tar.TypeSymlink},
+				{name: "x", link: "m/secret", typ: tar.TypeLink},
+			},
+		},
+		{
+			name: "hard link through symlink",
+			entries: []testTarEntry{
+				{name: "a/l", link: "..", typ: tar.TypeSymlink},
+				{name: "x", link: "a/l/a/l/secret", typ: tar.TypeLink},
+			},
+		},
+		{
+			// a/l is fine where it is, but a hard link to it in the top level would resolve ../secret from there
+			name: "hard link to symlink",
+			entries: []testTarEntry{
+				{name: "a/", typ: tar.TypeDir, mode: 0755},
+				{name: "a/l", link: "../secret", typ: tar.TypeSymlink},
+				{name: "x", link: "a/l", typ: tar.TypeLink},
+			},
+		},
+		{
+			// d doesn't exist yet, so d/x/../.. looks like the destination, until d is made a link to it
+			name: "up from a directory that doesn't exist yet",
+			entries: []testTarEntry{
+				{name: "s", link: "d/x/../..", typ: tar.TypeSymlink},
+				{name: "d", link: ".", typ: tar.TypeSymlink},
+				{name: "x/", typ: tar.TypeDir, mode: 0755},
+			},
+		},
+		{
+			name:    "symlink out of the destination",
+			entries: []testTarEntry{{name: "l", link: "../secret", typ: tar.TypeSymlink}},
+		},
+		{
+			name:    "symlink to an absolute path",
+			entries: []testTarEntry{{name: "l", link: "/etc/passwd", typ: tar.TypeSymlink}},
+		},
+		{
+			name: "file through symlink",
+			entries: []testTarEntry{
+				{name: "a/l", link: "..", typ: tar.TypeSymlink},
+				{name: "a/l/evil", body: "evil", typ: tar.TypeReg},
+			},
+		},
+		{
+			name:    "file out of the destination",
+			entries: []testTarEntry{{name: "../evil", body: "evil", typ: tar.TypeReg}},
+		},
+		{
+			name:    "file with an absolute path",
+			entries: []testTarEntry{{name: "/tmp/evil", body: "evil", typ: tar.TypeReg}},
+		},
+		{
+			name:    "hard link out of the destination",
+			entries: []testTarEntry{{name: "x", link: "../secret", typ: tar.TypeLink}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, _ := newExtractDest(t)
+			if _, err := ExtractTarGzTo(makeTestTarGz(t, tt.entries), dest, ExtractOptions{}); err == nil {
+				t.Error("ExtractTarGzTo() should have failed")
+			}
+			assertNothingEscapes(t, dest)
+		})
+	}
+}
+
+func TestExtractTarGzSafeLinks(t *testing.T) {
+	skipSymlinkTestOnWindows(t)
+	dest, _ := newExtractDest(t)
+	files, err := ExtractTarGzTo(makeTestTarGz(t, []testTarEntry{
+		{name: "coin-1.0/", typ: tar.TypeDir, mode: 0755},
+		{name: "coin-1.0/lib/libcoin.so.1.2", body: "lib", typ: tar.TypeReg, mode: 0755},
+		// A chain of links, as shared libraries have
+		{name: "coin-1.0/lib/libcoin.so.1", link: "libcoin.so.1.2", typ: tar.TypeSymlink},
+		{name: "coin-1.0/lib/libcoin.so", link: "libcoin.so.1", typ: tar.TypeSymlink},
+		{name: "coin-1.0/bin/libcoin.so", link: "../lib/libcoin.so", typ: tar.TypeSymlink},
+		{name: "coin-1.0/bin/coind", body: "daemon", typ: tar.TypeReg, mode: 0755},
+		{name: "coin-1.0/bin/coind-hard", link: "coin-1.0/bin/coind", typ: tar.TypeLink},
+		// Links to things later in the archive
+		{name: "coin-1.0/share/doc", link: "../doc", typ: tar.TypeSymlink},
+		{name: "coin-1.0/doc/README", body: "readme", typ: tar.TypeReg},
+	}), dest, ExtractOptions{StripComponents: 1})
+	if err != nil {
+		t.Fatalf("ExtractTarGzTo() error = %v", err)
+	}
+	if len(files) != 8 {
+		t.Errorf("ExtractTarGzTo() = %v, want 8 paths", files)
+	}
+
+	for path, want := range map[string]string{
+		"bin/libcoin.so":   "lib",
+		"bin/coind-hard":   "daemon",
+		"share/doc/README": "readme",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dest, path))
+		if err != nil || string(b) != want {
+			t.Errorf("%v = %q, %v, want %q", path, b, err, want)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dest, "bin", "coind"))
+	if err != nil || fi.Mode().Perm() != 0755 || fi.ModTime().Unix() != 1500000000 {
+		t.Errorf("bin/coind = %v, %v, want 0755 from the archive's time", fi, err)
+	}
+	assertNothingEscapes(t, dest)
+}
+
+// testArchives - The fixtures in testdata, made with the usual tools rather than CreateArchive. Each holds
+// release-1.0/ with bin/coind, bin/coin-cli, bin/coind-link -> coind and a 4096 byte README
+var testArchives = []struct {
+	file   string
+	format ArchiveFormat
+}{
+	{"release.zip", AFZip},
+	{"release.tar", AFTar},
+	{"release.tar.gz", AFTarGz},
+	{"release.tar.xz", AFTarXz},
+	{"release.tar.bz2", AFTarBz2},
+}
+
+// cTestArchiveBytes - The total size of the files in the testArchives
+const cTestArchiveBytes int64 = 4096 + 7 + 4
+
+func TestDetectArchiveFormat(t *testing.T) {
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := DetectArchiveFormat(b); got != tt.format {
+				t.Errorf("DetectArchiveFormat() = %v, want %v", got, tt.format)
+			}
+
+			// The name isn't trusted, e.g. a download saved without its extension
+			renamed := filepath.Join(t.TempDir(), "download.zip")
+			if err := ioutil.WriteFile(renamed, b, 0644); err != nil {
+				t.Fatal(err)
+			}
+			a, err := OpenArchive(renamed)
+			if err != nil {
+				t.Fatalf("OpenArchive() error = %v", err)
+			}
+			if a.Format != tt.format {
+				t.Errorf("OpenArchive() format = %v, want %v", a.Format, tt.format)
+			}
+			if got := ArchiveFormatFromName(tt.file); got != tt.format {
+				t.Errorf("ArchiveFormatFromName(%v) = %v, want %v", tt.file, got, tt.format)
+			}
+		})
+	}
+}
+
+func TestOpenArchiveUnknown(t *testing.T) {
+	for name, content := range map[string]string{
+		"text":  "not an archive",
+		"empty": "",
+		"short": "PK",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "release.tar.gz")
+			if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenArchive(file); !errors.Is(err, ErrArchiveFormatUnknown) {
+				t.Errorf("OpenArchive() error = %v, want %v", err, ErrArchiveFormatUnknown)
+			}
+		})
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			dest := t.TempDir()
+			opts := ExtractOptions{StripComponents: 1, SkipSymlinks: runtime.GOOS == "windows"}
+			files, err := ExtractArchive(filepath.Join("testdata", tt.file), dest, opts)
+			if err != nil {
+				t.Fatalf("ExtractArchive() error = %v", err)
+			}
+			// README, bin, coind, coin-cli and coind-link
+			wantPaths := 5
+			if opts.SkipSymlinks {
+				wantPaths = 4
+			}
+			if len(files) != wantPaths {
+				t.Errorf("ExtractArchive() = %v, want %d paths", files, wantPaths)
+			}
+
+			for path, want := range map[string]string{
+				"bin/coind":    "daemon\n",
+				"bin/coin-cli": "cli\n",
+			} {
+				b, err := ioutil.ReadFile(filepath.Join(dest, path))
+				if err != nil || string(b) != want {
+					t.Errorf("%v = %q, %v, want %q", path, b, err, want)
+				}
+			}
+			fi, err := os.Stat(filepath.Join(dest, "README"))
+			if err != nil || fi.Size() != 4096 {
+				t.Errorf("README = %v, %v, want 4096 bytes", fi, err)
+			}
+			if runtime.GOOS != "windows" {
+				if fi, err := os.Stat(filepath.Join(dest, "bin", "coind")); err != nil || fi.Mode().Perm() != 0755 {
+					t.Errorf("bin/coind = %v, %v, want 0755", fi, err)
+				}
+			}
+			if !opts.SkipSymlinks {
+				if link, err := os.Readlink(filepath.Join(dest, "bin", "coind-link")); err != nil || link != "coind" {
+					t.Errorf("bin/coind-link = %q, %v, want a link to coind", link, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArchiveOnly(t *testing.T) {
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			dest := t.TempDir()
+			// By file name, and by path after stripping
+			files, err := ExtractArchive(filepath.Join("testdata", tt.file), dest, ExtractOptions{
+				StripComponents: 1,
+				Only:            []string{"coind", "bin/coin-cli"},
+			})
+			if err != nil {
+				t.Fatalf("ExtractArchive() error = %v", err)
+			}
+			sort.Strings(files)
+			want := []string{filepath.Join(dest, "bin", "coin-cli"), filepath.Join(dest, "bin", "coind")}
+			if len(files) != 2 || files[0] != want[0] || files[1] != want[1] {
+				t.Errorf("ExtractArchive() = %v, want %v", files, want)
+			}
+			for _, path := range []string{"README", filepath.Join("bin", "coind-link")} {
+				if _, err := os.Lstat(filepath.Join(dest, path)); !os.IsNotExist(err) {
+					t.Errorf("%v was extracted, but wasn't asked for", path)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArchiveOnlyMissing(t *testing.T) {
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			dest := t.TempDir()
+			_, err := ExtractArchive(filepath.Join("testdata", tt.file), dest, ExtractOptions{
+				Only: []string{"coind", "coin-tx"},
+			})
+			if !errors.Is(err, ErrArchiveEntriesMissing) {
+				t.Errorf("ExtractArchive() error = %v, want %v", err, ErrArchiveEntriesMissing)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveMaxBytes(t *testing.T) {
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			tests := []struct {
+				maxBytes int64
+				wantErr  error
+			}{
+				{cTestArchiveBytes, nil},
+				{cTestArchiveBytes - 1, ErrArchiveTooLarge},
+				{100, ErrArchiveTooLarge},
+			}
+			for _, lt := range tests {
+				dest := t.TempDir()
+				_, err := ExtractArchive(filepath.Join("testdata", tt.file), dest, ExtractOptions{
+					SkipSymlinks: runtime.GOOS == "windows",
+					MaxBytes:     lt.maxBytes,
+				})
+				if err != lt.wantErr {
+					t.Errorf("ExtractArchive() with MaxBytes %d error = %v, want %v", lt.maxBytes, err, lt.wantErr)
+				}
+				// The file that went over the limit isn't left behind half written
+				if lt.wantErr != nil {
+					if fi, err := os.Stat(filepath.Join(dest, "release-1.0", "README")); err == nil && fi.Size() != 4096 {
+						t.Errorf("README was left behind with %d bytes", fi.Size())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZipLinkEscape(t *testing.T) {
+	skipSymlinkTestOnWindows(t)
+	tests := []struct {
+		name  string
+		links [][2]string
+	}{
+		{"symlink through symlink", [][2]string{{"a/l", ".."}, {"m", "a/l/.."}}},
+		{"symlink out of the destination", [][2]string{{"l", "../secret"}}},
+		{"symlink to an absolute path", [][2]string{{"l", "/etc/passwd"}}},
+		{"up from a directory that doesn't exist yet", [][2]string{{"s", "d/x/../.."}, {"d", "."}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, _ := newExtractDest(t)
+			file := filepath.Join(t.TempDir(), "evil.zip")
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			for _, l := range tt.links {
+				h := &zip.FileHeader{Name: l[0], Method: zip.Store}
+				h.SetMode(os.ModeSymlink | 0777)
+				w, err := zw.CreateHeader(h)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.Write([]byte(l[1]))
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := ExtractArchive(file, dest, ExtractOptions{}); err == nil {
+				t.Error("ExtractArchive() should have failed")
+			}
+			assertNothingEscapes(t, dest)
+		})
+	}
+}
+
+func TestCreateArchive(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "wallet", "backups"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"wallet/wallet.dat":           "wallet",
+		"wallet/backups/wallet.1.dat": "backup",
+		"wallet/divi.conf":            "rpcuser=u\n",
+	}
+	for path, body := range want {
+		if err := ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(path)), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range testArchives {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "backup"+tt.format.Ext())
+			if _, err := CreateArchive(file, tt.format, []string{filepath.Join(src, "wallet")}); err != nil {
+				t.Fatalf("CreateArchive() error = %v", err)
+			}
+			a, err := OpenArchive(file)
+			if err != nil {
+				t.Fatalf("OpenArchive() error = %v", err)
+			}
+			if a.Format != tt.format {
+				t.Errorf("OpenArchive() format = %v, want %v", a.Format, tt.format)
+			}
+
+			// The entries are named by the paths given, so strip those back off
+			dest := t.TempDir()
+			strip := strings.Count(strings.Trim(filepath.ToSlash(strings.TrimPrefix(src, filepath.VolumeName(src))), "/"), "/") + 1
+			if _, err := a.Extract(dest, ExtractOptions{StripComponents: strip}); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			for path, body := range want {
+				b, err := ioutil.ReadFile(filepath.Join(dest, filepath.FromSlash(path)))
+				if err != nil || string(b) != body {
+					t.Errorf("%v = %q, %v, want %q", path, b, err, body)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateArchiveUnknown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backup")
+	if _, err := CreateArchive(file, AFUnknown, nil); err != ErrArchiveFormatUnknown {
+		t.Errorf("CreateArchive() error = %v, want %v", err, ErrArchiveFormatUnknown)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("CreateArchive() left a file behind")
+	}
+}
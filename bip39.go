@@ -0,0 +1,230 @@
+package gwcommon
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	cBIP39MaxSuggestions  int = 3
+	cBIP39MaxDistance     int = 2
+	cBIP39UniquePrefixLen int = 4
+)
+
+//go:embed bip39-english.txt
+var bip39EnglishTxt string
+
+var bip39Words, bip39Index = func() ([]string, map[string]int) {
+	words := strings.Fields(bip39EnglishTxt)
+	index := make(map[string]int, len(words))
+	for i, w := range words {
+		index[w] = i
+	}
+	return words, index
+}()
+
+// MnemonicWordError - A word in the recovery phrase that isn't in the BIP39 word list, with likely corrections
+type MnemonicWordError struct {
+	Position    int // 1 based
+	Word        string
+	Suggestions []string
+}
+
+// MnemonicError - Describes everything wrong with a recovery phrase, so it can all be shown to the user at once
+type MnemonicError struct {
+	WordCount      int
+	BadWordCount   bool
+	UnknownWords   []MnemonicWordError
+	ChecksumFailed bool
+}
+
+func (e *MnemonicError) Error() string {
+	var reasons []string
+	if e.BadWordCount {
+		reasons = append(reasons, fmt.Sprintf("it has %d words, but should have 12, 15, 18, 21 or 24", e.WordCount))
+	}
+	for _, uw := range e.UnknownWords {
+		s := fmt.Sprintf("word #%d %q is not a valid recovery word", uw.Position, uw.Word)
+		if len(uw.Suggestions) > 0 {
+			s += ", did you mean " + strings.Join(uw.Suggestions, " or ") + "?"
+		}
+		reasons = append(reasons, s)
+	}
+	if e.ChecksumFailed {
+		reasons = append(reasons, "the checksum doesn't match, so at least one word is wrong or the words are in the wrong order")
+	}
+	return "invalid recovery phrase: " + strings.Join(reasons, "; ")
+}
+
+// NormaliseMnemonic - Lower cases the recovery phrase and collapses all whitespace to single spaces. Numbering
+// such as "1:" or "12." that may have been copied along with the words is removed
+func NormaliseMnemonic(mnemonic string) string {
+	var words []string
+	for _, f := range strings.Fields(strings.ToLower(mnemonic)) {
+		if isMnemonicNumbering(f) {
+			continue
+		}
+		words = append(words, f)
+	}
+	return strings.Join(words, " ")
+}
+
+func isMnemonicNumbering(s string) bool {
+	s = strings.TrimRight(s, ":.)")
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsBIP39Word - Returns true if word is in the BIP39 English word list
+func IsBIP39Word(word string) bool {
+	_, ok := bip39Index[word]
+	return ok
+}
+
+// ValidateMnemonic - Checks the normalised recovery phrase against the BIP39 English word list and its checksum,
+// returning a *MnemonicError describing any problems
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(NormaliseMnemonic(mnemonic))
+	merr := &MnemonicError{WordCount: len(words)}
+
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		merr.BadWordCount = true
+	}
+
+	for i, w := range words {
+		if !IsBIP39Word(w) {
+			merr.UnknownWords = append(merr.UnknownWords, MnemonicWordError{
+				Position:    i + 1,
+				Word:        w,
+				Suggestions: SuggestBIP39Words(w),
+			})
+		}
+	}
+
+	if !merr.BadWordCount && len(merr.UnknownWords) == 0 {
+		merr.ChecksumFailed = !mnemonicChecksumValid(words)
+	}
+
+	if merr.BadWordCount || len(merr.UnknownWords) > 0 || merr.ChecksumFailed {
+		return merr
+	}
+	return nil
+}
+
+// mnemonicChecksumValid - Rebuilds the entropy from the word indexes and compares the trailing checksum bits with
+// the leading bits of its SHA256
+func mnemonicChecksumValid(words []string) bool {
+	totalBits := len(words) * 11
+	csBits := totalBits / 33
+	entBits := totalBits - csBits
+
+	bits := make([]byte, 0, totalBits)
+	for _, w := range words {
+		idx := bip39Index[w]
+		for b := 10; b >= 0; b-- {
+			bits = append(bits, byte((idx>>uint(b))&1))
+		}
+	}
+
+	entropy := make([]byte, entBits/8)
+	for i := 0; i < entBits; i++ {
+		entropy[i/8] |= bits[i] << uint(7-i%8)
+	}
+
+	hash := sha256.Sum256(entropy)
+	for i := 0; i < csBits; i++ {
+		if (hash[i/8]>>uint(7-i%8))&1 != bits[entBits+i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SuggestBIP39Words - Returns up to 3 BIP39 words the misspelt word was most likely meant to be, closest first
+func SuggestBIP39Words(word string) []string {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if word == "" {
+		return nil
+	}
+
+	var prefix string
+	if len(word) >= cBIP39UniquePrefixLen {
+		prefix = word[:cBIP39UniquePrefixLen]
+	}
+
+	type candidate struct {
+		word      string
+		dist      int
+		prefixHit bool
+	}
+	var cands []candidate
+	for _, w := range bip39Words {
+		d := editDistance(word, w)
+		// A matching 4 letter prefix identifies a word uniquely, so it's worth suggesting even if the rest is far off
+		hit := prefix != "" && strings.HasPrefix(w, prefix)
+		if d <= cBIP39MaxDistance || hit {
+			cands = append(cands, candidate{w, d, hit})
+		}
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].dist != cands[j].dist {
+			return cands[i].dist < cands[j].dist
+		}
+		return cands[i].prefixHit && !cands[j].prefixHit
+	})
+
+	var sugs []string
+	for _, c := range cands {
+		if len(sugs) == cBIP39MaxSuggestions {
+			break
+		}
+		sugs = append(sugs, c.word)
+	}
+	return sugs
+}
+
+// editDistance - Returns the Levenshtein distance between a and b, also counting a swap of two adjacent letters
+// as a single edit, as that's the most common typo
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+package gwcommon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bip39Vectors - Entropy and mnemonics from the reference test vectors, trezor/python-mnemonic vectors.json
+var bip39Vectors = []struct {
+	entropy  string
+	mnemonic string
+}{
+	{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+	{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+	{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+	{"000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal will"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo when"},
+	{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+	{"8080808080808080808080808080808080808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic bless"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"},
+	{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+	{"6610b25967cdcca9d59875f5cb50b0ea75433311869e930b", "gravity machine north sort system female filter attitude volume fold club stay feature office ecology stable narrow fog"},
+	{"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c", "hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length"},
+	{"c0ba5a8e914111210f2bd131f3d5e08d", "scheme spot photo card baby mountain device kick cradle pact join borrow"},
+	{"f585c11aec520db57dd353c69554b21a89b20fb0650966fa0a9d6f74fd989d8f", "void come effort suffer camp survey warrior heavy shoot primary clutch crush open amazing screen patrol group space point ten exist slush involve unfold"},
+}
+
+// testMnemonic - Encodes the entropy as BIP39 words, to check the word list is the right one in the right order
+func testMnemonic(t *testing.T, entropyHex string) string {
+	entropy, err := hex.DecodeString(entropyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(entropy)
+	bit := func(i int) int {
+		if i < len(entropy)*8 {
+			return int(entropy[i/8]>>uint(7-i%8)) & 1
+		}
+		i -= len(entropy) * 8
+		return int(hash[i/8]>>uint(7-i%8)) & 1
+	}
+	var words []string
+	for w := 0; w < (len(entropy)*8+len(entropy)/4)/11; w++ {
+		idx := 0
+		for b := 0; b < 11; b++ {
+			idx = idx<<1 | bit(w*11+b)
+		}
+		words = append(words, bip39Words[idx])
+	}
+	return strings.Join(words, " ")
+}
+
+func TestBIP39Vectors(t *testing.T) {
+	if len(bip39Words) != 2048 || len(bip39Index) != 2048 {
+		t.Fatalf("the word list has %d words, %d unique, want 2048", len(bip39Words), len(bip39Index))
+	}
+	for _, tt := range bip39Vectors {
+		if got := testMnemonic(t, tt.entropy); got != tt.mnemonic {
+			t.Errorf("entropy %v encodes as %q, want %q", tt.entropy, got, tt.mnemonic)
+		}
+		if err := ValidateMnemonic(tt.mnemonic); err != nil {
+			t.Errorf("ValidateMnemonic(%q) error = %v", tt.mnemonic, err)
+		}
+	}
+}
+
+func TestValidateMnemonicChecksum(t *testing.T) {
+	tests := []string{
+		// The last word changed
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon above",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo",
+		// Two words swapped
+		"legal winner thank year wave sausage worth useful legal winner yellow thank",
+		"drill ozone grab fiber curtain grace pudding thank cruise elder eight picnic",
+		// A word from a 24 word phrase missing
+		"hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug delay length",
+	}
+	for _, m := range tests {
+		err := ValidateMnemonic(m)
+		var merr *MnemonicError
+		if !errors.As(err, &merr) {
+			t.Errorf("ValidateMnemonic(%q) error = %v, want a *MnemonicError", m, err)
+			continue
+		}
+		want := len(strings.Fields(m))%3 == 0
+		if merr.ChecksumFailed != want || merr.BadWordCount == want || len(merr.UnknownWords) != 0 {
+			t.Errorf("ValidateMnemonic(%q) = %+v", m, merr)
+		}
+	}
+}
+
+func TestValidateMnemonicWords(t *testing.T) {
+	err := ValidateMnemonic("abandon abandon abandn abandon abandon abandon abandon abandon abandon abandon abuot xyzzy")
+	var merr *MnemonicError
+	if !errors.As(err, &merr) {
+		t.Fatalf("ValidateMnemonic() error = %v, want a *MnemonicError", err)
+	}
+	if merr.BadWordCount || merr.ChecksumFailed {
+		t.Errorf("BadWordCount = %v, ChecksumFailed = %v, the checksum can't be checked with unknown words", merr.BadWordCount, merr.ChecksumFailed)
+	}
+	var positions []int
+	for _, uw := range merr.UnknownWords {
+		positions = append(positions, uw.Position)
+	}
+	if !reflect.DeepEqual(positions, []int{3, 11, 12}) {
+		t.Fatalf("UnknownWords at %v, want 3, 11 and 12", positions)
+	}
+	if s := merr.UnknownWords[0].Suggestions; len(s) == 0 || s[0] != "abandon" {
+		t.Errorf("suggestions for abandn = %v", s)
+	}
+	if s := merr.UnknownWords[1].Suggestions; len(s) == 0 || s[0] != "about" {
+		t.Errorf("suggestions for abuot = %v, want the swapped letters fixed first", s)
+	}
+	if !strings.Contains(err.Error(), `word #3 "abandn"`) {
+		t.Errorf("Error() = %v", err)
+	}
+}
+
+func TestNormaliseMnemonic(t *testing.T) {
+	in := "1. Legal  2. WINNER\n3: thank\t4) year 12 useful"
+	if got, want := NormaliseMnemonic(in), "legal winner thank year useful"; got != want {
+		t.Errorf("NormaliseMnemonic() = %q, want %q", got, want)
+	}
+	// Copied with numbering, the phrase is still valid
+	var numbered []string
+	for i, w := range strings.Fields(bip39Vectors[1].mnemonic) {
+		numbered = append(numbered, fmt.Sprintf("%d.", i+1), strings.ToUpper(w))
+	}
+	if err := ValidateMnemonic(strings.Join(numbered, " ")); err != nil {
+		t.Errorf("ValidateMnemonic() of a numbered phrase error = %v", err)
+	}
+}
@@ -23,6 +23,7 @@ type CLIConfStruct struct {
 	RPCuser                   string      // The rpcuser
 	RPCpassword               string      // The rpc password
 	ServerIP                  string      // The IP address of the coin daemon server
+	ServerCertFingerprint     string      // The SHA256 fingerprint of the server's TLS certificate, pinned on first pairing
 	Token                     string      // Stored after generation and is checked to be equal with the clients
 	UserConfirmedSeedRecovery bool        // Whether or not the user has said they've stored their recovery seed has been stored
 }
@@ -63,6 +64,7 @@ func SetCLIConfStruct(cs CLIConfStruct) error {
 	viper.Set("rpcuser", cs.RPCuser)
 	viper.Set("rpcpassword", cs.RPCpassword)
 	viper.Set("ServerIP", cs.ServerIP)
+	viper.Set("ServerCertFingerprint", cs.ServerCertFingerprint)
 	viper.Set("Port", cs.Port)
 	viper.Set("Token", cs.Token)
 	viper.Set("UserConfirmedSeedRecovery", cs.UserConfirmedSeedRecovery)
@@ -0,0 +1,341 @@
+package gwcommon
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CInstallReceiptFile - Written to the bin folder once the coin binaries are installed
+	CInstallReceiptFile string = "coin-install.json"
+
+	cInstallMaxSumsBytes int64 = 1 << 20
+)
+
+var (
+	// ErrCoinReleaseNotRegistered - There's no upstream release registered for the coin on the platform
+	ErrCoinReleaseNotRegistered = errors.New("no release is available for this coin and platform")
+	// ErrInstallUnverified - The download couldn't be checked against a known SHA256
+	ErrInstallUnverified = errors.New("unable to verify the download, no SHA256 is available")
+	// ErrInstallChecksumMismatch - The download doesn't match its published SHA256
+	ErrInstallChecksumMismatch = errors.New("the download does not match its published SHA256")
+)
+
+// CoinRelease - Where to download a coin's upstream release for a platform, and how to check it.
+// Only SHA256 says the archive is the one intended. A SumsURL is fetched from the same place as the archive and its
+// signature isn't checked, so it only catches a corrupt download, not a tampered one
+type CoinRelease struct {
+	Version string
+	URL     string // The release archive
+	SHA256  string // Hex, if known in advance
+	SumsURL string // A SHA256SUMS style file listing the archive, used when SHA256 is blank. No authenticity, see above
+}
+
+// InstallReceiptStruct - What InstallCoinBinaries installed, saved as CInstallReceiptFile
+type InstallReceiptStruct struct {
+	Coin      string // The ticker e.g. PHR
+	Version   string
+	Platform  OSType
+	Archive   string // The archive's file name
+	SHA256    string
+	Files     []string // The installed file names, in the bin folder
+	Installed time.Time
+}
+
+type coinReleaseKey struct {
+	pt  ProjectType
+	ost OSType
+}
+
+var (
+	coinReleasesMu sync.RWMutex
+	coinReleases   = map[coinReleaseKey]CoinRelease{
+		{PTPhore, OSTArm}:     phoreRelease(CDFPhoreFileRPi),
+		{PTPhore, OSTLinux}:   phoreRelease(CDFPhoreFileLinux),
+		{PTPhore, OSTWindows}: phoreRelease(CDFPhoreFileWindows),
+	}
+)
+
+func phoreRelease(file string) CoinRelease {
+	return CoinRelease{
+		Version: CPhoreAppVersion,
+		URL:     CDownloadURLPhore + file,
+		SumsURL: CDownloadURLPhore + CDFPhoreSumsFile,
+	}
+}
+
+// RegisterCoinRelease - Sets the upstream release installed by InstallCoinBinaries for the coin on the platform
+func RegisterCoinRelease(pt ProjectType, ost OSType, rel CoinRelease) {
+	coinReleasesMu.Lock()
+	defer coinReleasesMu.Unlock()
+	coinReleases[coinReleaseKey{pt, ost}] = rel
+}
+
+// GetCoinRelease - Returns the upstream release registered for the coin on the platform
+func GetCoinRelease(pt ProjectType, ost OSType) (CoinRelease, error) {
+	coinReleasesMu.RLock()
+	defer coinReleasesMu.RUnlock()
+	rel, ok := coinReleases[coinReleaseKey{pt, ost}]
+	if !ok {
+		return CoinRelease{}, ErrCoinReleaseNotRegistered
+	}
+	return rel, nil
+}
+
+// GetCoinBinaryFiles - Returns the file names of the coin's daemon, cli and tx binaries on the platform
+func GetCoinBinaryFiles(pt ProjectType, ost OSType) ([]string, error) {
+	win := ost == OSTWindows
+	pick := func(file, fileWin string) string {
+		if win {
+			return fileWin
+		}
+		return file
+	}
+	switch pt {
+	case PTDivi:
+		return []string{pick(CDiviDFile, CDiviDFileWin), pick(CDiviCliFile, CDiviCliFileWin), pick(CDiviTxFile, CDiviTxFileWin)}, nil
+	case PTPhore:
+		return []string{pick(CPhoreDFile, CPhoreDFileWin), pick(CPhoreCliFile, CPhoreCliFileWin), pick(CPhoreTxFile, CPhoreTxFileWin)}, nil
+	case PTPIVX:
+		return []string{pick(CPIVXDFile, CPIVXDFileWin), pick(CPIVXCliFile, CPIVXCliFileWin), pick(CPIVXTxFile, CPIVXTxFileWin)}, nil
+	case PTTrezarcoin:
+		return []string{pick(CTrezarcoinDFile, CTrezarcoinDFileWin), pick(CTrezarcoinCliFile, CTrezarcoinCliFileWin), pick(CTrezarcoinTxFile, CTrezarcoinTxFileWin)}, nil
+	default:
+		return nil, errors.New("unable to determine ProjectType")
+	}
+}
+
+// ReadInstallReceipt - Returns the receipt left in binFolder by InstallCoinBinaries
+func ReadInstallReceipt(binFolder string) (InstallReceiptStruct, error) {
+	var receipt InstallReceiptStruct
+	b, err := ioutil.ReadFile(filepath.Join(binFolder, CInstallReceiptFile))
+	if err != nil {
+		return receipt, err
+	}
+	if err := json.Unmarshal(b, &receipt); err != nil {
+		return receipt, fmt.Errorf("unable to read %v: %v", CInstallReceiptFile, err)
+	}
+	return receipt, nil
+}
+
+// InstallCoinBinaries - Downloads the coin's upstream release for the platform, checks its SHA256, and installs just
+// the daemon, cli and tx binaries into binFolder. If the same version is already installed, nothing is downloaded and
+// the existing receipt is returned. A download that fails its check leaves nothing behind.
+//
+// The download is only as trustworthy as the release's SHA256. When that's blank the hash comes from the SumsURL,
+// on the same server as the archive, and the PGP signature on it is NOT checked, so anyone able to change the archive
+// can change the hash too. Register releases with a SHA256 where the binaries need to be authentic
+func InstallCoinBinaries(ctx context.Context, pt ProjectType, ost OSType, binFolder string) (receipt InstallReceiptStruct, err error) {
+	rel, err := GetCoinRelease(pt, ost)
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	files, err := GetCoinBinaryFiles(pt, ost)
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	ticker, err := GetCoinTicker(pt)
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+
+	if r, err := ReadInstallReceipt(binFolder); err == nil && r.isInstalled(binFolder, ticker, rel) {
+		return r, nil
+	}
+
+	if _, err := os.Stat(binFolder); os.IsNotExist(err) {
+		// Don't leave an empty bin folder behind if the install fails
+		defer func() {
+			if err != nil {
+				os.Remove(binFolder)
+			}
+		}()
+	}
+	if err := os.MkdirAll(binFolder, 0755); err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	work, err := ioutil.TempDir(binFolder, ".install-")
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	defer os.RemoveAll(work)
+
+	archive := path.Base(rel.URL)
+	archiveFile := filepath.Join(work, archive)
+	sum, err := downloadWithSHA256(ctx, rel.URL, archiveFile)
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	if err := verifyReleaseSHA256(ctx, rel, archive, sum); err != nil {
+		return InstallReceiptStruct{}, err
+	}
+
+	extracted, err := ExtractArchive(archiveFile, filepath.Join(work, "x"), ExtractOptions{Only: files, SkipSymlinks: true})
+	if err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	// The binaries are usually under e.g. phore-1.6.5/bin, but are installed straight into binFolder
+	for _, src := range extracted {
+		dst := filepath.Join(binFolder, filepath.Base(src))
+		if err := os.Chmod(src, 0755); err != nil {
+			return InstallReceiptStruct{}, err
+		}
+		if runtime.GOOS == "windows" {
+			os.Remove(dst)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return InstallReceiptStruct{}, err
+		}
+	}
+
+	receipt = InstallReceiptStruct{
+		Coin:      ticker,
+		Version:   rel.Version,
+		Platform:  ost,
+		Archive:   archive,
+		SHA256:    sum,
+		Files:     files,
+		Installed: time.Now(),
+	}
+	if err := writeInstallReceipt(binFolder, receipt); err != nil {
+		return InstallReceiptStruct{}, err
+	}
+	return receipt, nil
+}
+
+// isInstalled - Whether the receipt is for the release, and its files are all still there
+func (r InstallReceiptStruct) isInstalled(binFolder, ticker string, rel CoinRelease) bool {
+	if r.Coin != ticker || r.Version != rel.Version || r.Archive != path.Base(rel.URL) {
+		return false
+	}
+	if rel.SHA256 != "" && !strings.EqualFold(r.SHA256, rel.SHA256) {
+		return false
+	}
+	for _, f := range r.Files {
+		if _, err := os.Stat(filepath.Join(binFolder, f)); err != nil {
+			return false
+		}
+	}
+	return len(r.Files) > 0
+}
+
+// downloadWithSHA256 - Downloads url to file, returning the hex SHA256 of what was downloaded
+func downloadWithSHA256(ctx context.Context, url, file string) (string, error) {
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("unable to download %v: %v", url, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyReleaseSHA256 - Checks sum against the release's SHA256, or failing that, the archive's line in its sums file
+func verifyReleaseSHA256(ctx context.Context, rel CoinRelease, archive, sum string) error {
+	want := rel.SHA256
+	if want == "" && rel.SumsURL != "" {
+		var err error
+		if want, err = fetchReleaseSHA256(ctx, rel.SumsURL, archive); err != nil {
+			return err
+		}
+	}
+	if want == "" {
+		return ErrInstallUnverified
+	}
+	if !strings.EqualFold(want, sum) {
+		return fmt.Errorf("%v: %w", archive, ErrInstallChecksumMismatch)
+	}
+	return nil
+}
+
+// fetchReleaseSHA256 - Returns the archive's hash from a file of "<sha256>  <file>" lines, which may be inside a
+// PGP signed message
+func fetchReleaseSHA256(ctx context.Context, sumsURL, archive string) (string, error) {
+	resp, err := httpGet(ctx, sumsURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	s := bufio.NewScanner(io.LimitReader(resp.Body, cInstallMaxSumsBytes))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if path.Base(strings.TrimPrefix(fields[1], "*")) == archive {
+			return fields[0], nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrInstallUnverified
+}
+
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to download %v: %v", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func writeInstallReceipt(binFolder string, receipt InstallReceiptStruct) error {
+	b, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(binFolder, ".coin-install-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(binFolder, CInstallReceiptFile))
+}
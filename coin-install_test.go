@@ -0,0 +1,225 @@
+package gwcommon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const cTestReleaseArchive = "divi-1.0.0-x86_64-linux-gnu.tar.gz"
+
+// releaseServer - Serves a release archive and its SHA256SUMS, and counts the downloads
+type releaseServer struct {
+	*httptest.Server
+	sum string // The archive's real SHA256
+
+	mu   sync.Mutex
+	gets int
+}
+
+func newReleaseServer(t *testing.T, sums string) *releaseServer {
+	archive := makeTestTarGz(t, []testTarEntry{
+		{name: "divi-1.0.0/bin/divid", body: "divid binary", mode: 0755},
+		{name: "divi-1.0.0/bin/divi-cli", body: "divi-cli binary", mode: 0755},
+		{name: "divi-1.0.0/bin/divi-tx", body: "divi-tx binary", mode: 0755},
+		{name: "divi-1.0.0/bin/divi-qt", body: "not installed", mode: 0755},
+		{name: "divi-1.0.0/README", body: "readme"},
+	}).Bytes()
+	h := sha256.Sum256(archive)
+	s := &releaseServer{sum: hex.EncodeToString(h[:])}
+	if sums == "" {
+		sums = "-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\n" +
+			strings.Repeat("0", 64) + "  divi-1.0.0-win64.zip\n" + s.sum + "  " + cTestReleaseArchive + "\n"
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.gets++
+		s.mu.Unlock()
+		switch r.URL.Path {
+		case "/" + cTestReleaseArchive:
+			w.Write(archive)
+		case "/SHA256SUMS.asc":
+			fmt.Fprint(w, sums)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *releaseServer) downloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+func (s *releaseServer) release(sha string, sums bool) CoinRelease {
+	rel := CoinRelease{Version: "1.0.0", URL: s.URL + "/" + cTestReleaseArchive, SHA256: sha}
+	if sums {
+		rel.SumsURL = s.URL + "/SHA256SUMS.asc"
+	}
+	return rel
+}
+
+// registerTestRelease - Registers rel as Divi's Linux release for the test, and puts back whatever was there after
+func registerTestRelease(t *testing.T, rel CoinRelease) {
+	prev, err := GetCoinRelease(PTDivi, OSTLinux)
+	t.Cleanup(func() {
+		if err == nil {
+			RegisterCoinRelease(PTDivi, OSTLinux, prev)
+			return
+		}
+		coinReleasesMu.Lock()
+		delete(coinReleases, coinReleaseKey{PTDivi, OSTLinux})
+		coinReleasesMu.Unlock()
+	})
+	RegisterCoinRelease(PTDivi, OSTLinux, rel)
+}
+
+func TestInstallCoinBinaries(t *testing.T) {
+	srv := newReleaseServer(t, "")
+	tests := []struct {
+		name string
+		rel  CoinRelease
+	}{
+		{name: "SumsURL", rel: srv.release("", true)},
+		{name: "SHA256", rel: srv.release(strings.ToUpper(srv.sum), false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registerTestRelease(t, tt.rel)
+			bin := filepath.Join(t.TempDir(), "boxdivi")
+			receipt, err := InstallCoinBinaries(context.Background(), PTDivi, OSTLinux, bin)
+			if err != nil {
+				t.Fatalf("InstallCoinBinaries() error = %v", err)
+			}
+			wantFiles := []string{CDiviDFile, CDiviCliFile, CDiviTxFile}
+			if receipt.Coin != cCoinTickerDivi || receipt.Version != "1.0.0" || receipt.Archive != cTestReleaseArchive ||
+				receipt.SHA256 != srv.sum || !reflect.DeepEqual(receipt.Files, wantFiles) {
+				t.Errorf("InstallCoinBinaries() = %+v", receipt)
+			}
+
+			// Just the binaries and the receipt, straight in the bin folder
+			fis, err := ioutil.ReadDir(bin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, fi := range fis {
+				names = append(names, fi.Name())
+				if fi.Name() != CInstallReceiptFile && runtime.GOOS != "windows" && fi.Mode().Perm() != 0755 {
+					t.Errorf("%v mode = %v, want 0755", fi.Name(), fi.Mode().Perm())
+				}
+			}
+			want := append([]string{CInstallReceiptFile}, wantFiles...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("bin folder has %v, want %v", names, want)
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(bin, CDiviDFile)); err != nil || string(b) != "divid binary" {
+				t.Errorf("divid = %q, %v", b, err)
+			}
+
+			saved, err := ReadInstallReceipt(bin)
+			if err != nil {
+				t.Fatalf("ReadInstallReceipt() error = %v", err)
+			}
+			if saved.SHA256 != receipt.SHA256 || !saved.Installed.Equal(receipt.Installed) || !reflect.DeepEqual(saved.Files, receipt.Files) {
+				t.Errorf("ReadInstallReceipt() = %+v, want %+v", saved, receipt)
+			}
+		})
+	}
+}
+
+func TestInstallCoinBinariesAgain(t *testing.T) {
+	srv := newReleaseServer(t, "")
+	registerTestRelease(t, srv.release("", true))
+	bin := filepath.Join(t.TempDir(), "boxdivi")
+	first, err := InstallCoinBinaries(context.Background(), PTDivi, OSTLinux, bin)
+	if err != nil {
+		t.Fatalf("InstallCoinBinaries() error = %v", err)
+	}
+	n := srv.downloads()
+
+	again, err := InstallCoinBinaries(context.Background(), PTDivi, OSTLinux, bin)
+	if err != nil {
+		t.Fatalf("InstallCoinBinaries() again error = %v", err)
+	}
+	if srv.downloads() != n {
+		t.Errorf("downloaded %d more times, the release was already installed", srv.downloads()-n)
+	}
+	if !again.Installed.Equal(first.Installed) || again.SHA256 != first.SHA256 {
+		t.Errorf("InstallCoinBinaries() again = %+v, want the first receipt %+v", again, first)
+	}
+
+	// A missing binary is put back
+	if err := os.Remove(filepath.Join(bin, CDiviCliFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InstallCoinBinaries(context.Background(), PTDivi, OSTLinux, bin); err != nil {
+		t.Fatalf("InstallCoinBinaries() error = %v", err)
+	}
+	if srv.downloads() == n {
+		t.Error("nothing downloaded, but divi-cli was missing")
+	}
+	if _, err := os.Stat(filepath.Join(bin, CDiviCliFile)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInstallCoinBinariesRejected(t *testing.T) {
+	wrong := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		sums    string
+		sha     string
+		useSums bool
+		want    error
+	}{
+		{name: "SHA256 mismatch", sha: wrong, want: ErrInstallChecksumMismatch},
+		// The release's SHA256 wins over the sums file
+		{name: "SHA256 mismatch with sums", sha: wrong, useSums: true, want: ErrInstallChecksumMismatch},
+		{name: "sums mismatch", sums: wrong + "  " + cTestReleaseArchive + "\n", useSums: true, want: ErrInstallChecksumMismatch},
+		{name: "not in sums", sums: wrong + "  other.tar.gz\n", useSums: true, want: ErrInstallUnverified},
+		{name: "no SHA256", want: ErrInstallUnverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newReleaseServer(t, tt.sums)
+			registerTestRelease(t, srv.release(tt.sha, tt.useSums))
+
+			for _, existing := range []bool{false, true} {
+				bin := filepath.Join(t.TempDir(), "boxdivi")
+				if existing {
+					if err := os.Mkdir(bin, 0755); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := InstallCoinBinaries(context.Background(), PTDivi, OSTLinux, bin); !errors.Is(err, tt.want) {
+					t.Fatalf("InstallCoinBinaries() error = %v, want %v", err, tt.want)
+				}
+				fis, err := ioutil.ReadDir(bin)
+				if existing && (err != nil || len(fis) != 0) {
+					t.Errorf("the bin folder has %d files left, %v", len(fis), err)
+				}
+				if !existing && !os.IsNotExist(err) {
+					t.Errorf("the bin folder was left behind: %v", err)
+				}
+			}
+		})
+	}
+}
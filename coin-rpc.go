@@ -0,0 +1,274 @@
+package gwcommon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cRPCDefaultHost string = "127.0.0.1"
+	cRPCTimeout            = 30 * time.Second
+
+	// cRPCErrMethodNotFound - Returned when the daemon doesn't have the method, e.g. because it's an older version
+	cRPCErrMethodNotFound int = -32601
+)
+
+// CoinRPCClient - Makes JSON-RPC calls to the coin daemon e.g. divid
+type CoinRPCClient struct {
+	ProjectType ProjectType
+	URL         string
+	User        string
+	Password    string
+	HTTPClient  *http.Client
+
+	id      uint64
+	txMu    sync.Mutex
+	txCache *txListCache // See listTransactions
+}
+
+// RPCError - An error returned by the coin daemon
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("coin daemon error %d: %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// NewCoinRPCClient - Returns a client for the daemon of the ProjectType, on its default RPC port if port is blank
+func NewCoinRPCClient(pt ProjectType, host, port, user, password string) (*CoinRPCClient, error) {
+	if host == "" {
+		host = cRPCDefaultHost
+	}
+	if port == "" {
+		var err error
+		port, err = GetCoinRPCPort(pt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &CoinRPCClient{
+		ProjectType: pt,
+		URL:         "http://" + net.JoinHostPort(host, port),
+		User:        user,
+		Password:    password,
+		HTTPClient:  &http.Client{Timeout: cRPCTimeout},
+	}, nil
+}
+
+// NewCoinRPCClientFromConf - Returns a client for the coin daemon using the CLI config
+func NewCoinRPCClientFromConf(cs CLIConfStruct) (*CoinRPCClient, error) {
+	return NewCoinRPCClient(cs.ProjectType, cs.ServerIP, "", cs.RPCuser, cs.RPCpassword)
+}
+
+// GetCoinRPCPort - Returns the default RPC port of the coin daemon
+func GetCoinRPCPort(pt ProjectType) (string, error) {
+	switch pt {
+	case PTDivi:
+		return CDiviRPCPort, nil
+	case PTPhore:
+		return CPhoreRPCPort, nil
+	case PTPIVX:
+		return CPIVXRPCPort, nil
+	case PTTrezarcoin:
+		return CTrezarcoinRPCPort, nil
+	default:
+		return "", errors.New("unable to determine ProjectType")
+	}
+}
+
+// GetCoinP2PPort - Returns the default peer to peer port of the coin daemon
+func GetCoinP2PPort(pt ProjectType) (string, error) {
+	switch pt {
+	case PTDivi:
+		return CDiviP2PPort, nil
+	case PTPhore:
+		return CPhoreP2PPort, nil
+	case PTPIVX:
+		return CPIVXP2PPort, nil
+	case PTTrezarcoin:
+		return CTrezarcoinP2PPort, nil
+	default:
+		return "", errors.New("unable to determine ProjectType")
+	}
+}
+
+// Call - Calls the RPC method with params, and unmarshals the result into result if it's not nil
+func (c *CoinRPCClient) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "1.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.User, c.Password)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call %v: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("unable to call %v: the rpcuser or rpcpassword is incorrect", method)
+	}
+
+	// The daemon returns errors with a 404 or 500 status, but still with a JSON body
+	var rr rpcResponse
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&rr); err != nil {
+		return fmt.Errorf("unable to decode %v response (%v): %v", method, resp.Status, err)
+	}
+	if rr.Error != nil {
+		return rr.Error
+	}
+	if result == nil {
+		return nil
+	}
+	dec = json.NewDecoder(bytes.NewReader(rr.Result))
+	dec.UseNumber()
+	if err := dec.Decode(result); err != nil {
+		return fmt.Errorf("unable to decode %v result: %v", method, err)
+	}
+	return nil
+}
+
+// IsRPCError - Returns true if err is an *RPCError with the code
+func IsRPCError(err error, code int) bool {
+	var rerr *RPCError
+	return errors.As(err, &rerr) && rerr.Code == code
+}
+
+// walletInfoStruct - The parts of getwalletinfo that we're interested in
+type walletInfoStruct struct {
+	Balance            Amount `json:"balance"`
+	UnconfirmedBalance Amount `json:"unconfirmed_balance"`
+	ImmatureBalance    Amount `json:"immature_balance"`
+	UnlockedUntil      *int64 `json:"unlocked_until"`
+	EncryptionStatus   string `json:"encryption_status"`
+}
+
+// WalletBalanceStruct - The wallet's balances
+type WalletBalanceStruct struct {
+	Balance     Amount // Confirmed and spendable
+	Unconfirmed Amount
+	Immature    Amount // Stake and masternode rewards that can't be spent yet
+}
+
+// GetWalletSecurityStatus - Returns one of the CWalletStatus constants e.g. CWalletStatusLocked
+func (c *CoinRPCClient) GetWalletSecurityStatus(ctx context.Context) (string, error) {
+	var wi walletInfoStruct
+	if err := c.Call(ctx, "getwalletinfo", nil, &wi); err != nil {
+		return "", err
+	}
+
+	// Divi reports the status directly, which is the only way to spot a wallet unlocked for staking
+	if wi.EncryptionStatus != "" {
+		return wi.EncryptionStatus, nil
+	}
+
+	switch {
+	case wi.UnlockedUntil == nil:
+		return CWalletStatusUnEncrypted, nil
+	case *wi.UnlockedUntil == 0:
+		return CWalletStatusLocked, nil
+	default:
+		return CWalletStatusUnlocked, nil
+	}
+}
+
+// GetWalletBalance - Returns the wallet's balances
+func (c *CoinRPCClient) GetWalletBalance(ctx context.Context) (WalletBalanceStruct, error) {
+	var wi walletInfoStruct
+	if err := c.Call(ctx, "getwalletinfo", nil, &wi); err != nil {
+		return WalletBalanceStruct{}, err
+	}
+	return WalletBalanceStruct{
+		Balance:     wi.Balance,
+		Unconfirmed: wi.UnconfirmedBalance,
+		Immature:    wi.ImmatureBalance,
+	}, nil
+}
+
+// GetRecoveryPhrase - Returns the wallet's recovery phrase, the wallet needs to be unlocked first
+func (c *CoinRPCClient) GetRecoveryPhrase(ctx context.Context) (string, error) {
+	if c.ProjectType != PTDivi {
+		return "", errors.New("retrieving the recovery phrase is only supported for Divi")
+	}
+
+	var hd struct {
+		Mnemonic string `json:"mnemonic"`
+	}
+	if err := c.Call(ctx, "dumphdinfo", nil, &hd); err != nil {
+		return "", err
+	}
+	return hd.Mnemonic, nil
+}
+
+// ReadCoinConfRPCCredentials - Returns the rpcuser, rpcpassword and rpcport (blank if not set) from a coin conf file e.g. divi.conf
+func ReadCoinConfRPCCredentials(confFile string) (user, password, port string, err error) {
+	f, err := os.Open(confFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "rpcuser":
+			user = strings.TrimSpace(kv[1])
+		case "rpcpassword":
+			password = strings.TrimSpace(kv[1])
+		case "rpcport":
+			port = strings.TrimSpace(kv[1])
+		}
+	}
+	return user, password, port, scanner.Err()
+}
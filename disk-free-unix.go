@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package gwcommon
+
+import "syscall"
+
+// diskFreeBytes - Returns the space available to the user on the filesystem holding path
+func diskFreeBytes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package gwcommon
+
+import "golang.org/x/sys/windows"
+
+// diskFreeBytes - Returns the space available to the user on the volume holding path
+func diskFreeBytes(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
@@ -1,7 +1,10 @@
 package gwcommon
 
 const (
-	cCoinNameDivi string = "Divi"
+	cCoinNameDivi    string = "Divi"
+	cCoinTickerDivi  string = "DIVI"
+	cCoinGeckoIDDivi string = "divi"
+	cChainSizeMBDivi int    = 6000
 
 	// CDiviAppVersion - The app version of Divi
 	CDiviAppVersion string = "1.1.2"
@@ -20,6 +23,7 @@ const (
 	CAppNameUpdaterGoDivi string = "BoxDivi Updater"
 	CAppNameCLIBoxDivi    string = "BoxDivi CLI"
 	//CAppNameServerGoDivi  string = "BoxDivi Server"
+	CAppNameServerBoxDivi string = "BoxDivi Server"
 
 	CDiviConfFile   string = "divi.conf"
 	CDiviCliFile    string = "divi-cli"
@@ -28,6 +32,8 @@ const (
 	CDiviDFileWin   string = "divid.exe"
 	CDiviTxFile     string = "divi-tx"
 	CDiviTxFileWin  string = "divi-tx.exe"
+	CDiviRPCPort    string = "51473"
+	CDiviP2PPort    string = "51472"
 
 	// CAppCLIFileGoDivi - Only to be used by GoDeploy
 	CAppCLIFileBoxDivi    string = "boxdivi"
@@ -36,6 +42,8 @@ const (
 	//CAppCLIFileInstallerWinGoDivi string = "godivi-installer.exe"
 	//CAppServerFileGoDivi          string = "godivis"
 	//CAppServerFileWinGoDivi       string = "godivis.exe"
+	CAppServerFileBoxDivi     string = "boxdivis"
+	CAppServerFileWinBoxDivi  string = "boxdivis.exe"
 	CAppUpdaterFileBoxDivi    string = "update-boxdivi"
 	CAppUpdaterFileWinBoxDivi string = "update-boxdivi.exe"
 	CAppCLILogfileBoxDivi     string = "boxdivi.log"
@@ -1,16 +1,13 @@
 package gwcommon
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/user"
 	"runtime"
-	"strings"
 
 	"github.com/inconshreveable/go-update"
 	"github.com/mitchellh/go-ps"
@@ -21,6 +18,7 @@ const (
 	// CDownloadURLGD - The download file location for GoDivi
 	CDownloadURLGD string = "https://bitbucket.org/rmace/godivi/downloads/"
 
+	// cWalletSeedFileBoxDivi - Legacy plaintext seed file, see MigratePlaintextSeedFile
 	cWalletSeedFileBoxDivi string = "unsecure-divi-seed.txt"
 
 	// Divid Responses
@@ -103,65 +101,61 @@ const (
 	NotRequired               ServerResponse = 0
 	MalformedRequest          ServerResponse = 1
 	NoServerError             ServerResponse = 2
+	Unauthorised              ServerResponse = 3
+	UnknownRequest            ServerResponse = 4
+	InternalError             ServerResponse = 5
 	WalletDidNotRespondInTime ServerResponse = 30
+	WalletError               ServerResponse = 31
 )
 
 // Server Request Constants
 const (
 	CServRequestGenerateToken  string = "GenerateToken"
+	CServRequestListClients    string = "ListClients"
+	CServRequestRevokeClient   string = "RevokeClient"
 	CServRequestShutdownServer string = "ShutdownServer"
 )
 
 // Wallet Request Constants
 const (
 	// Gets
-	CWalletRequestGetPrivateKey   string = "GetPrivateKey"
-	CWalletRequestGetWalletStatus string = "GetWalletStatus"
+	CWalletRequestGetMasternodes      string = "GetMasternodes"
+	CWalletRequestGetNewAddress       string = "GetNewAddress"
+	CWalletRequestGetPrivateKey       string = "GetPrivateKey"
+	CWalletRequestGetReceiveAddresses string = "GetReceiveAddresses"
+	CWalletRequestGetStakingRewards   string = "GetStakingRewards"
+	CWalletRequestGetStakingStatus    string = "GetStakingStatus"
+	CWalletRequestGetTransactions     string = "GetTransactions"
+	CWalletRequestGetWalletStatus     string = "GetWalletStatus"
 
 	// Sets
 	CWalletRequestSetPrivSeedStored string = "SetPrivSeedStored"
+
+	// Actions
+	CWalletRequestSend            string = "Send"
+	CWalletRequestStartMasternode string = "StartMasternode"
+
+	// Streams
+	CWalletRequestEvents string = "Events"
 )
 
 var lastBCSyncStatus string = ""
 var lastMNSyncStatus string = ""
 
-// AddProjectPath - Add the coin project path to the profile
-func AddProjectPath() error {
-	if runtime.GOOS != "windows" {
-		u, err := user.Current()
-		if err != nil {
-			return err
-		}
-		sProfile := AddTrailingSlash(u.HomeDir) + ".profile"
-		gdf, err := GetAppsBinFolder(APPTCLI)
-		if err != nil {
-			return fmt.Errorf("Unable to GetAppsBinFolder: %v ", err)
-		}
+// errProcessNotFound - findProcess looked, and the process isn't running
+var errProcessNotFound = errors.New("not found")
 
-		if FileExists(sProfile) {
-			// First make sure that the path hasn't already been added
-			seif, err := StringExistsInFile(cGoDiviExportPath+gdf, sProfile)
-			if err != nil {
-				return fmt.Errorf("err checking profile: %v ", err)
-			}
-			if !seif {
-				f, err := os.OpenFile(sProfile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
-				if err != nil {
-					return fmt.Errorf("Unable to open profile: %v ", err)
-				}
-
-				defer f.Close()
-				fmt.Fprintf(f, "%s\n", cGoDiviExportPath+gdf)
-
-				//run "source $HOME/.profile" so that the godivi path is live
-				cmd := exec.Command("bash", "-c", "source "+sProfile)
-				if err := cmd.Run(); err != nil {
-					return fmt.Errorf("error: %v", err)
-				}
-			}
-		}
+// AddProjectPath - Add the coin project path to the login shell's startup files, see AddToPath
+//
+// Deprecated: use AddToPath with GetAppsBinFolder(APPTCLI), which also returns the Instructions the user needs to
+// pick up the change in the current terminal
+func AddProjectPath() error {
+	gdf, err := GetAppsBinFolder(APPTCLI)
+	if err != nil {
+		return fmt.Errorf("Unable to GetAppsBinFolder: %v ", err)
 	}
-	return nil
+	_, err = AddToPath(gdf, PathOptions{})
+	return err
 }
 
 // ConvertBCVerification - Convert Blockchain verification progress
@@ -191,8 +185,11 @@ func doUpdate(url string) error {
 func findProcess(key string) (int, string, error) {
 	pname := ""
 	pid := 0
-	err := errors.New("not found")
-	ps, _ := ps.Processes()
+	err := errProcessNotFound
+	ps, perr := ps.Processes()
+	if perr != nil {
+		return 0, "", fmt.Errorf("unable to list processes: %v", perr)
+	}
 
 	for i := range ps {
 		if ps[i].Executable() == key {
@@ -666,6 +663,38 @@ func GetCoinName(at APPType) (string, error) {
 	return "", nil
 }
 
+// GetCoinTicker - Returns the exchange ticker of the coin e.g. DIVI
+func GetCoinTicker(pt ProjectType) (string, error) {
+	switch pt {
+	case PTDivi:
+		return cCoinTickerDivi, nil
+	case PTPhore:
+		return cCoinTickerPhore, nil
+	case PTPIVX:
+		return cCoinTickerPIVX, nil
+	case PTTrezarcoin:
+		return cCoinTickerTrezarcoin, nil
+	default:
+		return "", errors.New("unable to determine ProjectType")
+	}
+}
+
+// coinName - Returns the name of the coin e.g. Divi, for when the ProjectType is already known
+func coinName(pt ProjectType) (string, error) {
+	switch pt {
+	case PTDivi:
+		return cCoinNameDivi, nil
+	case PTPhore:
+		return cCoinNamePhore, nil
+	case PTPIVX:
+		return cCoinNamePIVX, nil
+	case PTTrezarcoin:
+		return cCoinNameTrezarcoin, nil
+	default:
+		return "", errors.New("unable to determine ProjectType")
+	}
+}
+
 // GetGoWalletDownloadLink - Used by updater and installer Returns a link of both the url and file
 func GetGoWalletDownloadLink(ostype OSType) (url, file string, err error) {
 	gwconf, err := GetCLIConfStruct()
@@ -712,52 +741,23 @@ func GetGoWalletDownloadLink(ostype OSType) (url, file string, err error) {
 	return "", "", nil
 }
 
+// GetEncryptWalletResp - Asks the user whether they would like to encrypt their wallet
 func GetEncryptWalletResp() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(`Your wallet is currently UNENCRYPTED!
-
-It is *highly* recommended that you encrypt your wallet before proceeding any further.
-
-Encrypt it now?: (y/n)`)
-	resp, _ := reader.ReadString('\n')
-	resp = strings.ReplaceAll(resp, "\n", "")
-	return resp
+	return defaultPrompter().GetEncryptWalletResp()
 }
 
-func GetWalletEncryptionPassword() string {
-	reader := bufio.NewReader(os.Stdin)
-	for i := 0; i <= 2; i++ {
-		fmt.Print("\nPlease enter a password to encrypt your wallet: ")
-		epw1, _ := reader.ReadString('\n')
-		fmt.Print("\nNow please re-enter your password: ")
-		epw2, _ := reader.ReadString('\n')
-		if epw1 != epw2 {
-			fmt.Print("\nThe passwords don't match, please try again...\n")
-		} else {
-			s := strings.ReplaceAll(epw1, "\n", "")
-
-			return s
-		}
-	}
-	return ""
+// GetWalletEncryptionPassword - Asks the user for a new wallet password that meets DefaultPasswordPolicy, without echoing it to the terminal
+func GetWalletEncryptionPassword() (string, error) {
+	return defaultPrompter().GetWalletEncryptionPassword()
 }
 
 // GetWalletUnlockPassword - Retrieves the wallet unlock password that the user has entered
 func GetWalletUnlockPassword() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("\nPlease enter your wallet encryption password: ")
-	pw, _ := reader.ReadString('\n')
-	s := strings.ReplaceAll(pw, "\n", "")
-
-	return s
+	return defaultPrompter().GetWalletUnlockPassword()
 }
 
 func getYesNoResp(msg string) string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(msg + " (y/n)")
-	resp, _ := reader.ReadString('\n')
-	resp = strings.ReplaceAll(resp, "\n", "")
-	return resp
+	return defaultPrompter().getYesNoResp(msg)
 }
 
 // IsGoWalletInstalled - Returns bool if GoWallet has been installed
@@ -0,0 +1,414 @@
+package gwcommon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cLogMaxSizeMB   int = 10
+	cLogMaxBackups  int = 5
+	cLogTimeFormat      = "2006-01-02T15:04:05.000Z07:00"
+	cLogBackupStamp     = "2006-01-02T15-04-05"
+	cLogRedacted        = "[REDACTED]"
+)
+
+// LogLevel - How important a log entry is
+type LogLevel int
+
+const (
+	LLDebug LogLevel = iota
+	LLInfo
+	LLWarn
+	LLError
+)
+
+// LogFormat - How log entries are written
+type LogFormat int
+
+const (
+	// LFText - time LEVEL message key=value ...
+	LFText LogFormat = iota
+	// LFJSON - One JSON object per line
+	LFJSON
+)
+
+// cLogSecretKeys - Fields with any of these in their name have their values redacted, as do "key=value",
+// "key: value" and JSON "key":"value" pairs in messages
+var cLogSecretKeys = []string{"password", "passphrase", "token", "secret", "apikey", "authorization", "seed", "mnemonic"}
+
+// cLogSecretCommands - RPC commands whose first argument is a secret, as in "encryptwallet pass" or
+// {"method":"walletpassphrase","params":["pass",60]}. walletpassphrasechange has two
+var cLogSecretCommands = []string{"walletpassphrase", "encryptwallet", "importprivkey"}
+
+const (
+	// cLogSecretValue - A quoted value, an auth scheme with its credential, or anything up to the next space
+	cLogSecretValue = `("(?:[^"\\]|\\.)*"|(?:basic|bearer|digest|negotiate)\s+\S+|\S+)`
+	cLogSecretArg   = `("(?:[^"\\]|\\.)*"|\S+)`
+	cLogSecretParam = `\s*("(?:[^"\\]|\\.)*")`
+)
+
+// logSecretRES - Each group matched is a secret
+var logSecretRES = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)"?\b\w*(?:` + strings.Join(cLogSecretKeys, "|") + `)\w*"?\s*[=:]\s*` + cLogSecretValue),
+	// walletpassphrase needs its timeout to count, so "the wallet passphrase with walletpassphrase first" is left alone
+	regexp.MustCompile(`(?i)\bwalletpassphrasechange\s+` + cLogSecretArg + `\s+` + cLogSecretArg +
+		`|\bwalletpassphrase\s+` + cLogSecretArg + `\s+\d|\b(?:encryptwallet|importprivkey)\s+` + cLogSecretArg),
+	regexp.MustCompile(`(?i)"walletpassphrasechange"\s*,\s*"params"\s*:\s*\[` + cLogSecretParam + `\s*,` + cLogSecretParam +
+		`|"(?:` + strings.Join(cLogSecretCommands, "|") + `)"\s*,\s*"params"\s*:\s*\[` + cLogSecretParam),
+}
+
+// LoggerOptions - Where a Logger writes, and when it rotates
+type LoggerOptions struct {
+	File        string    // e.g. CAppCLILogfileBoxDivi, blank to only write to Out
+	Out         io.Writer // Also written to if set, e.g. os.Stderr. Defaults to os.Stderr if there's no File
+	Level       LogLevel  // Entries below this level are dropped
+	Format      LogFormat
+	MaxSizeMB   int           // The file is rotated when it gets bigger than this, defaults to cLogMaxSizeMB
+	RotateEvery time.Duration // If set, the file is also rotated once it's this old e.g. 24 * time.Hour
+	MaxBackups  int           // How many gzipped old logs to keep, defaults to cLogMaxBackups
+	MaxAge      time.Duration // If set, older gzipped logs are deleted
+	RedactKeys  []string      // Field names to redact, as well as cLogSecretKeys
+}
+
+// Logger - A levelled logger with key/value fields, which rotates and gzips its file and redacts secrets
+type Logger struct {
+	sink   *logSink
+	fields []interface{}
+}
+
+// logSink - The file shared by a Logger and those made from it with With
+type logSink struct {
+	mu      sync.Mutex
+	opts    LoggerOptions
+	f       *os.File
+	size    int64
+	opened  time.Time
+	maxSize int64
+}
+
+// String - debug, info, warn or error
+func (l LogLevel) String() string {
+	switch l {
+	case LLDebug:
+		return "debug"
+	case LLInfo:
+		return "info"
+	case LLWarn:
+		return "warn"
+	case LLError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// ParseLogLevel - Converts e.g. "info" or "WARN" into a LogLevel
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LLDebug, nil
+	case "info", "":
+		return LLInfo, nil
+	case "warn", "warning":
+		return LLWarn, nil
+	case "error":
+		return LLError, nil
+	}
+	return LLInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// NewLogger - Returns a Logger that appends to opts.File, creating it if needed
+func NewLogger(opts LoggerOptions) (*Logger, error) {
+	if opts.MaxSizeMB <= 0 {
+		opts.MaxSizeMB = cLogMaxSizeMB
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = cLogMaxBackups
+	}
+	if opts.File == "" && opts.Out == nil {
+		opts.Out = os.Stderr
+	}
+	s := &logSink{opts: opts, maxSize: int64(opts.MaxSizeMB) * 1024 * 1024}
+	if opts.File != "" {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+	return &Logger{sink: s}, nil
+}
+
+// With - Returns a Logger that adds the key/value pairs to every entry, sharing l's file
+func (l *Logger) With(kv ...interface{}) *Logger {
+	return &Logger{sink: l.sink, fields: append(append([]interface{}(nil), l.fields...), kv...)}
+}
+
+// Debug - Logs msg and the key/value pairs at debug level
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.Log(LLDebug, msg, kv...) }
+
+// Info - Logs msg and the key/value pairs at info level
+func (l *Logger) Info(msg string, kv ...interface{}) { l.Log(LLInfo, msg, kv...) }
+
+// Warn - Logs msg and the key/value pairs at warn level
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.Log(LLWarn, msg, kv...) }
+
+// Error - Logs msg and the key/value pairs at error level
+func (l *Logger) Error(msg string, kv ...interface{}) { l.Log(LLError, msg, kv...) }
+
+// Log - Logs msg and the key/value pairs, e.g. "txid", txid, at level. Returns any error writing the file
+func (l *Logger) Log(level LogLevel, msg string, kv ...interface{}) error {
+	s := l.sink
+	if level < s.opts.Level {
+		return nil
+	}
+	line := s.format(time.Now(), level, msg, append(append([]interface{}(nil), l.fields...), kv...))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.Out != nil {
+		s.opts.Out.Write(line)
+	}
+	if s.f == nil {
+		return nil
+	}
+	if s.needsRotation(len(line)) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close - Closes the log file
+func (l *Logger) Close() error {
+	s := l.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *logSink) format(t time.Time, level LogLevel, msg string, kv []interface{}) []byte {
+	msg = redactSecrets(msg)
+
+	type field struct {
+		key   string
+		value interface{}
+	}
+	var fields []field
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var v interface{} = "(missing)"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		switch tv := v.(type) {
+		case error:
+			v = tv.Error()
+		case fmt.Stringer:
+			v = tv.String()
+		}
+		if s.isSecret(key) {
+			v = cLogRedacted
+		} else if str, ok := v.(string); ok {
+			v = redactSecrets(str)
+		} else if str := fmt.Sprint(v); redactSecrets(str) != str {
+			// e.g. a command's args, []string{"-rpcpassword=..."}
+			v = redactSecrets(str)
+		}
+		fields = append(fields, field{key, v})
+	}
+
+	if s.opts.Format == LFJSON {
+		m := map[string]interface{}{"time": t.Format(cLogTimeFormat), "level": level.String(), "msg": msg}
+		for _, f := range fields {
+			if _, taken := m[f.key]; taken {
+				f.key = "field." + f.key
+			}
+			m[f.key] = f.value
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			b, _ = json.Marshal(map[string]interface{}{"time": t.Format(cLogTimeFormat), "level": level.String(), "msg": msg, "logError": err.Error()})
+		}
+		return append(b, '\n')
+	}
+
+	var sb strings.Builder
+	sb.WriteString(t.Format(cLogTimeFormat))
+	sb.WriteString(" " + strings.ToUpper(level.String()) + " " + msg)
+	for _, f := range fields {
+		v := fmt.Sprint(f.value)
+		if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+			v = strconv.Quote(v)
+		}
+		sb.WriteString(" " + f.key + "=" + v)
+	}
+	sb.WriteString("\n")
+	return []byte(sb.String())
+}
+
+// redactSecrets - Replaces the secrets logSecretRES finds in str, keeping any quotes around them
+func redactSecrets(str string) string {
+	for _, re := range logSecretRES {
+		var sb strings.Builder
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(str, -1) {
+			for g := 2; g < len(m); g += 2 {
+				start, end := m[g], m[g+1]
+				if start < 0 {
+					continue
+				}
+				sb.WriteString(str[last:start])
+				if strings.HasPrefix(str[start:end], `"`) {
+					sb.WriteString(`"` + cLogRedacted + `"`)
+				} else {
+					sb.WriteString(cLogRedacted)
+				}
+				last = end
+			}
+		}
+		sb.WriteString(str[last:])
+		str = sb.String()
+	}
+	return str
+}
+
+func (s *logSink) isSecret(key string) bool {
+	k := strings.ToLower(key)
+	for _, secret := range cLogSecretKeys {
+		if strings.Contains(k, secret) {
+			return true
+		}
+	}
+	for _, r := range s.opts.RedactKeys {
+		if strings.EqualFold(key, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *logSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.opts.File), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.size = fi.Size()
+	s.opened = time.Now()
+	if s.size > 0 {
+		// Carry on from when the existing file was last written
+		s.opened = fi.ModTime()
+	}
+	return nil
+}
+
+func (s *logSink) needsRotation(n int) bool {
+	if s.size > 0 && s.size+int64(n) > s.maxSize {
+		return true
+	}
+	return s.opts.RotateEvery > 0 && s.size > 0 && time.Since(s.opened) > s.opts.RotateEvery
+}
+
+// rotate - Renames the current file with a timestamp, gzips it and starts a new one. Must be called with s.mu held
+func (s *logSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+
+	ext := filepath.Ext(s.opts.File)
+	base := strings.TrimSuffix(s.opts.File, ext) + "-" + time.Now().Format(cLogBackupStamp)
+	// A second rotation in the same second gets a number, rather than overwriting the first one's gzip
+	backup := base + ext
+	for i := 1; FileExists(backup) || FileExists(backup+".gz"); i++ {
+		backup = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if err := os.Rename(s.opts.File, backup); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if _, err := gZipIt(backup, filepath.Dir(backup), true); err != nil {
+		return fmt.Errorf("unable to compress %v: %v", backup, err)
+	}
+	return s.prune()
+}
+
+// prune - Deletes the oldest gzipped logs beyond MaxBackups or MaxAge
+func (s *logSink) prune() error {
+	ext := filepath.Ext(s.opts.File)
+	prefix := filepath.Base(strings.TrimSuffix(s.opts.File, ext)) + "-"
+	dir := filepath.Dir(s.opts.File)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []os.FileInfo
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), prefix) && strings.HasSuffix(f.Name(), ext+".gz") {
+			backups = append(backups, f)
+		}
+	}
+	// Newest first. Those from the same second have the same timestamp in their names, so go by when they were written
+	sort.Slice(backups, func(i, j int) bool {
+		if ti, tj := backups[i].ModTime(), backups[j].ModTime(); !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return backups[i].Name() > backups[j].Name()
+	})
+	for i, b := range backups {
+		if i >= s.opts.MaxBackups || (s.opts.MaxAge > 0 && time.Since(b.ModTime()) > s.opts.MaxAge) {
+			if err := os.Remove(filepath.Join(dir, b.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	fileLoggersMu sync.Mutex
+	fileLoggers   = make(map[string]*Logger)
+)
+
+// fileLogger - Returns the Logger AddToLog uses for the file, opening it the first time
+func fileLogger(logFile string) (*Logger, error) {
+	fileLoggersMu.Lock()
+	defer fileLoggersMu.Unlock()
+	if l, ok := fileLoggers[logFile]; ok {
+		return l, nil
+	}
+	l, err := NewLogger(LoggerOptions{File: logFile})
+	if err != nil {
+		return nil, err
+	}
+	fileLoggers[logFile] = l
+	return l, nil
+}
@@ -0,0 +1,324 @@
+package gwcommon
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "key=value", in: "rpcpassword=hunter2 rpcport=51473", want: "rpcpassword=[REDACTED] rpcport=51473"},
+		{name: "key: value", in: "Passphrase:  hunter2", want: "Passphrase:  [REDACTED]"},
+		{name: "quoted", in: `token="a b c" next`, want: `token="[REDACTED]" next`},
+		{name: "escaped quote", in: `secret="a \" b" next`, want: `secret="[REDACTED]" next`},
+		{name: "flag", in: "divid -rpcpassword=hunter2 -daemon=0", want: "divid -rpcpassword=[REDACTED] -daemon=0"},
+		{name: "basic auth", in: "Authorization: Basic dXNlcjpwYXNz", want: "Authorization: [REDACTED]"},
+		{name: "bearer auth", in: "authorization=Bearer abc.def.ghi done", want: "authorization=[REDACTED] done"},
+		{name: "json", in: `{"rpcuser":"u","rpcpassword":"hunter2"}`, want: `{"rpcuser":"u","rpcpassword":"[REDACTED]"}`},
+		{name: "json spaced", in: `{"apiKey" : "k1", "seed": "w1 w2"}`, want: `{"apiKey" : "[REDACTED]", "seed": "[REDACTED]"}`},
+		{name: "json auth header", in: `{"Authorization":"Basic dXNlcjpwYXNz"}`, want: `{"Authorization":"[REDACTED]"}`},
+		{
+			name: "walletpassphrase",
+			in:   `divi-cli walletpassphrase "correct horse battery" 60 true`,
+			want: `divi-cli walletpassphrase "[REDACTED]" 60 true`,
+		},
+		{name: "walletpassphrase unquoted", in: "walletpassphrase hunter2 0", want: "walletpassphrase [REDACTED] 0"},
+		{name: "walletpassphrasechange", in: `walletpassphrasechange old "new one"`, want: `walletpassphrasechange [REDACTED] "[REDACTED]"`},
+		{name: "encryptwallet", in: "encryptwallet hunter2", want: "encryptwallet [REDACTED]"},
+		{
+			name: "json-rpc",
+			in:   `{"jsonrpc":"1.0","id":"1","method":"walletpassphrase","params":["correct horse",60,true]}`,
+			want: `{"jsonrpc":"1.0","id":"1","method":"walletpassphrase","params":["[REDACTED]",60,true]}`,
+		},
+		{
+			name: "json-rpc change",
+			in:   `{"method":"walletpassphrasechange","params":["old", "new"]}`,
+			want: `{"method":"walletpassphrasechange","params":["[REDACTED]", "[REDACTED]"]}`,
+		},
+		// Messages that only mention secrets are left alone
+		{name: "daemon error", in: "Error: Please enter the wallet passphrase with walletpassphrase first.", want: "Error: Please enter the wallet passphrase with walletpassphrase first."},
+		{name: "sudo", in: "sudo: a password is required", want: "sudo: a password is required"},
+		{name: "nothing secret", in: "blocks=12345 peers: 8", want: "blocks=12345 peers: 8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactSecrets(tt.in); got != tt.want {
+				t.Errorf("redactSecrets(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+type testStringer struct{}
+
+func (testStringer) String() string { return "passphrase=hunter2" }
+
+func TestLoggerRedactsFields(t *testing.T) {
+	var out bytes.Buffer
+	l, err := NewLogger(LoggerOptions{Out: &out, Format: LFJSON, RedactKeys: []string{"rpcuser"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.With("wallet_password", "hunter2").Info("starting rpcpassword=hunter2",
+		"args", []string{"-rpcpassword=hunter2", "-daemon=0"},
+		"conf", map[string]string{"rpcpassword": "hunter2"},
+		"err", errors.New(`walletpassphrase "hunter2" 60: timed out`),
+		"stringer", testStringer{},
+		"rpcuser", "divi",
+		"height", 12345,
+		"peers", []string{"1.2.3.4"},
+	)
+
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("a secret was logged: %s", out.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"msg":             "starting rpcpassword=[REDACTED]",
+		"wallet_password": cLogRedacted,
+		"args":            "[-rpcpassword=[REDACTED] -daemon=0]",
+		"conf":            "map[rpcpassword:[REDACTED]",
+		"err":             `walletpassphrase "[REDACTED]" 60: timed out`,
+		"stringer":        "passphrase=[REDACTED]",
+		"rpcuser":         cLogRedacted,
+		// Values without secrets keep their type
+		"height": float64(12345),
+		"peers":  []interface{}{"1.2.3.4"},
+	}
+	for k, v := range want {
+		if got := entry[k]; !jsonEqual(got, v) {
+			t.Errorf("%v = %#v, want %#v", k, got, v)
+		}
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+func TestLoggerText(t *testing.T) {
+	var out bytes.Buffer
+	l, err := NewLogger(LoggerOptions{Out: &out, Level: LLInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("dropped")
+	l.Warn("sync stalled", "height", 10, "note", "a b", "empty", "", "odd")
+	got := out.String()
+	if strings.Contains(got, "dropped") {
+		t.Errorf("a debug entry was logged at info level: %q", got)
+	}
+	want := ` WARN sync stalled height=10 note="a b" empty="" odd=(missing)` + "\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("Log() = %q, want it to end %q", got, want)
+	}
+	if _, err := time.Parse(cLogTimeFormat, strings.Fields(got)[0]); err != nil {
+		t.Errorf("time: %v", err)
+	}
+}
+
+// writeTestLog - Logs n entries of about size bytes each, numbered from first
+func writeTestLog(t *testing.T, l *Logger, first, n, size int) {
+	t.Helper()
+	pad := strings.Repeat("x", size)
+	for i := first; i < first+n; i++ {
+		if err := l.Log(LLInfo, "entry", "n", i, "pad", pad); err != nil {
+			t.Fatalf("Log() error = %v", err)
+		}
+	}
+}
+
+// readTestLog - The entry numbers in a log, gzipped or not
+func readTestLog(t *testing.T, file string) []int {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var ns []int
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		var entry struct{ N int }
+		if err := json.Unmarshal(s.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		ns = append(ns, entry.N)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
+
+func logBackups(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "gwtest-*.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestLoggerRotates(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gwtest.log")
+	l, err := NewLogger(LoggerOptions{File: file, Format: LFJSON, MaxSizeMB: 1, MaxBackups: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// 5 entries fit in 1 MB, so 18 rotate 3 times, most likely all in the same second
+	writeTestLog(t, l, 0, 18, 200*1024)
+	backups := logBackups(t, dir)
+	if len(backups) != 3 {
+		t.Fatalf("backups = %v, want 3", backups)
+	}
+
+	// Every entry is in a backup or the current log, once
+	var all []int
+	for _, b := range backups {
+		ns := readTestLog(t, b)
+		if len(ns) != 5 {
+			t.Errorf("%v has %d entries, want 5", b, len(ns))
+		}
+		all = append(all, ns...)
+		if fi, err := os.Stat(b); err == nil && runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+			t.Errorf("%v mode = %v, want 0600", b, fi.Mode().Perm())
+		}
+	}
+	current := readTestLog(t, file)
+	if !(len(current) == 3 && current[0] == 15) {
+		t.Errorf("the current log has %v, want 15 to 17", current)
+	}
+	all = append(all, current...)
+	sort.Ints(all)
+	for i, n := range all {
+		if n != i {
+			t.Fatalf("entries = %v, want 0 to 17", all)
+		}
+	}
+	if len(all) != 18 {
+		t.Errorf("%d entries, want 18", len(all))
+	}
+	// Only the gzips are left
+	if left, _ := filepath.Glob(filepath.Join(dir, "gwtest-*.log")); len(left) != 0 {
+		t.Errorf("uncompressed backups left: %v", left)
+	}
+}
+
+func TestLoggerPrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gwtest.log")
+	l, err := NewLogger(LoggerOptions{File: file, Format: LFJSON, MaxSizeMB: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// An old backup, and a file that only looks like one
+	old := filepath.Join(dir, "gwtest-2001-01-01T00-00-00.log.gz")
+	other := filepath.Join(dir, "other-2001-01-01T00-00-00.log.gz")
+	for _, f := range []string{old, other} {
+		if err := ioutil.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		past := time.Now().Add(-48 * time.Hour)
+		if err := os.Chtimes(f, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestLog(t, l, 0, 18, 200*1024)
+	backups := logBackups(t, dir)
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want the newest 2", backups)
+	}
+	// The newest two hold entries 5 to 14
+	var all []int
+	for _, b := range backups {
+		all = append(all, readTestLog(t, b)...)
+	}
+	sort.Ints(all)
+	if len(all) != 10 || all[0] != 5 || all[9] != 14 {
+		t.Errorf("the backups kept hold %v, want 5 to 14", all)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("pruned another log: %v", err)
+	}
+}
+
+func TestLoggerPrunesByAge(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gwtest.log")
+	l, err := NewLogger(LoggerOptions{File: file, Format: LFJSON, RotateEvery: time.Nanosecond, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	old := filepath.Join(dir, "gwtest-2001-01-01T00-00-00.log.gz")
+	if err := ioutil.WriteFile(old, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	// With RotateEvery so short, each entry after the first rotates the one before
+	writeTestLog(t, l, 0, 3, 10)
+	backups := logBackups(t, dir)
+	if len(backups) != 2 {
+		t.Errorf("backups = %v, want 2 new ones", backups)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the backup older than MaxAge is still there: %v", err)
+	}
+	if got := readTestLog(t, file); len(got) != 1 || got[0] != 2 {
+		t.Errorf("the current log has %v, want 2", got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for in, want := range map[string]LogLevel{"debug": LLDebug, "": LLInfo, " Info ": LLInfo, "WARNING": LLWarn, "error": LLError} {
+		if got, err := ParseLogLevel(in); err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("ParseLogLevel(\"loud\") should fail")
+	}
+}
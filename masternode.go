@@ -0,0 +1,420 @@
+package gwcommon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CMasternodeConfFile - Lists the wallet's masternodes, in the coin home folder
+	CMasternodeConfFile string = "masternode.conf"
+
+	// Statuses reported by listmasternodes, the daemons have a few others which are passed through unchanged
+	CMasternodeStatusEnabled          string = "ENABLED"
+	CMasternodeStatusPreEnabled       string = "PRE_ENABLED"
+	CMasternodeStatusExpired          string = "EXPIRED"
+	CMasternodeStatusRemove           string = "REMOVE"
+	CMasternodeStatusNewStartRequired string = "NEW_START_REQUIRED"
+	CMasternodeStatusVinSpent         string = "VIN_SPENT"
+	// CMasternodeStatusMissing - The masternode isn't in the network's list at all, usually because it's not started
+	CMasternodeStatusMissing string = "MISSING"
+
+	cMasternodePollInterval = time.Minute
+	cMasternodeConfHeader   = "# Masternode config file\n" +
+		"# Format: alias IP:port masternodeprivkey collateral_output_txid collateral_output_index\n" +
+		"# Example: mn1 127.0.0.2:51472 93HaYBVUCYjEMeeH1Y4sBGLALQZE1Yc1K64xiqgX37tGBDQL8Xg 2bcd3c84c84f87eaa86e4e56834c92927a07f9e18718810b92e0d0324456a67c 0\n"
+)
+
+var (
+	// ErrMasternodeAliasExists - masternode.conf already has an entry with the alias
+	ErrMasternodeAliasExists = errors.New("a masternode with that alias already exists")
+
+	errMasternodesNotSupported = errors.New("masternodes are not supported for this coin")
+)
+
+// MasternodeConfEntry - A line of masternode.conf
+type MasternodeConfEntry struct {
+	Alias       string
+	Address     string // IP:port
+	PrivKey     string
+	TxHash      string // Of the collateral
+	OutputIndex int    // Of the collateral
+}
+
+// MasternodeCollateralStruct - An unspent output that can be used as masternode collateral
+type MasternodeCollateralStruct struct {
+	TxHash        string
+	OutputIndex   int
+	Amount        Amount // Zero if the daemon didn't say
+	Confirmations int64
+}
+
+// MasternodeStatusStruct - A masternode's state in the network's masternode list
+type MasternodeStatusStruct struct {
+	Alias       string
+	TxHash      string
+	OutputIndex int
+	Address     string
+	Status      string // One of the CMasternodeStatus constants
+	LastSeen    time.Time
+	ActiveTime  time.Duration
+	LastPaid    time.Time
+}
+
+// MasternodeStatusChangeStruct - Data of WETMasternodeStatus
+type MasternodeStatusChangeStruct struct {
+	MasternodeStatusStruct
+	PreviousStatus string // Blank the first time the masternode is seen
+}
+
+// GetMasternodeConfFile - Returns the path of masternode.conf in the coin home folder
+func GetMasternodeConfFile(at APPType) (string, error) {
+	dir, err := GetCoinHomeFolder(at)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CMasternodeConfFile), nil
+}
+
+// ReadMasternodeConf - Returns the entries in masternode.conf, which doesn't need to exist yet
+func ReadMasternodeConf(file string) ([]MasternodeConfEntry, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []MasternodeConfEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("%v line %d: expected 5 fields but found %d", file, n, len(fields))
+		}
+		idx, err := strconv.Atoi(fields[4])
+		if err != nil || idx < 0 {
+			return nil, fmt.Errorf("%v line %d: invalid collateral output index %v", file, n, fields[4])
+		}
+		entries = append(entries, MasternodeConfEntry{
+			Alias:       fields[0],
+			Address:     fields[1],
+			PrivKey:     fields[2],
+			TxHash:      fields[3],
+			OutputIndex: idx,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// WriteMasternodeConf - Replaces masternode.conf with the entries
+func WriteMasternodeConf(file string, entries []MasternodeConfEntry) error {
+	var sb strings.Builder
+	sb.WriteString(cMasternodeConfHeader)
+	for _, e := range entries {
+		if err := e.validate(); err != nil {
+			return err
+		}
+		fmt.Fprintf(&sb, "%s %s %s %s %d\n", e.Alias, e.Address, e.PrivKey, e.TxHash, e.OutputIndex)
+	}
+
+	// It holds the masternode private keys, so keep it private
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".masternode-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(sb.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// AddMasternodeConfEntry - Appends the entry to masternode.conf. The daemon needs restarting to pick it up
+func AddMasternodeConfEntry(file string, e MasternodeConfEntry) error {
+	entries, err := ReadMasternodeConf(file)
+	if err != nil {
+		return err
+	}
+	for _, existing := range entries {
+		if existing.Alias == e.Alias {
+			return ErrMasternodeAliasExists
+		}
+	}
+	return WriteMasternodeConf(file, append(entries, e))
+}
+
+// RemoveMasternodeConfEntry - Removes the entry with the alias from masternode.conf
+func RemoveMasternodeConfEntry(file, alias string) error {
+	entries, err := ReadMasternodeConf(file)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.Alias == alias {
+			return WriteMasternodeConf(file, append(entries[:i], entries[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no masternode with the alias %v", alias)
+}
+
+func (e MasternodeConfEntry) validate() error {
+	for _, f := range []string{e.Alias, e.Address, e.PrivKey, e.TxHash} {
+		if f == "" || strings.ContainsAny(f, " \t\r\n#") {
+			return fmt.Errorf("masternode %q: fields can't be blank or contain spaces or #", e.Alias)
+		}
+	}
+	if e.OutputIndex < 0 {
+		return fmt.Errorf("masternode %q: invalid collateral output index %d", e.Alias, e.OutputIndex)
+	}
+	return nil
+}
+
+// masternodeCollateralAmounts - Divi has tiers, the others a single collateral amount
+func masternodeCollateralAmounts(pt ProjectType) ([]Amount, error) {
+	coins := func(n int64) Amount { return Amount(n * CSatsPerCoin) }
+	switch pt {
+	case PTDivi:
+		// Copper, silver, gold, platinum and diamond
+		return []Amount{coins(100000), coins(300000), coins(1000000), coins(3000000), coins(10000000)}, nil
+	case PTPhore, PTPIVX:
+		return []Amount{coins(10000)}, nil
+	case PTTrezarcoin:
+		return nil, errMasternodesNotSupported
+	default:
+		return nil, errors.New("unable to determine ProjectType")
+	}
+}
+
+// GetMasternodeCollaterals - Returns the wallet's unspent outputs that can be used as masternode collateral
+func (c *CoinRPCClient) GetMasternodeCollaterals(ctx context.Context) ([]MasternodeCollateralStruct, error) {
+	amounts, err := masternodeCollateralAmounts(c.ProjectType)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []struct {
+		TxHash    string `json:"txhash"`
+		OutputIdx int    `json:"outputidx"`
+	}
+	err = c.Call(ctx, "getmasternodeoutputs", nil, &outputs)
+	if err == nil {
+		collaterals := make([]MasternodeCollateralStruct, 0, len(outputs))
+		for _, o := range outputs {
+			collaterals = append(collaterals, MasternodeCollateralStruct{TxHash: o.TxHash, OutputIndex: o.OutputIdx})
+		}
+		return collaterals, nil
+	}
+	if !IsRPCError(err, cRPCErrMethodNotFound) {
+		return nil, err
+	}
+
+	// Not every daemon has getmasternodeoutputs, so look for unspent outputs of exactly a collateral amount
+	var unspent []struct {
+		TxID          string `json:"txid"`
+		Vout          int    `json:"vout"`
+		Amount        Amount `json:"amount"`
+		Confirmations int64  `json:"confirmations"`
+	}
+	if err := c.Call(ctx, "listunspent", nil, &unspent); err != nil {
+		return nil, err
+	}
+	var collaterals []MasternodeCollateralStruct
+	for _, u := range unspent {
+		for _, a := range amounts {
+			if u.Amount == a {
+				collaterals = append(collaterals, MasternodeCollateralStruct{
+					TxHash:        u.TxID,
+					OutputIndex:   u.Vout,
+					Amount:        u.Amount,
+					Confirmations: u.Confirmations,
+				})
+				break
+			}
+		}
+	}
+	return collaterals, nil
+}
+
+// StartMasternode - Starts the masternode with the alias in masternode.conf. The wallet needs to be unlocked
+func (c *CoinRPCClient) StartMasternode(ctx context.Context, alias string) error {
+	var params []interface{}
+	switch c.ProjectType {
+	case PTDivi:
+		params = []interface{}{alias}
+	case PTPhore, PTPIVX:
+		// Start by alias, without relocking the wallet afterwards
+		params = []interface{}{"alias", false, alias}
+	default:
+		return errMasternodesNotSupported
+	}
+
+	var result map[string]interface{}
+	if err := c.Call(ctx, "startmasternode", params, &result); err != nil {
+		return err
+	}
+	return startMasternodeResultError(alias, result)
+}
+
+// startMasternodeResultError - The daemons report a failed start in the result rather than as an error. PIVX and
+// Phore return a detail entry per alias, Divi a status
+func startMasternodeResultError(alias string, result map[string]interface{}) error {
+	if details, ok := result["detail"].([]interface{}); ok {
+		for _, d := range details {
+			dm, ok := d.(map[string]interface{})
+			if !ok || dm["alias"] != alias {
+				continue
+			}
+			if r, _ := dm["result"].(string); r != "successful" && r != "success" {
+				return fmt.Errorf("unable to start masternode %v: %v", alias, dm["error"])
+			}
+			return nil
+		}
+		return fmt.Errorf("unable to start masternode %v: it's not in %v", alias, CMasternodeConfFile)
+	}
+	for _, k := range []string{"status", "result"} {
+		if s, ok := result[k].(string); ok && strings.Contains(strings.ToLower(s), "fail") {
+			msg := s
+			if e, ok := result["error"].(string); ok && e != "" {
+				msg = e
+			}
+			return fmt.Errorf("unable to start masternode %v: %v", alias, msg)
+		}
+	}
+	return nil
+}
+
+// GetMasternodeStatuses - Returns the network status of each of the entries from masternode.conf
+func (c *CoinRPCClient) GetMasternodeStatuses(ctx context.Context, entries []MasternodeConfEntry) ([]MasternodeStatusStruct, error) {
+	var list []struct {
+		TxHash     string `json:"txhash"`
+		OutIdx     int    `json:"outidx"`
+		Status     string `json:"status"`
+		Addr       string `json:"addr"`
+		LastSeen   int64  `json:"lastseen"`
+		ActiveTime int64  `json:"activetime"`
+		LastPaid   int64  `json:"lastpaid"`
+	}
+	if err := c.Call(ctx, "listmasternodes", nil, &list); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MasternodeStatusStruct, 0, len(entries))
+	for _, e := range entries {
+		ms := MasternodeStatusStruct{
+			Alias:       e.Alias,
+			TxHash:      e.TxHash,
+			OutputIndex: e.OutputIndex,
+			Address:     e.Address,
+			Status:      CMasternodeStatusMissing,
+		}
+		for _, mn := range list {
+			if mn.TxHash != e.TxHash || mn.OutIdx != e.OutputIndex {
+				continue
+			}
+			ms.Status = mn.Status
+			if mn.Addr != "" {
+				ms.Address = mn.Addr
+			}
+			ms.LastSeen = unixTimeOrZero(mn.LastSeen)
+			ms.ActiveTime = time.Duration(mn.ActiveTime) * time.Second
+			ms.LastPaid = unixTimeOrZero(mn.LastPaid)
+			break
+		}
+		statuses = append(statuses, ms)
+	}
+	return statuses, nil
+}
+
+func unixTimeOrZero(t int64) time.Time {
+	if t <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0).UTC()
+}
+
+// MasternodePoller - A WalletEventSource which publishes a WETMasternodeStatus event whenever one of the masternodes
+// in ConfFile changes status. ConfFile is re-read each time, so new entries are picked up
+type MasternodePoller struct {
+	RPC      *CoinRPCClient
+	ConfFile string
+	Interval time.Duration
+
+	statuses map[string]string
+}
+
+// NewMasternodePoller - Returns a poller of the masternodes in confFile, polling every cMasternodePollInterval
+func NewMasternodePoller(rpc *CoinRPCClient, confFile string) *MasternodePoller {
+	return &MasternodePoller{
+		RPC:      rpc,
+		ConfFile: confFile,
+		Interval: cMasternodePollInterval,
+		statuses: make(map[string]string),
+	}
+}
+
+// Run - Polls the masternode statuses until ctx is done
+func (p *MasternodePoller) Run(ctx context.Context, b *EventBroker) error {
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+	for {
+		// A poll failing, e.g. because the daemon is down, is reported by the RPCEventPoller
+		p.poll(ctx, b)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (p *MasternodePoller) poll(ctx context.Context, b *EventBroker) error {
+	entries, err := ReadMasternodeConf(p.ConfFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cServerWalletTimeout)
+	defer cancel()
+	statuses, err := p.RPC.GetMasternodeStatuses(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]string, len(statuses))
+	for _, ms := range statuses {
+		key := ms.TxHash + ":" + strconv.Itoa(ms.OutputIndex)
+		current[key] = ms.Status
+		if prev, ok := p.statuses[key]; ok && prev == ms.Status {
+			continue
+		}
+		b.Publish(WETMasternodeStatus, MasternodeStatusChangeStruct{
+			MasternodeStatusStruct: ms,
+			PreviousStatus:         p.statuses[key],
+		})
+	}
+	p.statuses = current
+	return nil
+}
@@ -0,0 +1,245 @@
+//go:build !windows
+
+package gwcommon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newPathHome - A home folder to edit, with the bin folder in it. The bin folder has a space, so it needs quoting
+func newPathHome(t *testing.T) (string, string) {
+	t.Helper()
+	t.Setenv("ZDOTDIR", "")
+	home := t.TempDir()
+	return home, filepath.Join(home, "box divi")
+}
+
+func readPathFile(t *testing.T, file string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestAddToPath(t *testing.T) {
+	home, bin := newPathHome(t)
+	profile := filepath.Join(home, ".profile")
+	if err := ioutil.WriteFile(profile, []byte("umask 022\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := PathOptions{Home: home, Shell: "/bin/bash"}
+
+	change, err := AddToPath(bin+"/", opts)
+	if err != nil {
+		t.Fatalf("AddToPath() error = %v", err)
+	}
+	if !reflect.DeepEqual(change.FilesChanged, []string{profile}) || change.Shell != "bash" {
+		t.Errorf("AddToPath() = %+v", change)
+	}
+	if !strings.Contains(change.Instructions, ". "+profile) {
+		t.Errorf("Instructions = %q, want them to say how to source %v", change.Instructions, profile)
+	}
+	if got, want := readPathFile(t, profile), "umask 022\n"+pathBlock(bin, false); got != want {
+		t.Errorf(".profile =\n%v\nwant\n%v", got, want)
+	}
+	// The user's own permissions are kept
+	if fi, err := os.Stat(profile); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf(".profile mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// Running it again changes nothing
+	change, err = AddToPath(bin, opts)
+	if err != nil || len(change.FilesChanged) != 0 || change.Instructions != "" {
+		t.Errorf("AddToPath() again = %+v, %v, want no change", change, err)
+	}
+
+	// Sourcing the block twice only adds the folder once
+	out, err := exec.Command("sh", "-c", `. "$1"; . "$1"; echo "$PATH"`, "sh", profile).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), bin); n != 1 {
+		t.Errorf("PATH = %q, has %v %d times, want once", out, bin, n)
+	}
+}
+
+func TestAddToPathShells(t *testing.T) {
+	tests := []struct {
+		shell string
+		file  string
+		fish  bool
+	}{
+		{shell: "/bin/bash", file: ".profile"},
+		{shell: "/usr/bin/zsh", file: ".zprofile"},
+		{shell: "/usr/bin/fish", file: filepath.Join(".config", "fish", "config.fish"), fish: true},
+		{shell: "/bin/dash", file: ".profile"},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.shell), func(t *testing.T) {
+			home, bin := newPathHome(t)
+			change, err := AddToPath(bin, PathOptions{Home: home, Shell: tt.shell})
+			if err != nil {
+				t.Fatalf("AddToPath() error = %v", err)
+			}
+			file := filepath.Join(home, tt.file)
+			if !reflect.DeepEqual(change.FilesChanged, []string{file}) {
+				t.Errorf("FilesChanged = %v, want %v", change.FilesChanged, file)
+			}
+			if got := readPathFile(t, file); got != pathBlock(bin, tt.fish) {
+				t.Errorf("%v =\n%v", tt.file, got)
+			}
+		})
+	}
+}
+
+func TestAddToPathBashProfile(t *testing.T) {
+	home, bin := newPathHome(t)
+	if err := ioutil.WriteFile(filepath.Join(home, ".bash_profile"), []byte(". ~/.bashrc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	change, err := AddToPath(bin, PathOptions{Home: home, Shell: "/bin/bash"})
+	if err != nil {
+		t.Fatalf("AddToPath() error = %v", err)
+	}
+	// bash skips .profile when there's a .bash_profile, so both get the block
+	want := []string{filepath.Join(home, ".profile"), filepath.Join(home, ".bash_profile")}
+	if !reflect.DeepEqual(change.FilesChanged, want) {
+		t.Errorf("FilesChanged = %v, want %v", change.FilesChanged, want)
+	}
+}
+
+func TestRemoveFromPath(t *testing.T) {
+	home, bin := newPathHome(t)
+	profile := filepath.Join(home, ".profile")
+	if err := ioutil.WriteFile(profile, []byte("umask 022\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToPath(bin, PathOptions{Home: home, Shell: "/bin/bash"}); err != nil {
+		t.Fatal(err)
+	}
+	// Switching shells moves the block, and remove finds it whichever shell added it
+	if _, err := AddToPath(bin, PathOptions{Home: home, Shell: "/usr/bin/fish"}); err != nil {
+		t.Fatal(err)
+	}
+	fish := filepath.Join(home, ".config", "fish", "config.fish")
+	if got := readPathFile(t, profile); got != "umask 022\n" {
+		t.Errorf(".profile after switching to fish = %q", got)
+	}
+
+	change, err := RemoveFromPath(bin, PathOptions{Home: home, Shell: "/bin/bash"})
+	if err != nil {
+		t.Fatalf("RemoveFromPath() error = %v", err)
+	}
+	if !reflect.DeepEqual(change.FilesChanged, []string{fish}) || change.Instructions == "" {
+		t.Errorf("RemoveFromPath() = %+v", change)
+	}
+	if got := readPathFile(t, fish); got != "" {
+		t.Errorf("config.fish = %q, want it empty", got)
+	}
+
+	// Nothing's left to remove, and no files are created
+	change, err = RemoveFromPath(bin, PathOptions{Home: home})
+	if err != nil || len(change.FilesChanged) != 0 {
+		t.Errorf("RemoveFromPath() again = %+v, %v, want no change", change, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".zprofile")); !os.IsNotExist(err) {
+		t.Errorf(".zprofile was created: %v", err)
+	}
+}
+
+func TestPathLegacyLine(t *testing.T) {
+	home, bin := newPathHome(t)
+	profile := filepath.Join(home, ".profile")
+	// The lines the old AddProjectPath added, with and without the trailing slash, and one for another folder
+	other := cGoDiviExportPath + filepath.Join(home, "other")
+	legacy := "umask 022\n" + cGoDiviExportPath + bin + "/\n" + other + "\n  " + cGoDiviExportPath + bin + "\nalias ll='ls -l'"
+	if err := ioutil.WriteFile(profile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AddToPath(bin, PathOptions{Home: home, Shell: "/bin/bash"}); err != nil {
+		t.Fatalf("AddToPath() error = %v", err)
+	}
+	want := "umask 022\n" + other + "\nalias ll='ls -l'\n" + pathBlock(bin, false)
+	if got := readPathFile(t, profile); got != want {
+		t.Errorf(".profile =\n%v\nwant\n%v", got, want)
+	}
+
+	if err := ioutil.WriteFile(profile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RemoveFromPath(bin, PathOptions{Home: home}); err != nil {
+		t.Fatalf("RemoveFromPath() error = %v", err)
+	}
+	if got, want := readPathFile(t, profile), "umask 022\n"+other+"\nalias ll='ls -l'"; got != want {
+		t.Errorf(".profile = %q, want %q", got, want)
+	}
+}
+
+func TestPathSymlinkedRCFile(t *testing.T) {
+	home, bin := newPathHome(t)
+	// Kept in a dotfiles repo, with a relative link
+	dotfiles := filepath.Join(home, "dotfiles")
+	if err := os.Mkdir(dotfiles, 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dotfiles, "profile")
+	if err := ioutil.WriteFile(target, []byte("umask 022\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile := filepath.Join(home, ".profile")
+	if err := os.Symlink(filepath.Join("dotfiles", "profile"), profile); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := AddToPath(bin, PathOptions{Home: home, Shell: "/bin/bash"})
+	if err != nil {
+		t.Fatalf("AddToPath() error = %v", err)
+	}
+	if !reflect.DeepEqual(change.FilesChanged, []string{profile}) {
+		t.Errorf("FilesChanged = %v, want %v", change.FilesChanged, profile)
+	}
+	if fi, err := os.Lstat(profile); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf(".profile is no longer a symlink: %v", err)
+	}
+	if got := readPathFile(t, target); got != "umask 022\n"+pathBlock(bin, false) {
+		t.Errorf("the link's target =\n%v", got)
+	}
+
+	if _, err := RemoveFromPath(bin, PathOptions{Home: home}); err != nil {
+		t.Fatalf("RemoveFromPath() error = %v", err)
+	}
+	if fi, err := os.Lstat(profile); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf(".profile is no longer a symlink: %v", err)
+	}
+	if got := readPathFile(t, target); got != "umask 022\n" {
+		t.Errorf("the link's target = %q", got)
+	}
+}
+
+func TestPathDanglingSymlink(t *testing.T) {
+	home, bin := newPathHome(t)
+	profile := filepath.Join(home, ".profile")
+	if err := os.Symlink(filepath.Join(home, "no-such-file"), profile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToPath(bin, PathOptions{Home: home, Shell: "/bin/bash"}); err == nil {
+		t.Error("AddToPath() through a dangling symlink should fail")
+	}
+	if _, err := RemoveFromPath(bin, PathOptions{Home: home}); err != nil {
+		t.Errorf("RemoveFromPath() error = %v, a dangling symlink has nothing to remove", err)
+	}
+	if fi, err := os.Lstat(profile); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf(".profile was replaced: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package gwcommon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	cPathBlockBegin = "# >>> gwcommon PATH "
+	cPathBlockEnd   = "# <<< gwcommon PATH "
+)
+
+// PathOptions - Whose shell config is edited. Both default to the current user's
+type PathOptions struct {
+	Home  string
+	Shell string // The login shell e.g. /bin/zsh, defaults to $SHELL
+}
+
+// PathChangeStruct - What AddToPath or RemoveFromPath changed, and what the user needs to do for it to take effect
+type PathChangeStruct struct {
+	Shell        string
+	FilesChanged []string
+	Instructions string
+}
+
+// AddToPath - Adds binFolder to the PATH in the login shell's startup files, inside a marked block that RemoveFromPath
+// can take out again. Running it again changes nothing. The current shell isn't affected, so the instructions say
+// how to pick up the change
+func AddToPath(binFolder string, opts PathOptions) (PathChangeStruct, error) {
+	return updatePath(binFolder, opts, true)
+}
+
+// RemoveFromPath - Removes binFolder's block from all of the shell startup files, whichever shell added it, along
+// with the line the old AddProjectPath added
+func RemoveFromPath(binFolder string, opts PathOptions) (PathChangeStruct, error) {
+	return updatePath(binFolder, opts, false)
+}
+
+func updatePath(binFolder string, opts PathOptions, add bool) (PathChangeStruct, error) {
+	binFolder = strings.TrimRight(binFolder, "/")
+	if binFolder == "" {
+		return PathChangeStruct{}, fmt.Errorf("no folder to add to the PATH")
+	}
+	if runtime.GOOS == "windows" {
+		return PathChangeStruct{
+			Instructions: fmt.Sprintf("Please add %v to your PATH in System Properties > Environment Variables", binFolder),
+		}, nil
+	}
+
+	home := opts.Home
+	if home == "" {
+		u, err := user.Current()
+		if err != nil {
+			return PathChangeStruct{}, err
+		}
+		home = u.HomeDir
+	}
+	shell := opts.Shell
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	shell = filepath.Base(shell)
+	change := PathChangeStruct{Shell: shell}
+
+	targets := pathRCFiles(home, shell)
+	for _, f := range allPathRCFiles(home) {
+		block := ""
+		if add && containsString(targets, f) {
+			block = pathBlock(binFolder, strings.HasSuffix(f, ".fish"))
+		}
+		changed, err := editPathBlock(f, binFolder, block)
+		if err != nil {
+			return change, err
+		}
+		if changed {
+			change.FilesChanged = append(change.FilesChanged, f)
+		}
+	}
+
+	if len(change.FilesChanged) > 0 {
+		change.Instructions = pathInstructions(targets, shell, add)
+	}
+	return change, nil
+}
+
+// pathRCFiles - The files the shell reads at login, which get the PATH block
+func pathRCFiles(home, shell string) []string {
+	switch shell {
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return []string{filepath.Join(dir, ".zprofile")}
+	case "fish":
+		return []string{filepath.Join(home, ".config", "fish", "config.fish")}
+	case "bash":
+		// bash only reads .profile if there's no .bash_profile, but the desktop session reads .profile either way
+		files := []string{filepath.Join(home, ".profile")}
+		if FileExists(filepath.Join(home, ".bash_profile")) {
+			files = append(files, filepath.Join(home, ".bash_profile"))
+		}
+		return files
+	}
+	return []string{filepath.Join(home, ".profile")}
+}
+
+// allPathRCFiles - Every file a block may have been added to, so switching shells doesn't leave one behind
+func allPathRCFiles(home string) []string {
+	zdir := os.Getenv("ZDOTDIR")
+	if zdir == "" {
+		zdir = home
+	}
+	return []string{
+		filepath.Join(home, ".profile"),
+		filepath.Join(home, ".bash_profile"),
+		filepath.Join(zdir, ".zprofile"),
+		filepath.Join(home, ".config", "fish", "config.fish"),
+	}
+}
+
+func pathBlock(binFolder string, fish bool) string {
+	var sb strings.Builder
+	sb.WriteString(cPathBlockBegin + binFolder + " >>>\n")
+	if fish {
+		q := fishQuote(binFolder)
+		fmt.Fprintf(&sb, "if not contains -- %s $PATH\n    set -gx PATH $PATH %s\nend\n", q, q)
+	} else {
+		q := shellDoubleQuote(binFolder)
+		fmt.Fprintf(&sb, "case \":$PATH:\" in\n    *:%s:*) ;;\n    *) export PATH=\"$PATH:\"%s ;;\nesac\n", q, q)
+	}
+	sb.WriteString(cPathBlockEnd + binFolder + " <<<\n")
+	return sb.String()
+}
+
+// editPathBlock - Takes out binFolder's block and the old AddProjectPath line from file, then appends block if it
+// isn't blank. The file is only written if it changes, and only created if there's a block to add
+func editPathBlock(file, binFolder, block string) (bool, error) {
+	// Edit what a symlinked file points to, e.g. in a dotfiles repo, rather than replacing the link with a copy
+	if fi, err := os.Lstat(file); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(file)
+		if err != nil {
+			if block == "" {
+				return false, nil
+			}
+			return false, fmt.Errorf("unable to follow %v: %v", file, err)
+		}
+		file = target
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	exists := err == nil
+	if !exists && block == "" {
+		return false, nil
+	}
+	orig := string(b)
+
+	begin := cPathBlockBegin + binFolder + " >>>"
+	end := cPathBlockEnd + binFolder + " <<<"
+	legacy := map[string]bool{
+		cGoDiviExportPath + binFolder:       true,
+		cGoDiviExportPath + binFolder + "/": true,
+	}
+	var kept []string
+	inBlock := false
+	for _, line := range strings.SplitAfter(orig, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case trimmed == begin:
+			inBlock = true
+		case inBlock:
+			if trimmed == end {
+				inBlock = false
+			}
+		case legacy[trimmed]:
+		default:
+			kept = append(kept, line)
+		}
+	}
+	out := strings.Join(kept, "")
+	if block != "" {
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		out += block
+	}
+	if out == orig {
+		return false, nil
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+"-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(out); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), file)
+}
+
+func pathInstructions(targets []string, shell string, add bool) string {
+	if !add {
+		return "The folder will be left out of your PATH from your next login"
+	}
+	source := "."
+	if shell == "fish" {
+		source = "source"
+	}
+	return fmt.Sprintf("Your PATH has been updated for new logins. To use it in this terminal, run: %s %s", source, targets[0])
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// shellDoubleQuote - Quotes s for sh inside double quotes, so it can sit next to $PATH
+func shellDoubleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s) + `"`
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -1,7 +1,10 @@
 package gwcommon
 
 const (
-	cCoinNamePhore string = "Phore"
+	cCoinNamePhore    string = "Phore"
+	cCoinTickerPhore  string = "PHR"
+	cCoinGeckoIDPhore string = "phore"
+	cChainSizeMBPhore int    = 3000
 
 	// Phore Wallet Constants
 	CPhoreAppVersion string = "1.6.5"
@@ -28,11 +31,17 @@ const (
 	CPhoreDFileWin   string = "phored.exe"
 	CPhoreTxFile     string = "phore-tx"
 	CPhoreTxFileWin  string = "phore-tx.exe"
+	CPhoreRPCPort    string = "11772"
+	CPhoreP2PPort    string = "11771"
 
 	// Phore public download files
 	CDFPhoreFileRPi     string = "phore-1.6.5-arm-linux-gnueabihf.tar.gz"
 	CDFPhoreFileLinux   string = "phore-1.6.5-x86_64-linux-gnu.tar.gz"
 	CDFPhoreFileWindows string = "phore-1.6.5-win64.zip"
+	CDFPhoreSumsFile    string = "SHA256SUMS.asc"
+
+	// CDownloadURLPhore - Where the upstream Phore release files are downloaded from
+	CDownloadURLPhore string = "https://github.com/phoreproject/Phore/releases/download/v" + CPhoreAppVersion + "/"
 
 	// CAppCLIFileGoDivi - Only to be used by GoDeploy
 	CAppCLIFileBoxPhore             string = "boxphore"
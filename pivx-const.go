@@ -1,7 +1,10 @@
 package gwcommon
 
 const (
-	cCoinNamePIVX string = "PIVX"
+	cCoinNamePIVX    string = "PIVX"
+	cCoinTickerPIVX  string = "PIVX"
+	cCoinGeckoIDPIVX string = "pivx"
+	cChainSizeMBPIVX int    = 12000
 
 	// PIVX Wallet Constants
 	CPIVXAppVersion string = "4.2.0"
@@ -28,6 +31,8 @@ const (
 	CPIVXDFileWin   string = "pivxd.exe"
 	CPIVXTxFile     string = "pivx-tx"
 	CPIVXTxFileWin  string = "pivx-tx.exe"
+	CPIVXRPCPort    string = "51473"
+	CPIVXP2PPort    string = "51472"
 
 	// CAppCLIFileGoDivi - Only to be used by GoDeploy
 	CAppCLIFileBoxPIVX            string = "boxpivx"
@@ -0,0 +1,256 @@
+package gwcommon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CProcRoot - Where the Linux proc filesystem is mounted
+	CProcRoot string = "/proc"
+
+	// cDiskHeadroomPct - Free space below the chain size plus this much growth only warns
+	cDiskHeadroomPct int = 50
+)
+
+// PreflightResult - The outcome of a preflight check
+type PreflightResult int
+
+const (
+	// PRPass - The check passed
+	PRPass PreflightResult = iota
+	// PRWarn - The install can go ahead, but may run into trouble
+	PRWarn
+	// PRFail - The install shouldn't go ahead until this is fixed
+	PRFail
+)
+
+// PreflightOptions - Where the preflight checks look
+type PreflightOptions struct {
+	ProcRoot   string // Defaults to CProcRoot, tests can point it at a fake tree
+	HomeFolder string // The coin's home folder, which needn't exist yet, see GetCoinHomeFolder
+}
+
+// PreflightCheckStruct - The result of one check
+type PreflightCheckStruct struct {
+	Name    string
+	Result  PreflightResult
+	Message string
+}
+
+// PreflightReportStruct - The results of all of the checks
+type PreflightReportStruct struct {
+	Checks []PreflightCheckStruct
+}
+
+// MemInfoStruct - The memory and swap sizes from /proc/meminfo, in MB
+type MemInfoStruct struct {
+	MemTotalMB     int
+	MemAvailableMB int
+	SwapTotalMB    int
+	SwapFreeMB     int
+}
+
+// String - pass, warn or fail
+func (r PreflightResult) String() string {
+	switch r {
+	case PRPass:
+		return "pass"
+	case PRWarn:
+		return "warn"
+	case PRFail:
+		return "fail"
+	}
+	return "unknown"
+}
+
+// Result - The worst result of any of the checks
+func (r PreflightReportStruct) Result() PreflightResult {
+	worst := PRPass
+	for _, c := range r.Checks {
+		if c.Result > worst {
+			worst = c.Result
+		}
+	}
+	return worst
+}
+
+// String - One line per check, for showing to the user
+func (r PreflightReportStruct) String() string {
+	var sb strings.Builder
+	for _, c := range r.Checks {
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", strings.ToUpper(c.Result.String()), c.Name, c.Message)
+	}
+	return sb.String()
+}
+
+func (r *PreflightReportStruct) add(name string, result PreflightResult, format string, a ...interface{}) {
+	r.Checks = append(r.Checks, PreflightCheckStruct{Name: name, Result: result, Message: fmt.Sprintf(format, a...)})
+}
+
+// ReadMemInfo - Reads the memory and swap sizes from meminfo under procRoot, or CProcRoot if blank
+func ReadMemInfo(procRoot string) (MemInfoStruct, error) {
+	var mi MemInfoStruct
+	if procRoot == "" {
+		procRoot = CProcRoot
+	}
+	f, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return mi, err
+	}
+	defer f.Close()
+
+	fields := map[string]*int{
+		"MemTotal":     &mi.MemTotalMB,
+		"MemAvailable": &mi.MemAvailableMB,
+		"SwapTotal":    &mi.SwapTotalMB,
+		"SwapFree":     &mi.SwapFreeMB,
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// e.g. "MemTotal:        3930160 kB"
+		parts := strings.Fields(s.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		p, ok := fields[strings.TrimSuffix(parts[0], ":")]
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return mi, fmt.Errorf("unable to read meminfo %v: %v", parts[0], err)
+		}
+		*p = int(kb / 1024)
+	}
+	if err := s.Err(); err != nil {
+		return mi, err
+	}
+	if mi.MemTotalMB == 0 {
+		return mi, errors.New("unable to find MemTotal in meminfo")
+	}
+	return mi, nil
+}
+
+// GetCoinChainSizeMB - Returns a rough estimate of the disk space the coin's blockchain needs
+func GetCoinChainSizeMB(pt ProjectType) (int, error) {
+	switch pt {
+	case PTDivi:
+		return cChainSizeMBDivi, nil
+	case PTPhore:
+		return cChainSizeMBPhore, nil
+	case PTPIVX:
+		return cChainSizeMBPIVX, nil
+	case PTTrezarcoin:
+		return cChainSizeMBTrezarcoin, nil
+	default:
+		return 0, errors.New("unable to determine ProjectType")
+	}
+}
+
+// RunPreflightChecks - Checks the machine has the memory, swap, disk space and free ports needed to run the coin
+// daemon, before it's installed
+func RunPreflightChecks(pt ProjectType, opts PreflightOptions) (PreflightReportStruct, error) {
+	var r PreflightReportStruct
+	chainMB, err := GetCoinChainSizeMB(pt)
+	if err != nil {
+		return r, err
+	}
+	rpcPort, err := GetCoinRPCPort(pt)
+	if err != nil {
+		return r, err
+	}
+	p2pPort, err := GetCoinP2PPort(pt)
+	if err != nil {
+		return r, err
+	}
+
+	checkMemory(&r, opts.ProcRoot)
+	checkDiskSpace(&r, opts.HomeFolder, chainMB)
+	checkPortFree(&r, "RPC port", "127.0.0.1:"+rpcPort)
+	checkPortFree(&r, "P2P port", ":"+p2pPort)
+	return r, nil
+}
+
+func checkMemory(r *PreflightReportStruct, procRoot string) {
+	mi, err := ReadMemInfo(procRoot)
+	if err != nil {
+		// Only Linux has /proc/meminfo
+		if runtime.GOOS != "linux" && procRoot == "" {
+			r.add("Memory", PRWarn, "unable to check on %v", runtime.GOOS)
+			return
+		}
+		r.add("Memory", PRWarn, "unable to check: %v", err)
+		return
+	}
+
+	lowMem := mi.MemTotalMB < CMinRequiredMemoryMB
+	switch {
+	case !lowMem:
+		r.add("Memory", PRPass, "%d MB, %d MB needed", mi.MemTotalMB, CMinRequiredMemoryMB)
+	case mi.MemTotalMB+mi.SwapTotalMB >= CMinRequiredMemoryMB:
+		r.add("Memory", PRWarn, "%d MB, %d MB needed, so the daemon will rely on swap", mi.MemTotalMB, CMinRequiredMemoryMB)
+	default:
+		r.add("Memory", PRFail, "%d MB, %d MB needed", mi.MemTotalMB, CMinRequiredMemoryMB)
+	}
+
+	switch {
+	case mi.SwapTotalMB >= CMinRequiredSwapMB:
+		r.add("Swap", PRPass, "%d MB, %d MB needed", mi.SwapTotalMB, CMinRequiredSwapMB)
+	case lowMem:
+		r.add("Swap", PRFail, "%d MB, %d MB needed with this little memory", mi.SwapTotalMB, CMinRequiredSwapMB)
+	default:
+		r.add("Swap", PRWarn, "%d MB, %d MB recommended", mi.SwapTotalMB, CMinRequiredSwapMB)
+	}
+}
+
+func checkDiskSpace(r *PreflightReportStruct, home string, chainMB int) {
+	if home == "" {
+		r.add("Disk space", PRWarn, "unable to check, no home folder was given")
+		return
+	}
+	// The home folder is usually created by the install, so check the nearest folder that exists
+	dir := filepath.Clean(home)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	free, err := diskFreeBytes(dir)
+	if err != nil {
+		r.add("Disk space", PRWarn, "unable to check %v: %v", dir, err)
+		return
+	}
+	freeMB := int(free / (1024 * 1024))
+	switch {
+	case freeMB < chainMB:
+		r.add("Disk space", PRFail, "%d MB free on %v, the blockchain needs about %d MB", freeMB, dir, chainMB)
+	case freeMB < chainMB*(100+cDiskHeadroomPct)/100:
+		r.add("Disk space", PRWarn, "%d MB free on %v, the blockchain needs about %d MB and is growing", freeMB, dir, chainMB)
+	default:
+		r.add("Disk space", PRPass, "%d MB free on %v, the blockchain needs about %d MB", freeMB, dir, chainMB)
+	}
+}
+
+func checkPortFree(r *PreflightReportStruct, name, addr string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.add(name, PRFail, "%v is in use, is the daemon already running? %v", addr, err)
+		return
+	}
+	l.Close()
+	r.add(name, PRPass, "%v is free", addr)
+}
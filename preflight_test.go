@@ -0,0 +1,173 @@
+package gwcommon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMemInfo - Returns a fake proc tree holding meminfo
+func writeMemInfo(t *testing.T, meminfo string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "meminfo"), []byte(meminfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// testMemInfo - A meminfo with the sizes given in MB, laid out as Linux does
+func testMemInfo(memMB, swapMB int) string {
+	return fmt.Sprintf("MemTotal:       %8d kB\nMemFree:          123456 kB\nMemAvailable:   %8d kB\nBuffers:           10240 kB\n"+
+		"SwapCached:            0 kB\nSwapTotal:      %8d kB\nSwapFree:       %8d kB\nHugePages_Total:       0\n",
+		memMB*1024, memMB*512, swapMB*1024, swapMB*1024)
+}
+
+func TestReadMemInfo(t *testing.T) {
+	root := writeMemInfo(t, testMemInfo(3838, 2047))
+	got, err := ReadMemInfo(root)
+	if err != nil {
+		t.Fatalf("ReadMemInfo() error = %v", err)
+	}
+	want := MemInfoStruct{MemTotalMB: 3838, MemAvailableMB: 1919, SwapTotalMB: 2047, SwapFreeMB: 2047}
+	if got != want {
+		t.Errorf("ReadMemInfo() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadMemInfoErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		meminfo string
+		wantErr string
+	}{
+		{
+			name:    "missing MemTotal",
+			meminfo: "MemFree:          123456 kB\nSwapTotal:       2097152 kB\n",
+			wantErr: "MemTotal",
+		},
+		{
+			name:    "malformed value",
+			meminfo: "MemTotal:       lots kB\nSwapTotal:       2097152 kB\n",
+			wantErr: "MemTotal",
+		},
+		{
+			name:    "empty",
+			wantErr: "MemTotal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadMemInfo(writeMemInfo(t, tt.meminfo))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadMemInfo() error = %v, want one mentioning %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ReadMemInfo(t.TempDir()); err == nil {
+		t.Error("ReadMemInfo() with no meminfo should fail")
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	tests := []struct {
+		name     string
+		memMB    int
+		swapMB   int
+		wantMem  PreflightResult
+		wantSwap PreflightResult
+	}{
+		{name: "plenty", memMB: 4096, swapMB: CMinRequiredSwapMB, wantMem: PRPass, wantSwap: PRPass},
+		{name: "no swap", memMB: 4096, swapMB: 0, wantMem: PRPass, wantSwap: PRWarn},
+		{name: "just enough memory", memMB: CMinRequiredMemoryMB, swapMB: 512, wantMem: PRPass, wantSwap: PRWarn},
+		{name: "low memory with swap", memMB: 512, swapMB: CMinRequiredSwapMB, wantMem: PRWarn, wantSwap: PRPass},
+		{name: "low memory with some swap", memMB: 512, swapMB: 512, wantMem: PRWarn, wantSwap: PRFail},
+		{name: "low memory without swap", memMB: 512, swapMB: 0, wantMem: PRFail, wantSwap: PRFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r PreflightReportStruct
+			checkMemory(&r, writeMemInfo(t, testMemInfo(tt.memMB, tt.swapMB)))
+			var got []string
+			for _, c := range r.Checks {
+				got = append(got, c.Name+" "+c.Result.String())
+			}
+			want := []string{"Memory " + tt.wantMem.String(), "Swap " + tt.wantSwap.String()}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("checkMemory() = %v, want %v\n%v", got, want, r)
+			}
+		})
+	}
+}
+
+func TestCheckMemoryUnreadable(t *testing.T) {
+	for _, meminfo := range []string{"MemFree: 123456 kB\n", "MemTotal: 3.5 GB\n"} {
+		var r PreflightReportStruct
+		checkMemory(&r, writeMemInfo(t, meminfo))
+		// Neither pass nor fail, as it's not known
+		if len(r.Checks) != 1 || r.Checks[0].Name != "Memory" || r.Checks[0].Result != PRWarn {
+			t.Errorf("checkMemory(%q) = %v, want one warning", meminfo, r)
+		}
+	}
+}
+
+func TestCheckPortFree(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+
+	var r PreflightReportStruct
+	checkPortFree(&r, "RPC port", addr)
+	if len(r.Checks) != 1 || r.Checks[0].Result != PRFail || !strings.Contains(r.Checks[0].Message, "in use") {
+		t.Errorf("checkPortFree() with the port in use = %v, want a fail", r)
+	}
+
+	l.Close()
+	r = PreflightReportStruct{}
+	checkPortFree(&r, "RPC port", addr)
+	if len(r.Checks) != 1 || r.Checks[0].Result != PRPass {
+		t.Errorf("checkPortFree() with the port free = %v, want a pass", r)
+	}
+}
+
+func TestPreflightReportResult(t *testing.T) {
+	var r PreflightReportStruct
+	if r.Result() != PRPass {
+		t.Errorf("Result() with no checks = %v, want pass", r.Result())
+	}
+	r.add("a", PRPass, "")
+	r.add("b", PRFail, "")
+	r.add("c", PRWarn, "")
+	if r.Result() != PRFail {
+		t.Errorf("Result() = %v, want the worst, fail", r.Result())
+	}
+	if got := r.String(); !strings.Contains(got, "[FAIL] b: \n") {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestRunPreflightChecks(t *testing.T) {
+	root := writeMemInfo(t, testMemInfo(512, 0))
+	r, err := RunPreflightChecks(PTPhore, PreflightOptions{ProcRoot: root, HomeFolder: filepath.Join(root, "no", "such", ".phore")})
+	if err != nil {
+		t.Fatalf("RunPreflightChecks() error = %v", err)
+	}
+	var names []string
+	for _, c := range r.Checks {
+		names = append(names, c.Name)
+	}
+	want := []string{"Memory", "Swap", "Disk space", "RPC port", "P2P port"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("checks = %v, want %v", names, want)
+	}
+	if r.Result() != PRFail {
+		t.Errorf("Result() = %v, want fail with too little memory", r.Result())
+	}
+}
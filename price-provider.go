@@ -0,0 +1,329 @@
+package gwcommon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CCoinGeckoAPIURL - The public CoinGecko API used by HTTPPriceProvider
+	CCoinGeckoAPIURL string = "https://api.coingecko.com/api/v3"
+
+	cPriceFetchTimeout      = 15 * time.Second
+	cPriceCacheTTL          = 5 * time.Minute
+	cPriceCacheStaleTTL     = time.Hour
+	cPriceHistoryDateFormat = "02-01-2006"
+	cPriceHistoryDayFormat  = "2006-01-02"
+)
+
+var (
+	// ErrPriceCoinNotRegistered - There's no price API ID registered for the coin
+	ErrPriceCoinNotRegistered = errors.New("no price is available for this coin")
+	// ErrPriceUnavailable - The provider has no price for the coin in the currency
+	ErrPriceUnavailable = errors.New("price unavailable")
+)
+
+// PriceProvider - Returns the value of one coin in a fiat currency e.g. USD
+type PriceProvider interface {
+	Price(ctx context.Context, pt ProjectType, currency string) (float64, error)
+}
+
+var (
+	priceCoinIDsMu sync.RWMutex
+	priceCoinIDs   = map[ProjectType]string{
+		PTDivi:       cCoinGeckoIDDivi,
+		PTPhore:      cCoinGeckoIDPhore,
+		PTPIVX:       cCoinGeckoIDPIVX,
+		PTTrezarcoin: cCoinGeckoIDTrezarcoin,
+	}
+)
+
+// RegisterPriceCoin - Sets the CoinGecko API ID used to look up the price of the coin e.g. "divi"
+func RegisterPriceCoin(pt ProjectType, apiID string) {
+	priceCoinIDsMu.Lock()
+	defer priceCoinIDsMu.Unlock()
+	priceCoinIDs[pt] = apiID
+}
+
+// PriceCoins - Returns the coins with a registered price API ID
+func PriceCoins() []ProjectType {
+	priceCoinIDsMu.RLock()
+	defer priceCoinIDsMu.RUnlock()
+	var pts []ProjectType
+	for pt := range priceCoinIDs {
+		pts = append(pts, pt)
+	}
+	return pts
+}
+
+func priceCoinID(pt ProjectType) (string, error) {
+	priceCoinIDsMu.RLock()
+	defer priceCoinIDsMu.RUnlock()
+	id, ok := priceCoinIDs[pt]
+	if !ok {
+		return "", ErrPriceCoinNotRegistered
+	}
+	return id, nil
+}
+
+// GetPrices - Returns the rate of every registered coin in the currency, leaving out any the provider can't price
+func GetPrices(ctx context.Context, p PriceProvider, currency string) map[ProjectType]float64 {
+	prices := make(map[ProjectType]float64)
+	for _, pt := range PriceCoins() {
+		if rate, err := p.Price(ctx, pt, currency); err == nil {
+			prices[pt] = rate
+		}
+	}
+	return prices
+}
+
+// GetConfPrice - Returns the rate of the CLI config coin in its Currency, which defaults to USD
+func GetConfPrice(ctx context.Context, p PriceProvider, cs CLIConfStruct) (float64, error) {
+	currency := cs.Currency
+	if currency == "" {
+		currency = cDefaultCurrency
+	}
+	return p.Price(ctx, cs.ProjectType, currency)
+}
+
+// HTTPPriceProvider - Gets prices from the CoinGecko API. It's also a FiatRateSource, using CoinGecko's daily history
+type HTTPPriceProvider struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	history map[string]float64
+}
+
+// NewHTTPPriceProvider - Returns a provider using CCoinGeckoAPIURL
+func NewHTTPPriceProvider() *HTTPPriceProvider {
+	return &HTTPPriceProvider{
+		BaseURL:    CCoinGeckoAPIURL,
+		HTTPClient: &http.Client{Timeout: cPriceFetchTimeout},
+	}
+}
+
+// Price - Returns the current rate
+func (h *HTTPPriceProvider) Price(ctx context.Context, pt ProjectType, currency string) (float64, error) {
+	id, err := priceCoinID(pt)
+	if err != nil {
+		return 0, err
+	}
+	currency = strings.ToLower(currency)
+
+	q := url.Values{}
+	q.Set("ids", id)
+	q.Set("vs_currencies", currency)
+	var resp map[string]map[string]float64
+	if err := h.get(ctx, "/simple/price?"+q.Encode(), &resp); err != nil {
+		return 0, err
+	}
+	rate, ok := resp[id][currency]
+	if !ok {
+		return 0, ErrPriceUnavailable
+	}
+	return rate, nil
+}
+
+// FiatRate - Returns the rate on the day of at. Past days don't change, so they're only fetched once
+func (h *HTTPPriceProvider) FiatRate(ctx context.Context, pt ProjectType, currency string, at time.Time) (float64, error) {
+	id, err := priceCoinID(pt)
+	if err != nil {
+		return 0, err
+	}
+	currency = strings.ToLower(currency)
+	day := at.UTC()
+	key := id + "/" + currency + "/" + day.Format(cPriceHistoryDayFormat)
+	today := day.Format(cPriceHistoryDayFormat) == time.Now().UTC().Format(cPriceHistoryDayFormat)
+
+	h.mu.Lock()
+	rate, ok := h.history[key]
+	h.mu.Unlock()
+	if ok {
+		return rate, nil
+	}
+
+	q := url.Values{}
+	q.Set("date", day.Format(cPriceHistoryDateFormat))
+	q.Set("localization", "false")
+	var resp struct {
+		MarketData struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	if err := h.get(ctx, "/coins/"+url.PathEscape(id)+"/history?"+q.Encode(), &resp); err != nil {
+		return 0, err
+	}
+	rate, ok = resp.MarketData.CurrentPrice[currency]
+	if !ok {
+		return 0, ErrPriceUnavailable
+	}
+
+	// Today's price is still moving, so isn't worth keeping
+	if !today {
+		h.mu.Lock()
+		if h.history == nil {
+			h.history = make(map[string]float64)
+		}
+		h.history[key] = rate
+		h.mu.Unlock()
+	}
+	return rate, nil
+}
+
+func (h *HTTPPriceProvider) get(ctx context.Context, path string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, h.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to get price: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to get price: %v", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("unable to decode price: %v", err)
+	}
+	return nil
+}
+
+type cachedPrice struct {
+	rate       float64
+	fetched    time.Time
+	refreshing bool
+}
+
+// CachedPriceProvider - Caches the prices of Provider for TTL. For StaleTTL after that, the old price is returned
+// straight away while a fresh one is fetched in the background, or if fetching fails
+type CachedPriceProvider struct {
+	Provider PriceProvider
+	TTL      time.Duration
+	StaleTTL time.Duration
+
+	mu     sync.Mutex
+	prices map[string]*cachedPrice
+	now    func() time.Time
+}
+
+// NewCachedPriceProvider - Returns a cache in front of p, using cPriceCacheTTL and cPriceCacheStaleTTL
+func NewCachedPriceProvider(p PriceProvider) *CachedPriceProvider {
+	return &CachedPriceProvider{
+		Provider: p,
+		TTL:      cPriceCacheTTL,
+		StaleTTL: cPriceCacheStaleTTL,
+		prices:   make(map[string]*cachedPrice),
+		now:      time.Now,
+	}
+}
+
+// Price - Returns the cached rate if fresh enough, otherwise fetches it
+func (c *CachedPriceProvider) Price(ctx context.Context, pt ProjectType, currency string) (float64, error) {
+	key := fmt.Sprintf("%v/%v", pt, strings.ToLower(currency))
+
+	c.mu.Lock()
+	if c.prices == nil {
+		c.prices = make(map[string]*cachedPrice)
+		c.now = time.Now
+	}
+	cp, ok := c.prices[key]
+	if ok {
+		age := c.now().Sub(cp.fetched)
+		if age < c.TTL {
+			c.mu.Unlock()
+			return cp.rate, nil
+		}
+		if age < c.TTL+c.StaleTTL {
+			if !cp.refreshing {
+				cp.refreshing = true
+				go c.refresh(key, pt, currency)
+			}
+			c.mu.Unlock()
+			return cp.rate, nil
+		}
+	}
+	c.mu.Unlock()
+
+	rate, err := c.Provider.Price(ctx, pt, currency)
+	if err != nil {
+		return 0, err
+	}
+	c.store(key, rate)
+	return rate, nil
+}
+
+func (c *CachedPriceProvider) refresh(key string, pt ProjectType, currency string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cPriceFetchTimeout)
+	defer cancel()
+
+	rate, err := c.Provider.Price(ctx, pt, currency)
+	if err != nil {
+		// Keep serving the stale price until it expires
+		c.mu.Lock()
+		if cp, ok := c.prices[key]; ok {
+			cp.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, rate)
+}
+
+func (c *CachedPriceProvider) store(key string, rate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prices[key] = &cachedPrice{rate: rate, fetched: c.now()}
+}
+
+// FallbackPriceProvider - Tries each provider in turn, returning the first price found
+type FallbackPriceProvider []PriceProvider
+
+// Price - Returns the first provider's rate that doesn't fail
+func (f FallbackPriceProvider) Price(ctx context.Context, pt ProjectType, currency string) (float64, error) {
+	var errs []string
+	for _, p := range f {
+		rate, err := p.Price(ctx, pt, currency)
+		if err == nil {
+			return rate, nil
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return 0, ErrPriceUnavailable
+	}
+	return 0, fmt.Errorf("%w: %v", ErrPriceUnavailable, strings.Join(errs, "; "))
+}
+
+// FixedPriceProvider - Returns fixed rates, keyed by coin then upper case currency, e.g. for tests or when offline.
+// It's also a FiatRateSource, returning the same rates for any time
+type FixedPriceProvider map[ProjectType]map[string]float64
+
+// Price - Returns the fixed rate
+func (f FixedPriceProvider) Price(ctx context.Context, pt ProjectType, currency string) (float64, error) {
+	rate, ok := f[pt][strings.ToUpper(currency)]
+	if !ok {
+		return 0, ErrPriceUnavailable
+	}
+	return rate, nil
+}
+
+// FiatRate - Returns the fixed rate, whatever the time
+func (f FixedPriceProvider) FiatRate(ctx context.Context, pt ProjectType, currency string, at time.Time) (float64, error) {
+	return f.Price(ctx, pt, currency)
+}
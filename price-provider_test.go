@@ -0,0 +1,193 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// priceServer - A stand-in for the CoinGecko API, with a rate that can be changed or made to fail
+type priceServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	rate float64
+	fail bool
+	gets int
+}
+
+func newPriceServer(t *testing.T, rate float64) *priceServer {
+	s := &priceServer{rate: rate}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.gets++
+		if s.fail {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/simple/price":
+			fmt.Fprintf(w, `{%q:{%q:%v}}`, q.Get("ids"), q.Get("vs_currencies"), s.rate)
+		case "/coins/" + cCoinGeckoIDDivi + "/history":
+			fmt.Fprintf(w, `{"market_data":{"current_price":{"usd":%v}}}`, s.rate)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *priceServer) set(rate float64, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate, s.fail = rate, fail
+}
+
+func (s *priceServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+func (s *priceServer) provider() *HTTPPriceProvider {
+	p := NewHTTPPriceProvider()
+	p.BaseURL = s.URL
+	return p
+}
+
+// waitFor - Fails the test if cond isn't true within a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+	}
+}
+
+func TestHTTPPriceProvider(t *testing.T) {
+	s := newPriceServer(t, 0.05)
+	p := s.provider()
+	ctx := context.Background()
+
+	if rate, err := p.Price(ctx, PTDivi, "USD"); err != nil || rate != 0.05 {
+		t.Errorf("Price() = %v, %v, want 0.05", rate, err)
+	}
+	s.set(0.06, true)
+	if _, err := p.Price(ctx, PTDivi, "USD"); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Price() error = %v, want the status", err)
+	}
+
+	// Past days are only fetched once, but today's price isn't kept
+	s.set(0.04, false)
+	yesterday := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if rate, err := p.FiatRate(ctx, PTDivi, "usd", yesterday); err != nil || rate != 0.04 {
+			t.Errorf("FiatRate() = %v, %v, want 0.04", rate, err)
+		}
+		if _, err := p.FiatRate(ctx, PTDivi, "usd", time.Now()); err != nil {
+			t.Errorf("FiatRate() today error = %v", err)
+		}
+	}
+	if n := s.requests(); n != 5 {
+		t.Errorf("%d requests, want 5 with the past day's rate cached", n)
+	}
+	if _, err := p.FiatRate(ctx, PTDivi, "gbp", yesterday); err != ErrPriceUnavailable {
+		t.Errorf("FiatRate() in GBP error = %v, want %v", err, ErrPriceUnavailable)
+	}
+}
+
+func TestCachedPriceProvider(t *testing.T) {
+	s := newPriceServer(t, 0.05)
+	c := NewCachedPriceProvider(s.provider())
+	clock := &testClock{t: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c.now = clock.now
+	ctx := context.Background()
+	price := func() float64 {
+		t.Helper()
+		rate, err := c.Price(ctx, PTDivi, "USD")
+		if err != nil {
+			t.Fatalf("Price() error = %v", err)
+		}
+		return rate
+	}
+
+	// Fresh prices come from the cache, whatever the case of the currency
+	price()
+	s.set(0.06, false)
+	clock.advance(c.TTL - time.Second)
+	if rate, err := c.Price(ctx, PTDivi, "usd"); err != nil || rate != 0.05 || s.requests() != 1 {
+		t.Errorf("Price() = %v, %v after %d requests, want the cached 0.05", rate, err, s.requests())
+	}
+
+	// Once stale, the old price is returned while the new one is fetched
+	clock.advance(2 * time.Second)
+	if rate := price(); rate != 0.05 {
+		t.Errorf("Price() when stale = %v, want the cached 0.05", rate)
+	}
+	waitFor(t, "the refreshed price", func() bool { return price() == 0.06 })
+	if n := s.requests(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+
+	// A failed refresh keeps the stale price, and it's tried again
+	s.set(0.07, true)
+	clock.advance(c.TTL)
+	if rate := price(); rate != 0.06 {
+		t.Errorf("Price() when stale = %v, want the cached 0.06", rate)
+	}
+	waitFor(t, "the refresh to be tried again", func() bool { return price() == 0.06 && s.requests() >= 4 })
+
+	// Too stale to use, so the error is returned
+	clock.advance(c.StaleTTL)
+	if _, err := c.Price(ctx, PTDivi, "USD"); err == nil {
+		t.Error("Price() error = nil, want the fetch error once the price has expired")
+	}
+}
+
+func TestFallbackPriceProvider(t *testing.T) {
+	down := newPriceServer(t, 0)
+	down.set(0, true)
+	up := newPriceServer(t, 0.05)
+	ctx := context.Background()
+
+	f := FallbackPriceProvider{down.provider(), up.provider()}
+	if rate, err := f.Price(ctx, PTDivi, "USD"); err != nil || rate != 0.05 {
+		t.Errorf("Price() = %v, %v, want the second provider's 0.05", rate, err)
+	}
+
+	// The fixed rate is the last resort
+	up.set(0, true)
+	f = append(f, FixedPriceProvider{PTDivi: {"USD": 0.01}})
+	if rate, err := f.Price(ctx, PTDivi, "usd"); err != nil || rate != 0.01 {
+		t.Errorf("Price() = %v, %v, want the fixed 0.01", rate, err)
+	}
+
+	_, err := f.Price(ctx, PTDivi, "GBP")
+	if !errors.Is(err, ErrPriceUnavailable) || strings.Count(err.Error(), "429") != 2 {
+		t.Errorf("Price() error = %v, want every provider's error", err)
+	}
+	if _, err := (FallbackPriceProvider{}).Price(ctx, PTDivi, "USD"); err != ErrPriceUnavailable {
+		t.Errorf("Price() with no providers error = %v, want %v", err, ErrPriceUnavailable)
+	}
+
+	// Once cancelled, the rest aren't tried
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	before := up.requests()
+	if _, err := (FallbackPriceProvider{down.provider(), up.provider()}).Price(cctx, PTDivi, "USD"); err != context.Canceled {
+		t.Errorf("Price() cancelled error = %v, want %v", err, context.Canceled)
+	}
+	if up.requests() != before {
+		t.Error("the second provider was tried after the context was cancelled")
+	}
+}
@@ -0,0 +1,337 @@
+package gwcommon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	cProgressBarWidth   int = 30
+	cProgressFunnyCount int = 24 // How many messages getFunnyWaitingStr has
+
+	cProgressRedraw     = 100 * time.Millisecond
+	cProgressSpinEvery  = 250 * time.Millisecond
+	cProgressPlainEvery = 10 * time.Second
+	cProgressFunnyEvery = 15 * time.Second
+)
+
+var (
+	progressSpinnerFrames = []string{cCircProg1, cCircProg2, cCircProg3, cCircProg4}
+	progressBounceFrames  = []string{cProgress1, cProgress2, cProgress3, cProgress4, cProgress5, cProgress6,
+		cProgress7, cProgress8, cProgress9, cProgress10, cProgress11}
+)
+
+// ProgressStyle - What's shown while the total isn't known
+type ProgressStyle int
+
+const (
+	// PSSpinner - A turning circle, cCircProg1..4
+	PSSpinner ProgressStyle = iota
+	// PSBounce - An arrow moving across, cProgress1..11
+	PSBounce
+)
+
+// ProgressOutput - Whether the progress is redrawn in place, or written as a line now and then
+type ProgressOutput int
+
+const (
+	// POAuto - Redraw in place if Out is a terminal, otherwise write lines
+	POAuto ProgressOutput = iota
+	// POTerminal - Always redraw in place
+	POTerminal
+	// POPlain - Always write lines, every PlainEvery, e.g. for logs and CI
+	POPlain
+)
+
+// ProgressOptions - What the progress shows, and where
+type ProgressOptions struct {
+	Out        io.Writer // Defaults to os.Stdout
+	Output     ProgressOutput
+	Label      string        // e.g. "Syncing blockchain"
+	Total      float64       // If above 0 a bar with the percentage, rate and ETA is shown, otherwise a spinner
+	Unit       string        // e.g. "blocks", or "B" to show amounts as KB, MB etc.
+	Style      ProgressStyle // The spinner style
+	Funny      bool          // The spinner also shows getFunnyWaitingStr messages as the wait goes on
+	Width      int           // The width of the bar, defaults to cProgressBarWidth
+	PlainEvery time.Duration // How often a line is written when not on a terminal, defaults to cProgressPlainEvery
+	Now        func() time.Time
+}
+
+// Progress - Shows the progress of a sync or download, see NewProgress
+type Progress struct {
+	mu       sync.Mutex
+	opts     ProgressOptions
+	terminal bool
+	start    time.Time
+	lastDraw time.Time
+	drawn    bool
+	lastLen  int
+	done     float64
+	// base and baseAt are the first amount done and when, so a sync that starts part way shows the rate since then
+	base     float64
+	baseAt   time.Time
+	based    bool
+	frame    int
+	stop     chan struct{}
+	finished bool
+}
+
+// NewProgress - Returns a Progress that writes to opts.Out. Nothing is shown until Update, Add or Tick is called
+func NewProgress(opts ProgressOptions) *Progress {
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.Width <= 0 {
+		opts.Width = cProgressBarWidth
+	}
+	if opts.PlainEvery <= 0 {
+		opts.PlainEvery = cProgressPlainEvery
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	terminal := opts.Output == POTerminal
+	if opts.Output == POAuto {
+		f, ok := opts.Out.(*os.File)
+		terminal = ok && term.IsTerminal(int(f.Fd()))
+	}
+	return &Progress{opts: opts, terminal: terminal, start: opts.Now()}
+}
+
+// SetLabel - Changes what the progress is for, e.g. from "Downloading" to "Extracting"
+func (p *Progress) SetLabel(label string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts.Label = label
+	p.draw(true)
+}
+
+// SetTotal - Sets the total once it's known, e.g. from a download's Content-Length, which turns the spinner into a bar
+func (p *Progress) SetTotal(total float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts.Total = total
+	p.draw(true)
+}
+
+// Update - Sets how much has been done so far, e.g. the block height, and redraws if it's been long enough
+func (p *Progress) Update(done float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.based {
+		p.base, p.baseAt, p.based = done, p.opts.Now(), true
+	}
+	p.done = done
+	p.draw(false)
+}
+
+// Add - Adds n to how much has been done
+func (p *Progress) Add(n float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.based {
+		// Adding counts from nothing at the start
+		p.baseAt, p.based = p.start, true
+	}
+	p.done += n
+	p.draw(false)
+}
+
+// Write - Adds len(b) to how much has been done, so a download can be shown with e.g. io.TeeReader(resp.Body, p)
+func (p *Progress) Write(b []byte) (int, error) {
+	p.Add(float64(len(b)))
+	return len(b), nil
+}
+
+// Tick - Moves the spinner on and redraws if it's been long enough
+func (p *Progress) Tick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frame++
+	p.draw(false)
+}
+
+// Start - Ticks the spinner in the background until Done or Stop is called
+func (p *Progress) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil || p.finished {
+		return
+	}
+	p.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		t := time.NewTicker(cProgressSpinEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				p.Tick()
+			}
+		}
+	}(p.stop)
+}
+
+// Done - Replaces the progress with a tick and msg, or the label if msg is blank
+func (p *Progress) Done(msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finish() {
+		return
+	}
+	if msg == "" {
+		msg = p.opts.Label
+	}
+	p.clear()
+	fmt.Fprintln(p.opts.Out, cUtfTick+" "+msg)
+}
+
+// Stop - Takes the progress off the screen, e.g. before showing an error
+func (p *Progress) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finish() {
+		return
+	}
+	p.clear()
+}
+
+// finish - Stops the ticking, and returns whether it had already finished
+func (p *Progress) finish() bool {
+	if p.finished {
+		return true
+	}
+	p.finished = true
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	return false
+}
+
+func (p *Progress) clear() {
+	if p.terminal && p.drawn {
+		fmt.Fprint(p.opts.Out, "\r"+strings.Repeat(" ", p.lastLen)+"\r")
+	}
+}
+
+// draw - Writes the progress if force is set or it's been long enough since it was last written.
+// Must be called with p.mu held
+func (p *Progress) draw(force bool) {
+	if p.finished {
+		return
+	}
+	now := p.opts.Now()
+	every := p.opts.PlainEvery
+	if p.terminal {
+		every = cProgressRedraw
+	}
+	if p.drawn && !force && now.Sub(p.lastDraw) < every {
+		return
+	}
+	p.lastDraw = now
+	p.drawn = true
+
+	line := p.line(now)
+	if !p.terminal {
+		fmt.Fprintln(p.opts.Out, line)
+		return
+	}
+	// Pad over the end of a longer previous line, rather than relying on escape codes the terminal may not support
+	n := utf8.RuneCountInString(line)
+	pad := ""
+	if n < p.lastLen {
+		pad = strings.Repeat(" ", p.lastLen-n)
+	}
+	p.lastLen = n
+	fmt.Fprint(p.opts.Out, "\r"+line+pad)
+}
+
+func (p *Progress) line(now time.Time) string {
+	elapsed := now.Sub(p.start)
+	var parts []string
+	if p.opts.Total > 0 {
+		frac := p.done / p.opts.Total
+		if frac < 0 {
+			frac = 0
+		} else if frac > 1 {
+			frac = 1
+		}
+		if p.terminal {
+			parts = append(parts, p.opts.Label, "["+progressBar(frac, p.opts.Width)+"]")
+		} else {
+			parts = append(parts, p.opts.Label+":")
+		}
+		parts = append(parts, fmt.Sprintf("%.1f%%", frac*100),
+			p.amount(p.done)+" of "+p.amount(p.opts.Total))
+
+		if secs := now.Sub(p.baseAt).Seconds(); p.based && secs >= 1 && p.done > p.base {
+			rate := (p.done - p.base) / secs
+			parts = append(parts, p.amount(rate)+"/s")
+			if left := p.opts.Total - p.done; left > 0 {
+				eta := time.Duration(left / rate * float64(time.Second))
+				parts = append(parts, "ETA "+eta.Round(time.Second).String())
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if p.terminal {
+		frames := progressSpinnerFrames
+		if p.opts.Style == PSBounce {
+			frames = progressBounceFrames
+		}
+		parts = append(parts, frames[p.frame%len(frames)])
+	}
+	if p.opts.Label != "" {
+		parts = append(parts, p.opts.Label)
+	}
+	if p.done > 0 {
+		parts = append(parts, p.amount(p.done))
+	}
+	if p.opts.Funny {
+		i := int(elapsed / cProgressFunnyEvery)
+		if i >= cProgressFunnyCount {
+			i = cProgressFunnyCount - 1
+		}
+		parts = append(parts, getFunnyWaitingStr(i))
+	}
+	if !p.terminal {
+		parts = append(parts, "("+elapsed.Round(time.Second).String()+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// amount - Formats v in the progress's unit
+func (p *Progress) amount(v float64) string {
+	if p.opts.Unit != "B" {
+		return strings.TrimSpace(fmt.Sprintf("%.0f %s", v, p.opts.Unit))
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", v)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+func progressBar(frac float64, width int) string {
+	filled := int(frac * float64(width))
+	if filled >= width {
+		return strings.Repeat("=", width)
+	}
+	return strings.Repeat("=", filled) + ">" + strings.Repeat(" ", width-filled-1)
+}
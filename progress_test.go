@@ -0,0 +1,196 @@
+package gwcommon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClock - A clock for ProgressOptions.Now that only moves when told to
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestProgress(out ProgressOutput, opts ProgressOptions) (*Progress, *bytes.Buffer, *testClock) {
+	var buf bytes.Buffer
+	clock := &testClock{t: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	opts.Out = &buf
+	opts.Output = out
+	opts.Now = clock.now
+	return NewProgress(opts), &buf, clock
+}
+
+// plainLines - The lines written so far, and empties buf
+func plainLines(buf *bytes.Buffer) []string {
+	s := strings.TrimSuffix(buf.String(), "\n")
+	buf.Reset()
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func TestProgressBar(t *testing.T) {
+	p, buf, clock := newTestProgress(POTerminal, ProgressOptions{Label: "Syncing", Total: 100, Unit: "blocks", Width: 10})
+	p.Update(50)
+	if got, want := buf.String(), "\rSyncing [=====>    ] 50.0% 50 blocks of 100 blocks"; got != want {
+		t.Errorf("Update(50) wrote %q, want %q", got, want)
+	}
+
+	// A full bar, and the end of the longer line is padded over
+	buf.Reset()
+	clock.advance(time.Second)
+	p.SetLabel("Synced")
+	if got := buf.String(); got != "\rSynced [=====>    ] 50.0% 50 blocks of 100 blocks " {
+		t.Errorf("SetLabel() wrote %q", got)
+	}
+	buf.Reset()
+	clock.advance(cProgressRedraw)
+	p.Update(100)
+	// 50 blocks since the first Update, 1.1s ago
+	want := "\rSynced [==========] 100.0% 100 blocks of 100 blocks 45 blocks/s"
+	if got := buf.String(); got != want {
+		t.Errorf("Update(100) wrote %q, want %q", got, want)
+	}
+}
+
+func TestProgressRateAndETA(t *testing.T) {
+	// A sync that starts part way through the chain
+	p, buf, clock := newTestProgress(POPlain, ProgressOptions{Label: "Syncing", Total: 1000000, Unit: "blocks"})
+	clock.advance(time.Minute)
+	p.Update(500000)
+	clock.advance(10 * time.Second)
+	p.Update(500100)
+
+	want := []string{
+		"Syncing: 50.0% 500000 blocks of 1000000 blocks",
+		// 100 blocks in 10s, not 500100 in 70s
+		"Syncing: 50.0% 500100 blocks of 1000000 blocks 10 blocks/s ETA 13h53m10s",
+	}
+	if got := plainLines(buf); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestProgressDownloadRate(t *testing.T) {
+	p, buf, clock := newTestProgress(POPlain, ProgressOptions{Label: "Downloading", Unit: "B", PlainEvery: time.Second})
+	p.SetTotal(4 << 20)
+	clock.advance(2 * time.Second)
+	p.Write(make([]byte, 1<<20))
+	clock.advance(10 * time.Second)
+	p.Write(make([]byte, 1<<20))
+
+	want := []string{
+		"Downloading: 0.0% 0 B of 4.0 MB",
+		"Downloading: 25.0% 1.0 MB of 4.0 MB 512.0 KB/s ETA 6s",
+		"Downloading: 50.0% 2.0 MB of 4.0 MB 170.7 KB/s ETA 12s",
+	}
+	if got := plainLines(buf); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestProgressPlainThrottle(t *testing.T) {
+	p, buf, clock := newTestProgress(POPlain, ProgressOptions{Label: "Syncing", Total: 10, PlainEvery: 5 * time.Second})
+	steps := []struct {
+		after time.Duration
+		done  float64
+		lines int
+	}{
+		{after: 0, done: 1, lines: 1},
+		{after: time.Second, done: 2, lines: 0},
+		{after: 3 * time.Second, done: 3, lines: 0},
+		{after: time.Second, done: 4, lines: 1},
+		{after: 4 * time.Second, done: 5, lines: 0},
+	}
+	for i, s := range steps {
+		clock.advance(s.after)
+		p.Update(s.done)
+		if got := plainLines(buf); len(got) != s.lines {
+			t.Errorf("step %d wrote %q, want %d lines", i, got, s.lines)
+		}
+	}
+
+	// Changing the label or total is always shown
+	p.SetLabel("Verifying")
+	if got := plainLines(buf); len(got) != 1 || !strings.HasPrefix(got[0], "Verifying: 50.0%") {
+		t.Errorf("SetLabel() wrote %q", got)
+	}
+	p.SetTotal(20)
+	if got := plainLines(buf); len(got) != 1 || !strings.HasPrefix(got[0], "Verifying: 25.0%") {
+		t.Errorf("SetTotal() wrote %q", got)
+	}
+}
+
+func TestProgressDone(t *testing.T) {
+	p, buf, _ := newTestProgress(POTerminal, ProgressOptions{Label: "Syncing", Total: 10, Width: 4})
+	p.Update(5)
+	line := buf.String()
+	buf.Reset()
+
+	p.Done("")
+	clear := "\r" + strings.Repeat(" ", len(line)-1) + "\r"
+	if got, want := buf.String(), clear+cUtfTick+" Syncing\n"; got != want {
+		t.Errorf("Done() wrote %q, want %q", got, want)
+	}
+
+	// Nothing more is drawn
+	buf.Reset()
+	p.Update(10)
+	p.SetLabel("Again")
+	p.Done("twice")
+	p.Stop()
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q after Done", buf.String())
+	}
+}
+
+func TestProgressStop(t *testing.T) {
+	p, buf, _ := newTestProgress(POTerminal, ProgressOptions{Label: "Waiting"})
+	p.Start()
+	p.Tick()
+	n := len([]rune(strings.TrimPrefix(buf.String(), "\r")))
+	buf.Reset()
+
+	p.Stop()
+	if got, want := buf.String(), "\r"+strings.Repeat(" ", n)+"\r"; got != want {
+		t.Errorf("Stop() wrote %q, want %q", got, want)
+	}
+	buf.Reset()
+	p.Done("done")
+	if buf.Len() != 0 {
+		t.Errorf("Done() after Stop wrote %q", buf.String())
+	}
+
+	// Not on a terminal there's nothing to clear, only the tick line
+	p, buf, _ = newTestProgress(POPlain, ProgressOptions{Label: "Waiting"})
+	p.Tick()
+	buf.Reset()
+	p.Done("Finished")
+	if got := buf.String(); got != cUtfTick+" Finished\n" {
+		t.Errorf("Done() wrote %q", got)
+	}
+}
+
+func TestProgressFunny(t *testing.T) {
+	p, buf, clock := newTestProgress(POPlain, ProgressOptions{Label: "Waiting for the daemon", Funny: true, PlainEvery: time.Second})
+	tests := []struct {
+		at   time.Duration
+		want string
+	}{
+		{at: 0, want: "Waiting for the daemon " + getFunnyWaitingStr(0) + " (0s)"},
+		{at: cProgressFunnyEvery, want: "Waiting for the daemon " + getFunnyWaitingStr(1) + " (15s)"},
+		// Once the messages run out, the last one stays
+		{at: 100 * cProgressFunnyEvery, want: "Waiting for the daemon " + getFunnyWaitingStr(cProgressFunnyCount-1) + " (25m0s)"},
+	}
+	start := clock.now()
+	for _, tt := range tests {
+		clock.t = start.Add(tt.at)
+		p.Tick()
+		if got := plainLines(buf); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("at %v wrote %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
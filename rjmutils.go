@@ -2,10 +2,8 @@ package gwcommon
 
 import (
 	"archive/tar"
-	"archive/zip"
 	"bufio"
 	"compress/gzip"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -20,54 +18,13 @@ import (
 
 // rjmutils version 0.02
 
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
-
-	fileToZip, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer fileToZip.Close()
-
-	// Get the file information
-	info, err := fileToZip.Stat()
-	if err != nil {
-		return err
-	}
-
-	header, err := zip.FileInfoHeader(info)
-	if err != nil {
-		return err
-	}
-
-	// Using FileInfoHeader() above only uses the basename of the file. If we want
-	// to preserve the folder structure we can overwrite this with the full path.
-	header.Name = filename
-
-	// Change to deflate to gain better compression
-	// see http://golang.org/pkg/archive/zip/#pkg-constants
-	header.Method = zip.Deflate
-
-	writer, err := zipWriter.CreateHeader(header)
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(writer, fileToZip)
-	return err
-}
-
+// AddToLog - Writes txt to logFile at info level, rotating the file when it gets too big. See NewLogger for more control
 func AddToLog(logFile, txt string) error {
-	f, err := os.OpenFile(logFile,
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	l, err := fileLogger(logFile)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	logger := log.New(f, "", log.LstdFlags)
-	logger.Println(txt)
-	log.Print(txt)
-
-	return nil
+	return l.Log(LLInfo, txt)
 }
 
 func AddTrailingSlash(filePath string) string {
@@ -262,46 +219,29 @@ func getFunnyWaitingStr(index int) string {
 
 }
 
+// ExtractTarGz - Extracts the tar.gz stream into the current directory
 func ExtractTarGz(gzipStream io.Reader) error {
-	uncompressedStream, err := gzip.NewReader(gzipStream)
+	_, err := ExtractTarGzTo(gzipStream, ".", ExtractOptions{})
+	return err
+}
+
+// ExtractTarGzTo - Extracts the tar.gz stream into dest, which is created if needed, and returns the paths written.
+// Entries that would end up outside dest are rejected, and file permissions and modification times are kept
+func ExtractTarGzTo(r io.Reader, dest string, opts ExtractOptions) ([]string, error) {
+	gzr, err := gzip.NewReader(r)
 	if err != nil {
-		log.Fatal("ExtractTarGz: NewReader failed")
+		return nil, fmt.Errorf("ExtractTarGzTo: %v", err)
 	}
+	defer gzr.Close()
 
-	tarReader := tar.NewReader(uncompressedStream)
-
-	for true {
-		header, err := tarReader.Next()
-
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			log.Fatalf("ExtractTarGz: Next() failed: %s", err.Error())
-		}
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.Mkdir(header.Name, 0755); err != nil {
-				log.Fatalf("ExtractTarGz: Mkdir() failed: %s", err.Error())
-			}
-		case tar.TypeReg:
-			outFile, err := os.Create(header.Name)
-			if err != nil {
-				log.Fatalf("ExtractTarGz: Create() failed: %s", err.Error())
-			}
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				log.Fatalf("ExtractTarGz: Copy() failed: %s", err.Error())
-			}
-			outFile.Close()
-
-		default:
-			log.Fatalf("ExtractTarGz: uknown type: %s in %s", header.Typeflag, header.Name)
-		}
-
+	x, err := newArchiveExtractor(dest, opts)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if err := x.extractTar(tar.NewReader(gzr)); err != nil {
+		return x.files, err
+	}
+	return x.files, x.finish()
 }
 
 // GetRunningDir - Return the directory of the running binary
@@ -322,10 +262,16 @@ func gZipIt(sourceFile, targetDir string, deleteOrig bool) (gzFile string, err e
 	if err != nil {
 		return "", err
 	}
+	defer reader.Close()
+	fi, err := reader.Stat()
+	if err != nil {
+		return "", err
+	}
 
 	filename := filepath.Base(sourceFile)
 	var targetFile string = filepath.Join(targetDir, fmt.Sprintf("%s.gz", filename))
-	writer, err := os.Create(targetFile)
+	// Keep the source's permissions, as e.g. logs are only readable by their owner
+	writer, err := os.OpenFile(targetFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode().Perm())
 	if err != nil {
 		return "", err
 	}
@@ -333,14 +279,20 @@ func gZipIt(sourceFile, targetDir string, deleteOrig bool) (gzFile string, err e
 
 	archiver := gzip.NewWriter(writer)
 	archiver.Name = filename
-	defer archiver.Close()
+	archiver.ModTime = fi.ModTime()
 
-	_, err = io.Copy(archiver, reader)
-	if err != nil {
+	if _, err = io.Copy(archiver, reader); err != nil {
+		return "", err
+	}
+	if err = archiver.Close(); err != nil {
+		return "", err
+	}
+	if err = writer.Close(); err != nil {
 		return "", err
 	}
 	if deleteOrig {
 		log.Print("Removing source file " + sourceFile + "...")
+		reader.Close()
 		err = os.Remove(sourceFile)
 		if err != nil {
 			return "", err
@@ -365,25 +317,9 @@ func IsLinux() bool {
 }
 
 func createTarball(tarballFilePath string, filePaths []string) error {
-	file, err := os.Create(tarballFilePath)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not create tarball file '%s', got error '%s'", tarballFilePath, err.Error()))
-	}
-	defer file.Close()
-
-	gzipWriter := gzip.NewWriter(file)
-	defer gzipWriter.Close()
-
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
-
-	for _, filePath := range filePaths {
-		err := addFileToTarWriter(filePath, tarWriter)
-		if err != nil {
-			return errors.New(fmt.Sprintf("Could not add file '%s', to tarball, got error '%s'", filePath, err.Error()))
-		}
+	if _, err := CreateArchive(tarballFilePath, AFTar, filePaths); err != nil {
+		return fmt.Errorf("Could not create tarball file '%s', got error '%s'", tarballFilePath, err.Error())
 	}
-
 	return nil
 }
 
@@ -402,38 +338,6 @@ func StringExistsInFile(str, file string) (bool, error) {
 	return false, nil
 }
 
-func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not open file '%s', got error '%s'", filePath, err.Error()))
-	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not get stat for file '%s', got error '%s'", filePath, err.Error()))
-	}
-
-	header := &tar.Header{
-		Name:    filePath,
-		Size:    stat.Size(),
-		Mode:    int64(stat.Mode()),
-		ModTime: stat.ModTime(),
-	}
-
-	err = tarWriter.WriteHeader(header)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not write header for file '%s', got error '%s'", filePath, err.Error()))
-	}
-
-	_, err = io.Copy(tarWriter, file)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not copy the file '%s' data to the tarball, got error '%s'", filePath, err.Error()))
-	}
-
-	return nil
-}
-
 func unGZip(source, target string) error {
 	reader, err := os.Open(source)
 	if err != nil {
@@ -461,59 +365,8 @@ func unGZip(source, target string) error {
 // Unzip will decompress a zip archive, moving all files and folders
 // within the zip file (parameter 1) to an output directory (parameter 2).
 func UnZip(src string, dest string) ([]string, error) {
-
-	var filenames []string
-
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return filenames, err
-	}
-	defer r.Close()
-
-	for _, f := range r.File {
-
-		// Store filename/path for returning and using later on
-		fpath := filepath.Join(dest, f.Name)
-
-		// Check for ZipSlip. More Info: http://bit.ly/2MsjAWE
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return filenames, fmt.Errorf("%s: illegal file path", fpath)
-		}
-
-		filenames = append(filenames, fpath)
-
-		if f.FileInfo().IsDir() {
-			// Make Folder
-			os.MkdirAll(fpath, os.ModePerm)
-			continue
-		}
-
-		// Make File
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return filenames, err
-		}
-
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return filenames, err
-		}
-
-		rc, err := f.Open()
-		if err != nil {
-			return filenames, err
-		}
-
-		_, err = io.Copy(outFile, rc)
-
-		// Close the file without defer to close before next iteration of loop
-		outFile.Close()
-		rc.Close()
-
-		if err != nil {
-			return filenames, err
-		}
-	}
-	return filenames, nil
+	a := &Archive{File: src, Format: AFZip}
+	return a.Extract(dest, ExtractOptions{})
 }
 
 func WriteTextToFile(fileName, text string) error {
@@ -543,21 +396,6 @@ func WriteTextToFile(fileName, text string) error {
 // Param 1: filename is the output zip file's name.
 // Param 2: files is a list of files to add to the zip.
 func zipFiles(filename string, files []string) error {
-
-	newZipFile, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer newZipFile.Close()
-
-	zipWriter := zip.NewWriter(newZipFile)
-	defer zipWriter.Close()
-
-	// Add files to zip
-	for _, file := range files {
-		if err = addFileToZip(zipWriter, file); err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := CreateArchive(filename, AFZip, files)
+	return err
 }
@@ -0,0 +1,323 @@
+package gwcommon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// CWalletSeedVaultFileBoxDivi - The encrypted seed vault, which replaces cWalletSeedFileBoxDivi
+	CWalletSeedVaultFileBoxDivi string = "divi-seed.vault"
+
+	cSeedVaultVersion   int    = 1
+	cSeedVaultKDF       string = "scrypt"
+	cSeedVaultScryptN   int    = 1 << 15
+	cSeedVaultScryptR   int    = 8
+	cSeedVaultScryptP   int    = 1
+	cSeedVaultKeyLen    int    = 32
+	cSeedVaultSaltLen   int    = 16
+	cSeedQuizWordCount  int    = 3
+	cSecureDeletePasses int    = 3
+)
+
+// ErrSeedVaultDecrypt - The vault couldn't be decrypted, either the passphrase is wrong or the file has been tampered with
+var ErrSeedVaultDecrypt = errors.New("unable to decrypt seed vault, the password is incorrect or the vault is corrupt")
+
+// seedVaultFile - The on-disk format of the seed vault, the phrase is sealed with AES-256-GCM using a key derived by scrypt
+type seedVaultFile struct {
+	Version    int
+	KDF        string
+	N          int
+	R          int
+	P          int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// SaveSeedVault - Encrypts the recovery phrase with the wallet passphrase and writes it to file, readable only by the user
+func SaveSeedVault(file, phrase, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("a passphrase is required to create the seed vault")
+	}
+
+	v := seedVaultFile{
+		Version: cSeedVaultVersion,
+		KDF:     cSeedVaultKDF,
+		N:       cSeedVaultScryptN,
+		R:       cSeedVaultScryptR,
+		P:       cSeedVaultScryptP,
+		Salt:    make([]byte, cSeedVaultSaltLen),
+	}
+	if _, err := io.ReadFull(rand.Reader, v.Salt); err != nil {
+		return err
+	}
+
+	aead, err := v.aead(passphrase)
+	if err != nil {
+		return err
+	}
+	v.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, v.Nonce); err != nil {
+		return err
+	}
+	v.Ciphertext = aead.Seal(nil, v.Nonce, []byte(phrase), v.additionalData())
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first, so we never leave a half written vault behind
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".seedvault-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// OpenSeedVault - Returns the recovery phrase stored in the vault file
+func OpenSeedVault(file, passphrase string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	var v seedVaultFile
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("unable to read seed vault %v: %v", file, err)
+	}
+	if v.Version != cSeedVaultVersion || v.KDF != cSeedVaultKDF {
+		return "", fmt.Errorf("unsupported seed vault %v: version %d, kdf %v", file, v.Version, v.KDF)
+	}
+
+	aead, err := v.aead(passphrase)
+	if err != nil {
+		return "", err
+	}
+	if len(v.Nonce) != aead.NonceSize() {
+		return "", ErrSeedVaultDecrypt
+	}
+	phrase, err := aead.Open(nil, v.Nonce, v.Ciphertext, v.additionalData())
+	if err != nil {
+		return "", ErrSeedVaultDecrypt
+	}
+	return string(phrase), nil
+}
+
+func (v seedVaultFile) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), v.Salt, v.N, v.R, v.P, cSeedVaultKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData - Binds the KDF parameters to the ciphertext, so they can't be altered without detection
+func (v seedVaultFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%d:%d:%d", v.Version, v.KDF, v.N, v.R, v.P))
+}
+
+// MigratePlaintextSeedFile - Moves the seed in the plaintext cWalletSeedFileBoxDivi within dir into an encrypted vault,
+// then securely deletes the plaintext file. Returns false if there was no plaintext file to migrate
+func MigratePlaintextSeedFile(dir, passphrase string) (bool, error) {
+	dir = AddTrailingSlash(dir)
+	plainFile := dir + cWalletSeedFileBoxDivi
+	if !FileExists(plainFile) {
+		return false, nil
+	}
+
+	b, err := ioutil.ReadFile(plainFile)
+	if err != nil {
+		return false, err
+	}
+	phrase := strings.Join(strings.Fields(string(b)), " ")
+
+	vaultFile := dir + CWalletSeedVaultFileBoxDivi
+	if err := SaveSeedVault(vaultFile, phrase, passphrase); err != nil {
+		return false, fmt.Errorf("unable to create seed vault: %v", err)
+	}
+
+	// Make sure we can get the seed back out again before destroying the original
+	check, err := OpenSeedVault(vaultFile, passphrase)
+	if err != nil || check != phrase {
+		return false, fmt.Errorf("unable to verify seed vault, %v has been left in place: %v", plainFile, err)
+	}
+
+	if err := SecureDeleteFile(plainFile); err != nil {
+		return true, fmt.Errorf("seed vault created, but unable to securely delete %v: %v", plainFile, err)
+	}
+	return true, nil
+}
+
+// SecureDeleteFile - Overwrites the file with random data several times before removing it.
+// On SSDs and journalling or copy-on-write filesystems the old blocks may survive, so this is a best effort
+func SecureDeleteFile(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%v is a directory", file)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < cSecureDeletePasses; i++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Rename before removing, so the original file name doesn't linger in the directory entry
+	rnd := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, rnd); err != nil {
+		return err
+	}
+	anon := filepath.Join(filepath.Dir(file), fmt.Sprintf(".%x", rnd))
+	if err := os.Rename(file, anon); err != nil {
+		return os.Remove(file)
+	}
+	return os.Remove(anon)
+}
+
+// ConfirmSeedRecovery - Displays the recovery phrase, waits for the user to say they've stored it safely, then quizzes
+// them on some randomly chosen words. Returns true only if every word was answered correctly
+func (p *Prompter) ConfirmSeedRecovery(phrase string) (bool, error) {
+	words := strings.Fields(phrase)
+	if len(words) == 0 {
+		return false, errors.New("the recovery phrase is empty")
+	}
+
+	fmt.Fprint(p.Out, "\nPlease write down your recovery phrase and keep it somewhere safe:\n\n")
+	for i, w := range words {
+		fmt.Fprintf(p.Out, "%2d: %s\n", i+1, w)
+	}
+
+	resp, err := p.ReadLine("\nOnce you have stored it safely, please type " + CSeedStoredSafelyStr + " to continue: ")
+	if err != nil {
+		return false, err
+	}
+	if resp != CSeedStoredSafelyStr {
+		return false, nil
+	}
+
+	if p.Out == io.Writer(os.Stdout) {
+		ClearScreen()
+	}
+
+	return p.QuizSeedRecovery(phrase, cSeedQuizWordCount)
+}
+
+// QuizSeedRecovery - Asks the user for n randomly chosen words of the recovery phrase, returns true if all are correct
+func (p *Prompter) QuizSeedRecovery(phrase string, n int) (bool, error) {
+	words := strings.Fields(phrase)
+	pos, err := randomPositions(len(words), n)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprint(p.Out, "\nTo make sure your recovery phrase was recorded correctly, please enter the words asked for...\n")
+	for _, i := range pos {
+		resp, err := p.ReadLine(fmt.Sprintf("\nWord #%d: ", i+1))
+		if err != nil {
+			return false, err
+		}
+		if !strings.EqualFold(strings.TrimSpace(resp), words[i]) {
+			fmt.Fprintf(p.Out, "\nSorry, that's not correct. Please check your copy of the recovery phrase.\n")
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ConfirmAndRecordSeedRecovery - Runs the seed confirmation flow and, only if it's passed, sets UserConfirmedSeedRecovery
+func ConfirmAndRecordSeedRecovery(phrase string) (bool, error) {
+	ok, err := defaultPrompter().ConfirmSeedRecovery(phrase)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	cs, err := GetCLIConfStruct()
+	if err != nil {
+		return false, err
+	}
+	cs.UserConfirmedSeedRecovery = true
+	if err := SetCLIConfStruct(cs); err != nil {
+		return false, fmt.Errorf("unable to SetCLIConfStruct: %v", err)
+	}
+	return true, nil
+}
+
+// randomPositions - Returns n distinct indexes below max in ascending order, chosen with crypto/rand
+func randomPositions(max, n int) ([]int, error) {
+	if n > max {
+		n = max
+	}
+	chosen := make(map[int]bool)
+	var pos []int
+	for len(pos) < n {
+		r, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+		if err != nil {
+			return nil, err
+		}
+		i := int(r.Int64())
+		if !chosen[i] {
+			chosen[i] = true
+			pos = append(pos, i)
+		}
+	}
+	sort.Ints(pos)
+	return pos, nil
+}
@@ -0,0 +1,153 @@
+package gwcommon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const cTestSeedPhrase = "abandon ability able about above absent absorb abstract absurd abuse access accident"
+
+func TestSeedVaultRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), CWalletSeedVaultFileBoxDivi)
+	if err := SaveSeedVault(file, cTestSeedPhrase, "Correct-Horse9battery"); err != nil {
+		t.Fatalf("SaveSeedVault() error = %v", err)
+	}
+
+	got, err := OpenSeedVault(file, "Correct-Horse9battery")
+	if err != nil || got != cTestSeedPhrase {
+		t.Fatalf("OpenSeedVault() = %q, %v", got, err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "abandon") {
+		t.Error("the vault has the phrase in the clear")
+	}
+	if fi, err := os.Stat(file); err != nil {
+		t.Error(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("vault mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// A new salt and nonce each time
+	other := file + "2"
+	if err := SaveSeedVault(other, cTestSeedPhrase, "Correct-Horse9battery"); err != nil {
+		t.Fatal(err)
+	}
+	b2, err := ioutil.ReadFile(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) == string(b2) {
+		t.Error("two vaults of the same phrase are identical")
+	}
+}
+
+func TestSeedVaultRejected(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, CWalletSeedVaultFileBoxDivi)
+	if err := SaveSeedVault(file, cTestSeedPhrase, ""); err == nil {
+		t.Error("SaveSeedVault() without a passphrase should fail")
+	}
+	if err := SaveSeedVault(file, cTestSeedPhrase, "Correct-Horse9battery"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSeedVault(file, "correct-horse9battery"); err != ErrSeedVaultDecrypt {
+		t.Errorf("OpenSeedVault() with the wrong passphrase error = %v, want %v", err, ErrSeedVaultDecrypt)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v seedVaultFile
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(v *seedVaultFile)
+	}{
+		// Weaker scrypt parameters must not go unnoticed
+		{name: "N", change: func(v *seedVaultFile) { v.N = 1 << 14 }},
+		{name: "ciphertext", change: func(v *seedVaultFile) { v.Ciphertext[0] ^= 1 }},
+		{name: "nonce", change: func(v *seedVaultFile) { v.Nonce = v.Nonce[1:] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv := v
+			tv.Ciphertext = append([]byte(nil), v.Ciphertext...)
+			tt.change(&tv)
+			tb, err := json.Marshal(tv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tampered := filepath.Join(dir, "tampered-"+tt.name)
+			if err := ioutil.WriteFile(tampered, tb, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenSeedVault(tampered, "Correct-Horse9battery"); err != ErrSeedVaultDecrypt {
+				t.Errorf("OpenSeedVault() error = %v, want %v", err, ErrSeedVaultDecrypt)
+			}
+		})
+	}
+}
+
+func TestMigratePlaintextSeedFile(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, cWalletSeedFileBoxDivi)
+	if err := ioutil.WriteFile(plain, []byte(strings.Replace(cTestSeedPhrase, " ", "  \n", 3)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := MigratePlaintextSeedFile(dir, "Correct-Horse9battery")
+	if err != nil || !migrated {
+		t.Fatalf("MigratePlaintextSeedFile() = %v, %v", migrated, err)
+	}
+	if _, err := os.Stat(plain); !os.IsNotExist(err) {
+		t.Errorf("the plaintext seed file is still there: %v", err)
+	}
+	got, err := OpenSeedVault(filepath.Join(dir, CWalletSeedVaultFileBoxDivi), "Correct-Horse9battery")
+	if err != nil || got != cTestSeedPhrase {
+		t.Errorf("OpenSeedVault() = %q, %v", got, err)
+	}
+	// Nothing else is left behind, e.g. the renamed plaintext file
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		var names []string
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("dir has %v, want just the vault", names)
+	}
+
+	// Once migrated, there's nothing to do
+	if migrated, err := MigratePlaintextSeedFile(dir, "Correct-Horse9battery"); err != nil || migrated {
+		t.Errorf("MigratePlaintextSeedFile() again = %v, %v", migrated, err)
+	}
+}
+
+func TestMigratePlaintextSeedFileNoPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, cWalletSeedFileBoxDivi)
+	if err := ioutil.WriteFile(plain, []byte(cTestSeedPhrase), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigratePlaintextSeedFile(dir, ""); err == nil {
+		t.Fatal("MigratePlaintextSeedFile() without a passphrase should fail")
+	}
+	// The only copy of the seed is kept
+	if b, err := ioutil.ReadFile(plain); err != nil || string(b) != cTestSeedPhrase {
+		t.Errorf("plaintext seed file = %q, %v", b, err)
+	}
+}
@@ -0,0 +1,259 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	cSendUnlockSeconds   int    = 60
+	cSendFeeTargetBlocks int    = 6
+	cSendDefaultFeePerKB Amount = 10000
+	cSendMinConfs        int64  = 1
+
+	// Rough sizes of a P2PKH transaction, used to estimate the fee before the daemon picks the inputs
+	cTxBaseBytes   int64 = 10
+	cTxInputBytes  int64 = 148
+	cTxOutputBytes int64 = 34
+)
+
+var (
+	// ErrInvalidAddress - The daemon says the destination isn't a valid address for the coin
+	ErrInvalidAddress = errors.New("the address is not valid")
+	// ErrInsufficientFunds - The spendable balance doesn't cover the amount and fee
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrWalletPassphraseRequired - The wallet is locked and no passphrase was given
+	ErrWalletPassphraseRequired = errors.New("the wallet is locked, the passphrase is required to send")
+	// ErrWalletRelockFailed - The coins were sent, but the wallet unlocked to send them couldn't be locked again
+	ErrWalletRelockFailed = errors.New("the coins were sent, but the wallet could not be locked again")
+)
+
+// SendRequestStruct - What to send, and where
+type SendRequestStruct struct {
+	Address string
+	Amount  Amount
+	DryRun  bool // Only validate and preview, don't send anything
+}
+
+// SendPreviewStruct - What a send will do. The fee is an estimate, as the daemon chooses the inputs
+type SendPreviewStruct struct {
+	Address      string
+	Amount       Amount
+	Fee          Amount
+	FeePerKB     Amount
+	Inputs       int
+	Change       Amount
+	Balance      Amount
+	BalanceAfter Amount
+}
+
+// SendResultStruct - The result of Send, TxID is blank for a dry run
+type SendResultStruct struct {
+	Preview     SendPreviewStruct
+	TxID        string
+	RelockError string `json:",omitempty"` // Set if the wallet is still unlocked after the send, see ErrWalletRelockFailed
+}
+
+// ValidateAddress - Returns ErrInvalidAddress if the daemon doesn't think the address is valid for the coin
+func (c *CoinRPCClient) ValidateAddress(ctx context.Context, address string) error {
+	var va struct {
+		IsValid bool `json:"isvalid"`
+	}
+	if err := c.Call(ctx, "validateaddress", []interface{}{address}, &va); err != nil {
+		return err
+	}
+	if !va.IsValid {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// EstimateFeePerKB - Returns the fee per kB the daemon estimates, falling back to the wallet's paytxfee, the relay
+// fee or cSendDefaultFeePerKB. The result is never below the relay fee
+func (c *CoinRPCClient) EstimateFeePerKB(ctx context.Context) (Amount, error) {
+	var relay struct {
+		RelayFee Amount `json:"relayfee"`
+	}
+	if err := c.Call(ctx, "getnetworkinfo", nil, &relay); err != nil {
+		return 0, err
+	}
+
+	var fee Amount
+	// The daemon returns -1 if it hasn't seen enough blocks to estimate
+	if err := c.Call(ctx, "estimatefee", []interface{}{cSendFeeTargetBlocks}, &fee); err != nil && !IsRPCError(err, cRPCErrMethodNotFound) {
+		return 0, err
+	}
+	if fee <= 0 {
+		var wi struct {
+			PayTxFee Amount `json:"paytxfee"`
+		}
+		if err := c.Call(ctx, "getwalletinfo", nil, &wi); err != nil {
+			return 0, err
+		}
+		fee = wi.PayTxFee
+	}
+	if fee <= 0 {
+		fee = cSendDefaultFeePerKB
+	}
+	if fee < relay.RelayFee {
+		fee = relay.RelayFee
+	}
+	return fee, nil
+}
+
+// PreviewSend - Validates the request and works out the fee, change and resulting balance, without sending anything
+func (c *CoinRPCClient) PreviewSend(ctx context.Context, req SendRequestStruct) (SendPreviewStruct, error) {
+	if req.Amount <= 0 {
+		return SendPreviewStruct{}, errors.New("the amount must be more than zero")
+	}
+	req.Address = strings.TrimSpace(req.Address)
+	if err := c.ValidateAddress(ctx, req.Address); err != nil {
+		return SendPreviewStruct{}, err
+	}
+
+	feePerKB, err := c.EstimateFeePerKB(ctx)
+	if err != nil {
+		return SendPreviewStruct{}, err
+	}
+	wb, err := c.GetWalletBalance(ctx)
+	if err != nil {
+		return SendPreviewStruct{}, err
+	}
+
+	var unspent []struct {
+		Amount    Amount `json:"amount"`
+		Spendable *bool  `json:"spendable"`
+	}
+	if err := c.Call(ctx, "listunspent", []interface{}{cSendMinConfs}, &unspent); err != nil {
+		return SendPreviewStruct{}, err
+	}
+	var coins []Amount
+	for _, u := range unspent {
+		if u.Spendable == nil || *u.Spendable {
+			coins = append(coins, u.Amount)
+		}
+	}
+
+	p := SendPreviewStruct{Address: req.Address, Amount: req.Amount, FeePerKB: feePerKB, Balance: wb.Balance}
+	if err := selectSendInputs(&p, coins); err != nil {
+		return SendPreviewStruct{}, err
+	}
+	if p.BalanceAfter, err = sendBalanceAfter(p); err != nil {
+		return SendPreviewStruct{}, err
+	}
+	return p, nil
+}
+
+// selectSendInputs - Picks the largest coins first, until they cover the amount and the fee for that many inputs
+func selectSendInputs(p *SendPreviewStruct, coins []Amount) error {
+	sort.Slice(coins, func(i, j int) bool { return coins[i] > coins[j] })
+
+	var total Amount
+	for i, coin := range coins {
+		var err error
+		if total, err = total.Add(coin); err != nil {
+			return err
+		}
+
+		size := cTxBaseBytes + int64(i+1)*cTxInputBytes + 2*cTxOutputBytes
+		fee, err := p.FeePerKB.Mul(size)
+		if err != nil {
+			return err
+		}
+		// Round up to the next sat
+		fee = (fee + 999) / 1000
+
+		needed, err := p.Amount.Add(fee)
+		if err != nil {
+			return err
+		}
+		if total >= needed {
+			p.Inputs = i + 1
+			p.Fee = fee
+			p.Change = total - needed
+			return nil
+		}
+	}
+	return ErrInsufficientFunds
+}
+
+func sendBalanceAfter(p SendPreviewStruct) (Amount, error) {
+	spent, err := p.Amount.Add(p.Fee)
+	if err != nil {
+		return 0, err
+	}
+	return p.Balance.Sub(spent)
+}
+
+// Send - Sends the amount to the address and returns the txid. If the wallet is locked, it's unlocked with passphrase
+// for cSendUnlockSeconds and returned to its previous state afterwards. If that fails once the coins have been sent,
+// the result is returned along with an error wrapping ErrWalletRelockFailed. With DryRun, only the preview is returned
+func (c *CoinRPCClient) Send(ctx context.Context, req SendRequestStruct, passphrase string) (res SendResultStruct, err error) {
+	preview, err := c.PreviewSend(ctx, req)
+	if err != nil {
+		return SendResultStruct{}, err
+	}
+	res = SendResultStruct{Preview: preview}
+	if req.DryRun {
+		return res, nil
+	}
+
+	ws, err := c.GetWalletSecurityStatus(ctx)
+	if err != nil {
+		return SendResultStruct{}, err
+	}
+	if ws == CWalletStatusLocked || ws == CWalletStatusLockedAndSk {
+		if passphrase == "" {
+			return SendResultStruct{}, ErrWalletPassphraseRequired
+		}
+		if err := c.Call(ctx, "walletpassphrase", []interface{}{passphrase, cSendUnlockSeconds}, nil); err != nil {
+			return SendResultStruct{}, err
+		}
+		defer func() {
+			// A failed send already has an error to return, but a successful one mustn't hide an unlocked wallet
+			if rerr := c.relockWallet(ws, passphrase); rerr != nil && err == nil {
+				res.RelockError = rerr.Error()
+				err = fmt.Errorf("%w: %v", ErrWalletRelockFailed, rerr)
+			}
+		}()
+	}
+
+	if err := c.Call(ctx, "sendtoaddress", []interface{}{preview.Address, preview.Amount}, &res.TxID); err != nil {
+		return SendResultStruct{}, err
+	}
+
+	// The daemon may have picked different inputs, so report the fee actually paid
+	if entries, err := c.GetTransaction(ctx, res.TxID); err == nil {
+		for _, e := range entries {
+			if e.Category == TxCategorySend && e.Fee != 0 {
+				if fee, err := e.Fee.Abs(); err == nil {
+					res.Preview.Change += res.Preview.Fee - fee
+					res.Preview.Fee = fee
+				}
+				break
+			}
+		}
+		if ba, err := sendBalanceAfter(res.Preview); err == nil {
+			res.Preview.BalanceAfter = ba
+		}
+	}
+	return res, nil
+}
+
+// relockWallet - Locks the wallet again, and if it was unlocked for staking only, unlocks it for staking again.
+// It runs even if the send's context has been cancelled, so the wallet isn't left unlocked
+func (c *CoinRPCClient) relockWallet(previous, passphrase string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cRPCTimeout)
+	defer cancel()
+
+	if err := c.Call(ctx, "walletlock", nil, nil); err != nil {
+		return fmt.Errorf("unable to relock the wallet: %v", err)
+	}
+	if previous == CWalletStatusLockedAndSk {
+		return c.Call(ctx, "walletpassphrase", []interface{}{passphrase, 0, true}, nil)
+	}
+	return nil
+}
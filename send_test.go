@@ -0,0 +1,327 @@
+package gwcommon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// rpcStub - A stand-in coin daemon that answers JSON-RPC calls from handlers, and records the calls made
+type rpcStub struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	calls    []string
+	handlers map[string]func(params []interface{}) (interface{}, *RPCError)
+}
+
+func newRPCStub(t *testing.T, handlers map[string]func(params []interface{}) (interface{}, *RPCError)) *rpcStub {
+	s := &rpcStub{handlers: handlers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request: %v", err)
+			return
+		}
+		s.mu.Lock()
+		s.calls = append(s.calls, req.Method)
+		h, ok := s.handlers[req.Method]
+		s.mu.Unlock()
+
+		resp := map[string]interface{}{"id": req.ID}
+		if !ok {
+			// As the daemons do, an error with a 404
+			w.WriteHeader(http.StatusNotFound)
+			resp["error"] = RPCError{Code: cRPCErrMethodNotFound, Message: "Method not found"}
+		} else if result, rerr := h(req.Params); rerr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp["error"] = rerr
+		} else {
+			resp["result"] = result
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *rpcStub) client() *CoinRPCClient {
+	return &CoinRPCClient{ProjectType: PTDivi, URL: s.URL, HTTPClient: s.Client()}
+}
+
+func (s *rpcStub) called() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *rpcStub) wasCalled(method string) bool {
+	for _, c := range s.called() {
+		if c == method {
+			return true
+		}
+	}
+	return false
+}
+
+func rpcResult(v interface{}) func([]interface{}) (interface{}, *RPCError) {
+	return func([]interface{}) (interface{}, *RPCError) { return v, nil }
+}
+
+// sendWallet - The state of the stand-in wallet for the send tests
+type sendWallet struct {
+	mu       sync.Mutex
+	status   string // encryption_status, as Divi reports it
+	feePerKB float64
+}
+
+func newSendStub(t *testing.T, w *sendWallet) *rpcStub {
+	return newRPCStub(t, map[string]func([]interface{}) (interface{}, *RPCError){
+		"validateaddress": func(p []interface{}) (interface{}, *RPCError) {
+			return map[string]bool{"isvalid": p[0] == "DGoodAddress"}, nil
+		},
+		"getnetworkinfo": rpcResult(map[string]float64{"relayfee": 0.0001}),
+		"estimatefee": func([]interface{}) (interface{}, *RPCError) {
+			return w.feePerKB, nil
+		},
+		"getwalletinfo": func([]interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return map[string]interface{}{"balance": 10.5, "paytxfee": 0, "encryption_status": w.status}, nil
+		},
+		"listunspent": rpcResult([]map[string]interface{}{
+			{"amount": 3},
+			{"amount": 5},
+			{"amount": 2.5, "spendable": true},
+			{"amount": 100, "spendable": false},
+		}),
+		"walletpassphrase": func(p []interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if p[0] != "Correct-Horse9battery" {
+				return nil, &RPCError{Code: -14, Message: "Error: The wallet passphrase entered was incorrect."}
+			}
+			if len(p) > 2 && p[2] == true {
+				w.status = CWalletStatusLockedAndSk
+			} else {
+				w.status = CWalletStatusUnlocked
+			}
+			return nil, nil
+		},
+		"walletlock": func([]interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.status = CWalletStatusLocked
+			return nil, nil
+		},
+		"sendtoaddress": func([]interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.status != CWalletStatusUnlocked && w.status != CWalletStatusUnEncrypted {
+				return nil, &RPCError{Code: -13, Message: "Error: Please enter the wallet passphrase with walletpassphrase first."}
+			}
+			return "d1e2f3", nil
+		},
+		"gettransaction": rpcResult(map[string]interface{}{
+			"txid":    "d1e2f3",
+			"details": []map[string]interface{}{{"category": "send", "amount": -6, "fee": -0.00005}},
+		}),
+	})
+}
+
+func TestPreviewSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		feePerKB float64
+		amount   Amount
+		want     SendPreviewStruct
+		wantErr  error
+	}{
+		{
+			// The daemon can't estimate, so the default is used. 5 + 3 covers 6 plus the fee for 2 inputs
+			name:     "default fee",
+			feePerKB: -1,
+			amount:   6e8,
+			want: SendPreviewStruct{
+				Address: "DGoodAddress", Amount: 6e8, Fee: 3740, FeePerKB: 10000, Inputs: 2,
+				Change: 199996260, Balance: 1050000000, BalanceAfter: 449996260,
+			},
+		},
+		{
+			name:     "estimated fee",
+			feePerKB: 0.0002,
+			amount:   4e8,
+			want: SendPreviewStruct{
+				Address: "DGoodAddress", Amount: 4e8, Fee: 4520, FeePerKB: 20000, Inputs: 1,
+				Change: 99995480, Balance: 1050000000, BalanceAfter: 649995480,
+			},
+		},
+		{
+			name:     "fee below the relay fee",
+			feePerKB: 0.00001,
+			amount:   4e8,
+			want: SendPreviewStruct{
+				Address: "DGoodAddress", Amount: 4e8, Fee: 2260, FeePerKB: 10000, Inputs: 1,
+				Change: 99997740, Balance: 1050000000, BalanceAfter: 649997740,
+			},
+		},
+		{
+			// The unspendable 100 isn't counted
+			name:     "insufficient funds",
+			feePerKB: -1,
+			amount:   10.5e8,
+			wantErr:  ErrInsufficientFunds,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSendStub(t, &sendWallet{status: CWalletStatusLocked, feePerKB: tt.feePerKB})
+			got, err := stub.client().PreviewSend(context.Background(), SendRequestStruct{Address: " DGoodAddress ", Amount: tt.amount})
+			if err != tt.wantErr {
+				t.Fatalf("PreviewSend() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PreviewSend() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewSendInvalid(t *testing.T) {
+	stub := newSendStub(t, &sendWallet{status: CWalletStatusLocked, feePerKB: -1})
+	rpc := stub.client()
+	if _, err := rpc.PreviewSend(context.Background(), SendRequestStruct{Address: "DBadAddress", Amount: 1e8}); err != ErrInvalidAddress {
+		t.Errorf("PreviewSend() error = %v, want %v", err, ErrInvalidAddress)
+	}
+	if _, err := rpc.PreviewSend(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 0}); err == nil {
+		t.Error("PreviewSend() with a zero amount should fail")
+	}
+}
+
+func TestSendDryRun(t *testing.T) {
+	stub := newSendStub(t, &sendWallet{status: CWalletStatusLocked, feePerKB: -1})
+	res, err := stub.client().Send(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 6e8, DryRun: true}, "Correct-Horse9battery")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if res.TxID != "" {
+		t.Errorf("TxID = %q, a dry run shouldn't send", res.TxID)
+	}
+	if res.Preview.Fee != 3740 || res.Preview.Change != 199996260 || res.Preview.BalanceAfter != 449996260 {
+		t.Errorf("Preview = %+v", res.Preview)
+	}
+	for _, m := range []string{"sendtoaddress", "walletpassphrase", "walletlock"} {
+		if stub.wasCalled(m) {
+			t.Errorf("a dry run called %v, calls: %v", m, stub.called())
+		}
+	}
+}
+
+func TestSendRelocks(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		wantCalls  []string
+		wantStatus string
+	}{
+		{
+			name:       "locked",
+			status:     CWalletStatusLocked,
+			wantCalls:  []string{"walletpassphrase", "sendtoaddress", "walletlock"},
+			wantStatus: CWalletStatusLocked,
+		},
+		{
+			// Unlocked for staking only, so it's unlocked for staking again afterwards
+			name:       "staking only",
+			status:     CWalletStatusLockedAndSk,
+			wantCalls:  []string{"walletpassphrase", "sendtoaddress", "walletlock", "walletpassphrase"},
+			wantStatus: CWalletStatusLockedAndSk,
+		},
+		{
+			name:       "unencrypted",
+			status:     CWalletStatusUnEncrypted,
+			wantCalls:  []string{"sendtoaddress"},
+			wantStatus: CWalletStatusUnEncrypted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &sendWallet{status: tt.status, feePerKB: -1}
+			stub := newSendStub(t, w)
+			res, err := stub.client().Send(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 6e8}, "Correct-Horse9battery")
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if res.TxID != "d1e2f3" {
+				t.Errorf("TxID = %q, want %q", res.TxID, "d1e2f3")
+			}
+			// The fee is the one the daemon actually charged
+			if res.Preview.Fee != 5000 || res.Preview.Change != 199995000 || res.Preview.BalanceAfter != 449995000 {
+				t.Errorf("Preview = %+v", res.Preview)
+			}
+
+			var got []string
+			for _, c := range stub.called() {
+				switch c {
+				case "walletpassphrase", "walletlock", "sendtoaddress":
+					got = append(got, c)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+			if w.status != tt.wantStatus {
+				t.Errorf("wallet left %v, want %v", w.status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSendRelockFails(t *testing.T) {
+	w := &sendWallet{status: CWalletStatusLocked, feePerKB: -1}
+	stub := newSendStub(t, w)
+	stub.mu.Lock()
+	stub.handlers["walletlock"] = func([]interface{}) (interface{}, *RPCError) {
+		return nil, &RPCError{Code: -1, Message: "walletlock failed"}
+	}
+	stub.mu.Unlock()
+
+	res, err := stub.client().Send(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 6e8}, "Correct-Horse9battery")
+	if !errors.Is(err, ErrWalletRelockFailed) {
+		t.Fatalf("Send() error = %v, want %v", err, ErrWalletRelockFailed)
+	}
+	// The coins have gone, so the txid is still returned
+	if res.TxID != "d1e2f3" || res.RelockError == "" {
+		t.Errorf("Send() = %+v, want the txid and a RelockError", res)
+	}
+	if w.status != CWalletStatusUnlocked {
+		t.Errorf("wallet status = %v, the stub should have left it unlocked", w.status)
+	}
+}
+
+func TestSendLockedWithoutPassphrase(t *testing.T) {
+	stub := newSendStub(t, &sendWallet{status: CWalletStatusLocked, feePerKB: -1})
+	if _, err := stub.client().Send(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 6e8}, ""); err != ErrWalletPassphraseRequired {
+		t.Errorf("Send() error = %v, want %v", err, ErrWalletPassphraseRequired)
+	}
+	if stub.wasCalled("sendtoaddress") {
+		t.Error("Send() shouldn't try to send from a locked wallet")
+	}
+}
+
+func TestSendWrongPassphrase(t *testing.T) {
+	w := &sendWallet{status: CWalletStatusLocked, feePerKB: -1}
+	stub := newSendStub(t, w)
+	_, err := stub.client().Send(context.Background(), SendRequestStruct{Address: "DGoodAddress", Amount: 6e8}, "wrong")
+	if !IsRPCError(err, -14) {
+		t.Errorf("Send() error = %v, want the daemon's passphrase error", err)
+	}
+	if stub.wasCalled("sendtoaddress") || w.status != CWalletStatusLocked {
+		t.Errorf("calls = %v, wallet %v", stub.called(), w.status)
+	}
+}
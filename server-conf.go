@@ -19,7 +19,7 @@ type ServerConfStruct struct {
 	FirstTimeRun              bool        // Is this the first time the server has run? If so, we need to store the BinFolder
 	ProjectType               ProjectType // The project type
 	Port                      string      // The port that the server should run on
-	Token                     string      // Stored after generation and is checked to be equal with the clients
+	Token                     string      // Legacy single client token, moved into CServerTokensFile by MigrateLegacyServerToken
 	UserConfirmedSeedRecovery bool        // Whether or not the user has said they've stored their recovery seed has been stored
 }
 
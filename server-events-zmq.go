@@ -0,0 +1,210 @@
+package gwcommon
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	cZMQRetryInterval        = 5 * time.Second
+	cZMQDialTimeout          = 10 * time.Second
+	cZMQMaxFrameSize  uint64 = 1 << 20
+
+	// ZMTP frame flags
+	cZMTPFlagMore    byte = 0x01
+	cZMTPFlagLong    byte = 0x02
+	cZMTPFlagCommand byte = 0x04
+)
+
+// ZMQEventSource - A WalletEventSource which listens for the daemon's ZMQ notifications, enabled with e.g.
+// zmqpubhashblock=tcp://127.0.0.1:28332 and zmqpubhashtx=tcp://127.0.0.1:28332 in the coin conf file, and makes
+// Poller poll straight away rather than waiting for its next interval. Only the ZMTP 3 NULL mechanism is supported
+type ZMQEventSource struct {
+	Address string   // e.g. tcp://127.0.0.1:28332
+	Topics  []string // Defaults to hashblock and hashtx
+	Poller  *RPCEventPoller
+}
+
+// Run - Listens for notifications until ctx is done, reconnecting if the daemon goes away
+func (z *ZMQEventSource) Run(ctx context.Context, b *EventBroker) error {
+	topics := z.Topics
+	if len(topics) == 0 {
+		topics = []string{"hashblock", "hashtx"}
+	}
+	addr := strings.TrimPrefix(z.Address, "tcp://")
+
+	for {
+		err := z.listen(ctx, addr, topics)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// The poller will report the daemon being down, so just keep trying
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(cZMQRetryInterval):
+			}
+		}
+	}
+}
+
+func (z *ZMQEventSource) listen(ctx context.Context, addr string, topics []string) error {
+	d := net.Dialer{Timeout: cZMQDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the read below when we're cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	if err := zmtpHandshakeSUB(conn, r, topics); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := zmtpReadMessage(r); err != nil {
+			return err
+		}
+		select {
+		case z.Poller.Trigger <- struct{}{}:
+		default:
+			// A poll is already pending
+		}
+	}
+}
+
+// zmtpHandshakeSUB - Exchanges greetings and READY commands as a SUB socket, then subscribes to the topics
+func zmtpHandshakeSUB(w io.Writer, r io.Reader, topics []string) error {
+	greeting := make([]byte, 64)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3 // Version 3.0
+	copy(greeting[12:32], "NULL")
+	if _, err := w.Write(greeting); err != nil {
+		return err
+	}
+
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(r, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f || peer[10] < 3 {
+		return errors.New("zmq: the peer does not speak ZMTP 3")
+	}
+	if mech := strings.TrimRight(string(peer[12:32]), "\x00"); mech != "NULL" {
+		return fmt.Errorf("zmq: unsupported security mechanism %v", mech)
+	}
+
+	ready := []byte{5}
+	ready = append(ready, "READY"...)
+	ready = append(ready, zmtpProperty("Socket-Type", "SUB")...)
+	if err := zmtpWriteFrame(w, cZMTPFlagCommand, ready); err != nil {
+		return err
+	}
+
+	flags, body, err := zmtpReadFrame(r)
+	if err != nil {
+		return err
+	}
+	if flags&cZMTPFlagCommand == 0 || len(body) < 6 || string(body[1:6]) != "READY" {
+		return errors.New("zmq: expected a READY command from the peer")
+	}
+
+	for _, t := range topics {
+		if err := zmtpWriteFrame(w, 0, append([]byte{1}, t...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zmtpReadMessage - Reads the frames of the next message, skipping any commands
+func zmtpReadMessage(r io.Reader) ([][]byte, error) {
+	var parts [][]byte
+	for {
+		flags, body, err := zmtpReadFrame(r)
+		if err != nil {
+			return nil, err
+		}
+		if flags&cZMTPFlagCommand != 0 {
+			continue
+		}
+		parts = append(parts, body)
+		if flags&cZMTPFlagMore == 0 {
+			return parts, nil
+		}
+	}
+}
+
+func zmtpReadFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [1]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	flags := hdr[0]
+
+	var size uint64
+	if flags&cZMTPFlagLong != 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	} else {
+		var b [1]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b[0])
+	}
+	if size > cZMQMaxFrameSize {
+		return 0, nil, fmt.Errorf("zmq: frame of %d bytes is too large", size)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+func zmtpWriteFrame(w io.Writer, flags byte, body []byte) error {
+	var hdr []byte
+	if len(body) > 255 {
+		hdr = make([]byte, 9)
+		hdr[0] = flags | cZMTPFlagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+	} else {
+		hdr = []byte{flags, byte(len(body))}
+	}
+	_, err := w.Write(append(hdr, body...))
+	return err
+}
+
+func zmtpProperty(name, value string) []byte {
+	b := []byte{byte(len(name))}
+	b = append(b, name...)
+	var vl [4]byte
+	binary.BigEndian.PutUint32(vl[:], uint32(len(value)))
+	b = append(b, vl[:]...)
+	return append(b, value...)
+}
@@ -0,0 +1,362 @@
+package gwcommon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	cEventHistorySize     int = 1000
+	cEventSubscriberQueue int = 64
+	cEventHeartbeat           = 15 * time.Second
+	cEventPollInterval        = 10 * time.Second
+	cEventPollTxCount     int = 25
+	// Sync progress changes smaller than this aren't worth an event
+	cEventSyncProgressStep float64 = 0.0001
+)
+
+// WalletEventType - The kind of WalletEvent
+type WalletEventType string
+
+const (
+	// WETNewBlock - The daemon has a new best block, Data is a NewBlockEventStruct
+	WETNewBlock WalletEventType = "NewBlock"
+	// WETSyncProgress - The blockchain sync progress has changed, Data is a SyncProgressEventStruct
+	WETSyncProgress WalletEventType = "SyncProgress"
+	// WETIncomingTx - The wallet has received a transaction, Data is a TxEventStruct
+	WETIncomingTx WalletEventType = "IncomingTransaction"
+	// WETStakeReward - The wallet has earned a stake reward, Data is a TxEventStruct
+	WETStakeReward WalletEventType = "StakeReward"
+	// WETWalletLockState - The wallet has been locked or unlocked, Data is a WalletStatusRespStruct
+	WETWalletLockState WalletEventType = "WalletLockState"
+	// WETMasternodeStatus - One of the wallet's masternodes has changed status, Data is a MasternodeStatusChangeStruct
+	WETMasternodeStatus WalletEventType = "MasternodeStatus"
+	// WETDaemonUp - The coin daemon is responding
+	WETDaemonUp WalletEventType = "DaemonUp"
+	// WETDaemonDown - The coin daemon has stopped responding
+	WETDaemonDown WalletEventType = "DaemonDown"
+	// WETResync - The events since the ID the client resumed from are no longer available, so it should refresh everything
+	WETResync WalletEventType = "Resync"
+)
+
+// WalletEvent - An event sent to subscribed clients
+type WalletEvent struct {
+	ID   uint64
+	Type WalletEventType
+	Time time.Time
+	Data json.RawMessage `json:",omitempty"`
+}
+
+// NewBlockEventStruct - Data of WETNewBlock
+type NewBlockEventStruct struct {
+	Height int64
+	Hash   string
+}
+
+// SyncProgressEventStruct - Data of WETSyncProgress
+type SyncProgressEventStruct struct {
+	Progress float64 // 0 to 1
+}
+
+// TxEventStruct - Data of WETIncomingTx and WETStakeReward
+type TxEventStruct struct {
+	TxID          string
+	Address       string
+	Category      string
+	Amount        Amount
+	Confirmations int64
+}
+
+// EventBroker - Keeps recent wallet events and fans them out to subscribers
+type EventBroker struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []WalletEvent
+	subs    map[chan WalletEvent]struct{}
+}
+
+// NewEventBroker - Returns an empty EventBroker
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subs: make(map[chan WalletEvent]struct{})}
+}
+
+// Publish - Sends an event of type et with data, which is marshalled to JSON, to all subscribers
+func (b *EventBroker) Publish(et WalletEventType, data interface{}) (WalletEvent, error) {
+	ev := WalletEvent{Type: et, Time: time.Now()}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return WalletEvent{}, err
+		}
+		ev.Data = raw
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	ev.ID = b.lastID
+	b.history = append(b.history, ev)
+	if len(b.history) > cEventHistorySize {
+		b.history = b.history[len(b.history)-cEventHistorySize:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			// The subscriber isn't keeping up, so drop it. It can reconnect and resume from its last event ID
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ev, nil
+}
+
+// Subscribe - Returns the events after lastID that are still held, followed by a channel of new events. The channel
+// is closed if the subscriber falls too far behind. cancel must be called once finished with
+func (b *EventBroker) Subscribe(lastID uint64) (backlog []WalletEvent, events <-chan WalletEvent, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case lastID == 0 || lastID == b.lastID:
+	case lastID > b.lastID || b.history[0].ID > lastID+1:
+		// Either the events have been dropped from the history, or the server has restarted since
+		backlog = append(backlog, WalletEvent{Type: WETResync, Time: time.Now()})
+	default:
+		for _, ev := range b.history {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	ch := make(chan WalletEvent, cEventSubscriberQueue)
+	b.subs[ch] = struct{}{}
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// handleEvents - Streams events to the client as Server-Sent Events, resuming after the Last-Event-ID header if sent
+func (s *WalletServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.Events == nil {
+		writeServerResponse(w, CWalletRequestEvents, nil, &serverError{UnknownRequest, fmt.Errorf("events are not enabled on this server")})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeServerResponse(w, CWalletRequestEvents, nil, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	var lastID uint64
+	if sid := r.Header.Get("Last-Event-ID"); sid != "" {
+		id, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			writeServerResponse(w, CWalletRequestEvents, nil, &serverError{MalformedRequest, fmt.Errorf("invalid Last-Event-ID: %v", sid)})
+			return
+		}
+		lastID = id
+	}
+
+	backlog, events, cancel := s.Events.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, ev := range backlog {
+		if err := writeSSEEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	shutdown := s.shuttingDown()
+	hb := time.NewTicker(cEventHeartbeat)
+	defer hb.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shutdown:
+			return
+		case <-hb.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeSSEEvent(w, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev WalletEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// A resync isn't a real event, so don't let the client resume from it
+	if ev.Type != WETResync {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b)
+	return err
+}
+
+// WalletEventSource - Feeds wallet events into an EventBroker until ctx is done
+type WalletEventSource interface {
+	Run(ctx context.Context, b *EventBroker) error
+}
+
+// RPCEventPoller - A WalletEventSource which polls the coin daemon over RPC, and polls immediately whenever
+// something is sent on Trigger, e.g. by a ZMQEventSource
+type RPCEventPoller struct {
+	RPC      *CoinRPCClient
+	Interval time.Duration
+	Trigger  chan struct{}
+
+	daemonUp  *bool
+	height    int64
+	progress  float64
+	walletSt  string
+	seenTxs   map[string]bool
+	txsSeeded bool
+}
+
+// NewRPCEventPoller - Returns a poller using rpc, polling every cEventPollInterval
+func NewRPCEventPoller(rpc *CoinRPCClient) *RPCEventPoller {
+	return &RPCEventPoller{
+		RPC:      rpc,
+		Interval: cEventPollInterval,
+		Trigger:  make(chan struct{}, 1),
+		seenTxs:  make(map[string]bool),
+		progress: -1,
+	}
+}
+
+// Run - Polls the daemon until ctx is done
+func (p *RPCEventPoller) Run(ctx context.Context, b *EventBroker) error {
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+	for {
+		p.poll(ctx, b)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		case <-p.Trigger:
+		}
+	}
+}
+
+func (p *RPCEventPoller) poll(ctx context.Context, b *EventBroker) {
+	ctx, cancel := context.WithTimeout(ctx, cServerWalletTimeout)
+	defer cancel()
+
+	var bci struct {
+		Blocks               int64   `json:"blocks"`
+		BestBlockHash        string  `json:"bestblockhash"`
+		VerificationProgress float64 `json:"verificationprogress"`
+	}
+	err := p.RPC.Call(ctx, "getblockchaininfo", nil, &bci)
+
+	// Any reply from the daemon, even an error such as still warming up, means it's running
+	var rerr *RPCError
+	up := err == nil || errors.As(err, &rerr)
+	if p.daemonUp == nil || *p.daemonUp != up {
+		p.daemonUp = &up
+		if up {
+			b.Publish(WETDaemonUp, nil)
+		} else {
+			b.Publish(WETDaemonDown, nil)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if bci.Blocks != p.height {
+		p.height = bci.Blocks
+		b.Publish(WETNewBlock, NewBlockEventStruct{Height: bci.Blocks, Hash: bci.BestBlockHash})
+	}
+	if math.Abs(bci.VerificationProgress-p.progress) >= cEventSyncProgressStep {
+		p.progress = bci.VerificationProgress
+		b.Publish(WETSyncProgress, SyncProgressEventStruct{Progress: bci.VerificationProgress})
+	}
+
+	if ws, err := p.RPC.GetWalletSecurityStatus(ctx); err == nil && ws != p.walletSt {
+		p.walletSt = ws
+		b.Publish(WETWalletLockState, WalletStatusRespStruct{WalletStatus: ws})
+	}
+
+	p.pollTransactions(ctx, b)
+}
+
+func (p *RPCEventPoller) pollTransactions(ctx context.Context, b *EventBroker) {
+	var txs []struct {
+		TxID          string `json:"txid"`
+		Address       string `json:"address"`
+		Category      string `json:"category"`
+		Amount        Amount `json:"amount"`
+		Confirmations int64  `json:"confirmations"`
+		Vout          int    `json:"vout"`
+	}
+	if err := p.RPC.Call(ctx, "listtransactions", []interface{}{"*", cEventPollTxCount}, &txs); err != nil {
+		return
+	}
+
+	// Only the latest transactions are listed, so once one drops off it won't be seen again and can be forgotten
+	seen := make(map[string]bool, len(txs))
+	defer func() {
+		p.seenTxs = seen
+		p.txsSeeded = true
+	}()
+
+	for _, tx := range txs {
+		key := fmt.Sprintf("%s:%d", tx.TxID, tx.Vout)
+		seen[key] = true
+		// The first poll only records what's already there, so old transactions aren't reported as new
+		if p.seenTxs[key] || !p.txsSeeded {
+			continue
+		}
+
+		te := TxEventStruct{
+			TxID:          tx.TxID,
+			Address:       tx.Address,
+			Category:      tx.Category,
+			Amount:        tx.Amount,
+			Confirmations: tx.Confirmations,
+		}
+		switch tx.Category {
+		case "receive":
+			b.Publish(WETIncomingTx, te)
+		case "generate", "immature", "stake", "stake_reward":
+			b.Publish(WETStakeReward, te)
+		}
+	}
+}
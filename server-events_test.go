@@ -0,0 +1,95 @@
+package gwcommon
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamEndsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	tokens, err := LoadTokenStore(filepath.Join(dir, CServerTokensFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := tokens.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := tokens.Pair(code, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile, err := EnsureServerCertificate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A free port, for ListenAndServeTLS to listen on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	s := NewWalletServer(ServerConfStruct{Port: port}, nil, tokens)
+	s.Events = NewEventBroker()
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServeTLS(certFile, keyFile) }()
+
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	req, err := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+port+cServerAPIPathWallet+CWalletRequestEvents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var resp *http.Response
+	for start := time.Now(); ; time.Sleep(20 * time.Millisecond) {
+		if resp, err = hc.Do(req); err == nil || time.Since(start) > 5*time.Second {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %v, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// The stream is live
+	if _, err := s.Events.Publish(WETDaemonUp, nil); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "id: 1\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v, with a client still subscribed", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("ListenAndServeTLS() error = %v", err)
+	}
+	// The client sees the stream end
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil && !strings.Contains(err.Error(), "closed") {
+		t.Errorf("reading the rest of the stream: %v", err)
+	}
+
+	// Shutting down again is harmless
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() again error = %v", err)
+	}
+}
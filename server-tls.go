@@ -0,0 +1,131 @@
+package gwcommon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// CServerCertFile - The server's self-signed TLS certificate, stored alongside server.yaml
+	CServerCertFile string = "server-cert.pem"
+	// CServerKeyFile - The private key of CServerCertFile
+	CServerKeyFile string = "server-key.pem"
+
+	cServerCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+// CertFingerprintMismatchError - The server presented a different certificate to the one pinned on first pairing
+type CertFingerprintMismatchError struct {
+	Expected string
+	Got      string
+}
+
+func (e *CertFingerprintMismatchError) Error() string {
+	return fmt.Sprintf("the server's certificate fingerprint %v does not match the %v recorded when this client was paired. "+
+		"Either the server's certificate has been regenerated, or something is intercepting the connection. "+
+		"If you're sure it's the former, clear ServerCertFingerprint in %v%v and pair again", e.Got, e.Expected, CCLIConfFile, CCLIConfFileExt)
+}
+
+// EnsureServerCertificate - Returns the certificate and key files in dir, generating them first if they don't exist
+func EnsureServerCertificate(dir string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, CServerCertFile)
+	keyFile = filepath.Join(dir, CServerKeyFile)
+	if FileExists(certFile) && FileExists(keyFile) {
+		return certFile, keyFile, nil
+	}
+	if err := GenerateServerCertificate(certFile, keyFile); err != nil {
+		return "", "", fmt.Errorf("unable to generate server certificate: %v", err)
+	}
+	return certFile, keyFile, nil
+}
+
+// GenerateServerCertificate - Creates a self-signed ECDSA P-256 certificate valid for this host's names and addresses
+func GenerateServerCertificate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(cServerCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, hostname)
+	}
+	// Include the LAN addresses, so clients that do check names can connect by IP
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipn, ok := a.(*net.IPNet); ok && !ipn.IP.IsLoopback() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ipn.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// CertFingerprint - Returns the SHA256 fingerprint of the DER encoded certificate, as colon separated hex
+func CertFingerprint(der []byte) string {
+	h := sha256.Sum256(der)
+	s := strings.ToUpper(hex.EncodeToString(h[:]))
+	var parts []string
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, s[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// CertFileFingerprint - Returns the fingerprint of the PEM certificate file, for the server to display when pairing
+func CertFileFingerprint(certFile string) (string, error) {
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", errors.New("no certificate found in " + certFile)
+	}
+	return CertFingerprint(block.Bytes), nil
+}
@@ -0,0 +1,282 @@
+package gwcommon
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// CServerTokensFile - Stores the hashed client tokens, alongside server.yaml
+	CServerTokensFile string = "server-tokens.json"
+
+	cPairingCodeDigits    int    = 6
+	cPairingCodeTTL              = 5 * time.Minute
+	cPairingMaxAttempts   int    = 5
+	cClientIDBytes        int    = 8
+	cLastSeenSaveInterval        = time.Minute
+	cLegacyClientName     string = "Legacy client"
+)
+
+var (
+	// ErrPairingCodeInvalid - The pairing code was wrong, has expired or has already been used
+	ErrPairingCodeInvalid = errors.New("the pairing code is invalid or has expired, please generate a new one on the server")
+	// ErrTokenClientNotFound - There's no client with the ID given
+	ErrTokenClientNotFound = errors.New("client not found")
+)
+
+// TokenClient - A client that has paired with the server. Only a hash of its token is kept
+type TokenClient struct {
+	ID        string
+	Name      string
+	TokenHash string
+	Created   time.Time
+	LastSeen  time.Time
+}
+
+type pairingCode struct {
+	code     string
+	expires  time.Time
+	attempts int
+}
+
+// TokenStore - Issues, checks and revokes the tokens of clients paired with the server
+type TokenStore struct {
+	file      string
+	mu        sync.Mutex
+	clients   []TokenClient
+	pairing   *pairingCode
+	lastSaved time.Time
+	now       func() time.Time
+}
+
+// LoadTokenStore - Loads the token store from file, which doesn't need to exist yet
+func LoadTokenStore(file string) (*TokenStore, error) {
+	ts := &TokenStore{file: file, now: time.Now}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &ts.clients); err != nil {
+		return nil, fmt.Errorf("unable to read token store %v: %v", file, err)
+	}
+	return ts, nil
+}
+
+// Clients - Returns the paired clients
+func (ts *TokenStore) Clients() []TokenClient {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]TokenClient(nil), ts.clients...)
+}
+
+// StartPairing - Creates a short single use code, to be displayed by the server and entered on the new client.
+// Any previous code stops working
+func (ts *TokenStore) StartPairing() (string, time.Time, error) {
+	max := big.NewInt(1)
+	for i := 0; i < cPairingCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.pairing = &pairingCode{
+		code:    fmt.Sprintf("%0*d", cPairingCodeDigits, n),
+		expires: ts.now().Add(cPairingCodeTTL),
+	}
+	return ts.pairing.code, ts.pairing.expires, nil
+}
+
+// Pair - Exchanges the pairing code for a new token for the client called name
+func (ts *TokenStore) Pair(code, name string) (string, TokenClient, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	p := ts.pairing
+	if p == nil || ts.now().After(p.expires) {
+		ts.pairing = nil
+		return "", TokenClient{}, ErrPairingCodeInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(p.code)) != 1 {
+		// Limit the guesses, as there are only a million possible codes
+		p.attempts++
+		if p.attempts >= cPairingMaxAttempts {
+			ts.pairing = nil
+		}
+		return "", TokenClient{}, ErrPairingCodeInvalid
+	}
+	ts.pairing = nil
+
+	token, err := randomHex(cServerTokenBytes)
+	if err != nil {
+		return "", TokenClient{}, err
+	}
+	tc, err := ts.addClient(name, token)
+	if err != nil {
+		return "", TokenClient{}, err
+	}
+	return token, tc, nil
+}
+
+// Authenticate - Returns the client the token belongs to, and records that it's been seen
+func (ts *TokenStore) Authenticate(token string) (TokenClient, bool) {
+	if token == "" {
+		return TokenClient{}, false
+	}
+	h := hashToken(token)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	found := -1
+	// Check every client without stopping early, so the time taken doesn't reveal anything
+	for i := range ts.clients {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(ts.clients[i].TokenHash)) == 1 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return TokenClient{}, false
+	}
+
+	now := ts.now()
+	ts.clients[found].LastSeen = now
+	// Save the last seen times now and then, rather than on every request
+	if now.Sub(ts.lastSaved) >= cLastSeenSaveInterval {
+		ts.save()
+	}
+	return ts.clients[found], true
+}
+
+// Revoke - Removes the client with the ID, so its token no longer works
+func (ts *TokenStore) Revoke(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for i, c := range ts.clients {
+		if c.ID == id {
+			ts.clients = append(ts.clients[:i], ts.clients[i+1:]...)
+			return ts.save()
+		}
+	}
+	return ErrTokenClientNotFound
+}
+
+// ImportLegacyToken - Adds the plain token previously kept in ServerConfStruct.Token, if not already present
+func (ts *TokenStore) ImportLegacyToken(token string) error {
+	if token == "" {
+		return nil
+	}
+	h := hashToken(token)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, c := range ts.clients {
+		if c.TokenHash == h {
+			return nil
+		}
+	}
+	_, err := ts.addClient(cLegacyClientName, token)
+	return err
+}
+
+// MigrateLegacyServerToken - Moves the token in server.yaml into the token store, and removes it from server.yaml
+func MigrateLegacyServerToken(ts *TokenStore) error {
+	conf, err := GetServerConfStruct()
+	if err != nil {
+		return err
+	}
+	if conf.Token == "" {
+		return nil
+	}
+	if err := ts.ImportLegacyToken(conf.Token); err != nil {
+		return err
+	}
+	conf.Token = ""
+	return SetServerConfStruct(conf)
+}
+
+// addClient - Must be called with ts.mu held
+func (ts *TokenStore) addClient(name, token string) (TokenClient, error) {
+	id, err := randomHex(cClientIDBytes)
+	if err != nil {
+		return TokenClient{}, err
+	}
+	now := ts.now()
+	tc := TokenClient{
+		ID:        id,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Created:   now,
+		LastSeen:  now,
+	}
+	ts.clients = append(ts.clients, tc)
+	if err := ts.save(); err != nil {
+		ts.clients = ts.clients[:len(ts.clients)-1]
+		return TokenClient{}, err
+	}
+	return tc, nil
+}
+
+// save - Must be called with ts.mu held
+func (ts *TokenStore) save() error {
+	b, err := json.MarshalIndent(ts.clients, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(ts.file), ".tokens-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ts.file); err != nil {
+		return err
+	}
+	ts.lastSaved = ts.now()
+	return nil
+}
+
+// hashToken - Tokens are long and random, so a plain SHA256 is enough to stop a leaked store being usable
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,184 @@
+package gwcommon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTokenStore(t *testing.T) (*TokenStore, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), CServerTokensFile)
+	ts, err := LoadTokenStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, file
+}
+
+// pairTestClient - Pairs a client called name, and returns its token
+func pairTestClient(t *testing.T, ts *TokenStore, name string) (string, TokenClient) {
+	t.Helper()
+	code, _, err := ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, tc, err := ts.Pair(code, name)
+	if err != nil {
+		t.Fatalf("Pair() error = %v", err)
+	}
+	return token, tc
+}
+
+// wrongCode - A pairing code that isn't code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
+
+func TestTokenStoreHashesTokens(t *testing.T) {
+	ts, file := newTestTokenStore(t)
+	token, tc := pairTestClient(t, ts, "Phone")
+	if len(token) != cServerTokenBytes*2 || tc.Name != "Phone" || tc.ID == "" {
+		t.Errorf("Pair() = %q, %+v", token, tc)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), token) {
+		t.Error("the token store has the token in the clear")
+	}
+	if !strings.Contains(string(b), hashToken(token)) {
+		t.Error("the token store doesn't have the token's hash")
+	}
+	if fi, err := os.Stat(file); err != nil {
+		t.Error(err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("token store mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// Only the token works, not what was stored
+	ts, err = LoadTokenStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ts.Authenticate(token); !ok || got.ID != tc.ID {
+		t.Errorf("Authenticate() = %+v, %v", got, ok)
+	}
+	for _, bad := range []string{"", hashToken(token), strings.ToUpper(token), token[1:]} {
+		if _, ok := ts.Authenticate(bad); ok {
+			t.Errorf("Authenticate(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTokenStoreRevoke(t *testing.T) {
+	ts, file := newTestTokenStore(t)
+	phone, pc := pairTestClient(t, ts, "Phone")
+	laptop, _ := pairTestClient(t, ts, "Laptop")
+
+	if err := ts.Revoke(pc.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if err := ts.Revoke(pc.ID); err != ErrTokenClientNotFound {
+		t.Errorf("Revoke() again error = %v, want %v", err, ErrTokenClientNotFound)
+	}
+
+	// Also once reloaded
+	reloaded, err := LoadTokenStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*TokenStore{ts, reloaded} {
+		if _, ok := s.Authenticate(phone); ok {
+			t.Error("the revoked token still works")
+		}
+		if tc, ok := s.Authenticate(laptop); !ok || tc.Name != "Laptop" {
+			t.Errorf("Authenticate() of the other client = %+v, %v", tc, ok)
+		}
+		if c := s.Clients(); len(c) != 1 || c[0].Name != "Laptop" {
+			t.Errorf("Clients() = %+v", c)
+		}
+	}
+}
+
+func TestTokenStorePairingLockout(t *testing.T) {
+	ts, _ := newTestTokenStore(t)
+
+	// A wrong guess short of the limit leaves the code working
+	code, _, err := ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < cPairingMaxAttempts; i++ {
+		if _, _, err := ts.Pair(wrongCode(code), "Guess"); err != ErrPairingCodeInvalid {
+			t.Fatalf("Pair() guess %d error = %v, want %v", i, err, ErrPairingCodeInvalid)
+		}
+	}
+	if _, _, err := ts.Pair(code, "Phone"); err != nil {
+		t.Fatalf("Pair() after %d wrong guesses error = %v", cPairingMaxAttempts-1, err)
+	}
+	// Each code only works once
+	if _, _, err := ts.Pair(code, "Phone"); err != ErrPairingCodeInvalid {
+		t.Errorf("Pair() with a used code error = %v, want %v", err, ErrPairingCodeInvalid)
+	}
+
+	// Another wrong guess, and the code stops working
+	code, _, err = ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cPairingMaxAttempts; i++ {
+		ts.Pair(wrongCode(code), "Guess")
+	}
+	if _, _, err := ts.Pair(code, "Phone"); err != ErrPairingCodeInvalid {
+		t.Errorf("Pair() after %d wrong guesses error = %v, want %v", cPairingMaxAttempts, err, ErrPairingCodeInvalid)
+	}
+	if c := ts.Clients(); len(c) != 1 {
+		t.Errorf("Clients() = %+v, want only the first pairing", c)
+	}
+}
+
+func TestTokenStorePairingExpires(t *testing.T) {
+	ts, _ := newTestTokenStore(t)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts.now = func() time.Time { return now }
+
+	code, expires, err := ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.Equal(now.Add(cPairingCodeTTL)) || len(code) != cPairingCodeDigits {
+		t.Errorf("StartPairing() = %q, %v", code, expires)
+	}
+	now = now.Add(cPairingCodeTTL + time.Second)
+	if _, _, err := ts.Pair(code, "Phone"); err != ErrPairingCodeInvalid {
+		t.Errorf("Pair() with an expired code error = %v, want %v", err, ErrPairingCodeInvalid)
+	}
+
+	// A new code replaces the old one
+	old, _, err := ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err = ts.StartPairing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != code {
+		if _, _, err := ts.Pair(old, "Phone"); err != ErrPairingCodeInvalid {
+			t.Errorf("Pair() with the replaced code error = %v, want %v", err, ErrPairingCodeInvalid)
+		}
+	}
+	if _, _, err := ts.Pair(code, "Phone"); err != nil {
+		t.Errorf("Pair() error = %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	// Sync progress below this is treated as not synced, as the daemons rarely report exactly 1
+	cStakingSyncedProgress float64 = 0.9999
+)
+
+// StakingInactiveReason - Why the wallet isn't staking
+type StakingInactiveReason string
+
+const (
+	SIRNone            StakingInactiveReason = ""
+	SIRWalletLocked    StakingInactiveReason = "WalletLocked"
+	SIRNotSynced       StakingInactiveReason = "NotSynced"
+	SIRNoPeers         StakingInactiveReason = "NoPeers"
+	SIRNoMatureCoins   StakingInactiveReason = "NoMatureCoins"
+	SIRNotEnoughCoins  StakingInactiveReason = "NotEnoughCoins"
+	SIRStakingDisabled StakingInactiveReason = "StakingDisabled"
+	SIRUnknown         StakingInactiveReason = "Unknown"
+)
+
+// Description - A sentence explaining the reason to the user
+func (r StakingInactiveReason) Description() string {
+	switch r {
+	case SIRNone:
+		return "The wallet is staking"
+	case SIRWalletLocked:
+		return "The wallet is locked, unlock it for staking"
+	case SIRNotSynced:
+		return "The wallet is still syncing"
+	case SIRNoPeers:
+		return "The wallet has no connections to other nodes"
+	case SIRNoMatureCoins:
+		return "The wallet has no coins old enough to stake yet"
+	case SIRNotEnoughCoins:
+		return "The wallet doesn't have enough coins to stake"
+	case SIRStakingDisabled:
+		return "Staking is disabled in the coin conf file"
+	default:
+		return "The wallet isn't staking, but the daemon didn't say why"
+	}
+}
+
+// StakingStatusStruct - The staking status, normalised across the coins
+type StakingStatusStruct struct {
+	Staking         bool
+	Reason          StakingInactiveReason // SIRNone when Staking
+	WalletUnlocked  bool                  // Including unlocked for staking only
+	HaveConnections bool
+	Synced          bool
+	MintableCoins   bool
+}
+
+// RewardPeriod - The length of the buckets returned by AggregateStakingRewards
+type RewardPeriod string
+
+const (
+	RPDay   RewardPeriod = "day"
+	RPWeek  RewardPeriod = "week" // Starting on a Monday
+	RPMonth RewardPeriod = "month"
+)
+
+// StakingRewardsStruct - The rewards earned during a period
+type StakingRewardsStruct struct {
+	Start      time.Time
+	Stake      Amount
+	Masternode Amount
+	Total      Amount
+	Count      int
+}
+
+// GetStakingStatus - Returns whether the wallet is staking, and if not, why not
+func (c *CoinRPCClient) GetStakingStatus(ctx context.Context) (StakingStatusStruct, error) {
+	switch c.ProjectType {
+	case PTDivi, PTPhore, PTPIVX:
+		return c.getStakingStatus(ctx)
+	case PTTrezarcoin:
+		return c.getStakingInfo(ctx)
+	default:
+		return StakingStatusStruct{}, errors.New("unable to determine ProjectType")
+	}
+}
+
+// getStakingStatus - Divi, Phore and older PIVX use "staking status" and "mintablecoins", newer PIVX uses
+// "staking_status" and "stakeablecoins"
+func (c *CoinRPCClient) getStakingStatus(ctx context.Context) (StakingStatusStruct, error) {
+	var gss struct {
+		StakingStatus   *bool `json:"staking status"`
+		StakingStatusV2 *bool `json:"staking_status"`
+		StakingEnabled  *bool `json:"staking_enabled"`
+		HaveConnections bool  `json:"haveconnections"`
+		WalletUnlocked  bool  `json:"walletunlocked"`
+		MintableCoins   *bool `json:"mintablecoins"`
+		StakeableCoins  *int  `json:"stakeablecoins"`
+		EnoughCoins     *bool `json:"enoughcoins"`
+		MNSync          bool  `json:"mnsync"`
+	}
+	if err := c.Call(ctx, "getstakingstatus", nil, &gss); err != nil {
+		return StakingStatusStruct{}, err
+	}
+
+	ss := StakingStatusStruct{
+		WalletUnlocked:  gss.WalletUnlocked,
+		HaveConnections: gss.HaveConnections,
+		Synced:          gss.MNSync,
+		MintableCoins:   (gss.MintableCoins != nil && *gss.MintableCoins) || (gss.StakeableCoins != nil && *gss.StakeableCoins > 0),
+	}
+	switch {
+	case gss.StakingStatus != nil:
+		ss.Staking = *gss.StakingStatus
+	case gss.StakingStatusV2 != nil:
+		ss.Staking = *gss.StakingStatusV2
+	}
+
+	switch {
+	case ss.Staking:
+	case gss.StakingEnabled != nil && !*gss.StakingEnabled:
+		ss.Reason = SIRStakingDisabled
+	default:
+		ss.Reason = stakingInactiveReason(ss, gss.EnoughCoins == nil || *gss.EnoughCoins)
+	}
+	return ss, nil
+}
+
+// getStakingInfo - Trezarcoin only reports whether it's staking, so the reason is worked out from the other calls
+func (c *CoinRPCClient) getStakingInfo(ctx context.Context) (StakingStatusStruct, error) {
+	var gsi struct {
+		Enabled bool  `json:"enabled"`
+		Staking bool  `json:"staking"`
+		Weight  int64 `json:"weight"`
+	}
+	if err := c.Call(ctx, "getstakinginfo", nil, &gsi); err != nil {
+		return StakingStatusStruct{}, err
+	}
+	ss := StakingStatusStruct{Staking: gsi.Staking, MintableCoins: gsi.Weight > 0}
+
+	ws, err := c.GetWalletSecurityStatus(ctx)
+	if err != nil {
+		return StakingStatusStruct{}, err
+	}
+	ss.WalletUnlocked = ws != CWalletStatusLocked
+
+	var conns int
+	if err := c.Call(ctx, "getconnectioncount", nil, &conns); err != nil {
+		return StakingStatusStruct{}, err
+	}
+	ss.HaveConnections = conns > 0
+
+	var bci struct {
+		InitialBlockDownload bool    `json:"initialblockdownload"`
+		VerificationProgress float64 `json:"verificationprogress"`
+	}
+	if err := c.Call(ctx, "getblockchaininfo", nil, &bci); err != nil {
+		return StakingStatusStruct{}, err
+	}
+	ss.Synced = !bci.InitialBlockDownload && bci.VerificationProgress >= cStakingSyncedProgress
+
+	switch {
+	case ss.Staking:
+	case !gsi.Enabled:
+		ss.Reason = SIRStakingDisabled
+	default:
+		ss.Reason = stakingInactiveReason(ss, true)
+	}
+	return ss, nil
+}
+
+// stakingInactiveReason - Picks the reason the user can most easily do something about first
+func stakingInactiveReason(ss StakingStatusStruct, enoughCoins bool) StakingInactiveReason {
+	switch {
+	case !ss.WalletUnlocked:
+		return SIRWalletLocked
+	case !ss.HaveConnections:
+		return SIRNoPeers
+	case !ss.Synced:
+		return SIRNotSynced
+	case !enoughCoins:
+		return SIRNotEnoughCoins
+	case !ss.MintableCoins:
+		return SIRNoMatureCoins
+	default:
+		return SIRUnknown
+	}
+}
+
+// GetStakingRewards - Returns the stake and masternode rewards between from and to, totalled per period
+func (c *CoinRPCClient) GetStakingRewards(ctx context.Context, from, to time.Time, period RewardPeriod, loc *time.Location) ([]StakingRewardsStruct, error) {
+	txs, err := c.listTransactions(ctx, TxFilter{
+		Categories: []TxCategory{TxCategoryStake, TxCategoryMasternodeReward},
+		From:       from,
+		To:         to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return AggregateStakingRewards(txs, period, loc)
+}
+
+// AggregateStakingRewards - Totals the stake and masternode rewards in txs per period, in the time zone loc (UTC if
+// nil). Periods without rewards are left out, and the result is oldest first
+func AggregateStakingRewards(txs []WalletTransaction, period RewardPeriod, loc *time.Location) ([]StakingRewardsStruct, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	byStart := make(map[time.Time]*StakingRewardsStruct)
+	var starts []time.Time
+	for _, tx := range txs {
+		if tx.Category != TxCategoryStake && tx.Category != TxCategoryMasternodeReward {
+			continue
+		}
+		start, err := rewardPeriodStart(tx.Time.In(loc), period)
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := byStart[start]
+		if !ok {
+			r = &StakingRewardsStruct{Start: start}
+			byStart[start] = r
+			starts = append(starts, start)
+		}
+		if tx.Category == TxCategoryStake {
+			r.Stake, err = r.Stake.Add(tx.Amount)
+		} else {
+			r.Masternode, err = r.Masternode.Add(tx.Amount)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Total, err = r.Total.Add(tx.Amount); err != nil {
+			return nil, err
+		}
+		r.Count++
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	rewards := make([]StakingRewardsStruct, 0, len(starts))
+	for _, s := range starts {
+		rewards = append(rewards, *byStart[s])
+	}
+	return rewards, nil
+}
+
+func rewardPeriodStart(t time.Time, period RewardPeriod) (time.Time, error) {
+	y, m, d := t.Date()
+	switch period {
+	case RPDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+	case RPWeek:
+		// Go's weeks start on a Sunday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location()), nil
+	case RPMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location()), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown reward period: %v", period)
+	}
+}
+
+// rewardsQuery - Encodes a CWalletRequestGetStakingRewards request
+func rewardsQuery(from, to time.Time, period RewardPeriod, loc *time.Location) url.Values {
+	q := url.Values{}
+	if !from.IsZero() {
+		q.Set("from", from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.UTC().Format(time.RFC3339))
+	}
+	q.Set("period", string(period))
+	if loc != nil {
+		q.Set("tz", loc.String())
+	}
+	return q
+}
+
+// parseRewardsQuery - Decodes a CWalletRequestGetStakingRewards request
+func parseRewardsQuery(q url.Values) (from, to time.Time, period RewardPeriod, loc *time.Location, err error) {
+	f, _, _, err := parseTxQuery(url.Values{"from": q["from"], "to": q["to"]})
+	if err != nil {
+		return time.Time{}, time.Time{}, "", nil, err
+	}
+	period = RewardPeriod(q.Get("period"))
+	if period == "" {
+		period = RPDay
+	}
+	if _, err := rewardPeriodStart(time.Time{}, period); err != nil {
+		return time.Time{}, time.Time{}, "", nil, err
+	}
+	if tz := q.Get("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return time.Time{}, time.Time{}, "", nil, fmt.Errorf("unknown time zone: %v", tz)
+		}
+	}
+	return f.From, f.To, period, loc, nil
+}
@@ -0,0 +1,202 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CSwapFile - Where the swap file is created by default
+	CSwapFile string = "/swapfile"
+	// CFstabFile - The system's filesystem table, which makes the swap file permanent
+	CFstabFile string = "/etc/fstab"
+)
+
+var (
+	// ErrSwapFileExists - There's already a file where the swap file would go
+	ErrSwapFileExists = errors.New("the swap file already exists")
+	// ErrSwapNeedsRoot - Not running as root, and sudo isn't available
+	ErrSwapNeedsRoot = errors.New("root privileges are needed to add swap, please run the script as root")
+	// ErrSwapNeedsPassword - sudo wants a password, which it can't ask for as the commands aren't run on the terminal
+	ErrSwapNeedsPassword = errors.New("sudo needs a password to add swap, please run \"sudo -v\" first, or run the script as root")
+
+	// cSwapSudo - sudo is run non-interactively, so it fails straight away rather than waiting for a password
+	cSwapSudo = []string{"sudo", "-n"}
+)
+
+// SwapStepStruct - One command in a swap plan, with an alternative to run if it fails
+type SwapStepStruct struct {
+	Description string
+	Args        []string
+	Fallback    []string
+}
+
+// SwapPlanStruct - The commands that add enough swap to reach CMinRequiredSwapMB
+type SwapPlanStruct struct {
+	File      string
+	CurrentMB int
+	NeededMB  int // The size of the new swap file, 0 if there's already enough
+	FstabLine string
+	Steps     []SwapStepStruct
+}
+
+// SwapApplyOptions - How ApplySwapPlan runs the plan
+type SwapApplyOptions struct {
+	DryRun bool      // Only return the commands that would be run
+	Prefix []string  // Put in front of each command e.g. sudo -n, detected with DetectSwapPrivilege if nil
+	Out    io.Writer // If set, each command is written here before it's run
+}
+
+// NeededSwapMB - Returns how much more swap is needed to reach CMinRequiredSwapMB
+func NeededSwapMB(mi MemInfoStruct) int {
+	if mi.SwapTotalMB >= CMinRequiredSwapMB {
+		return 0
+	}
+	return CMinRequiredSwapMB - mi.SwapTotalMB
+}
+
+// PlanSwapFile - Works out the steps to create, enable and make permanent a swap file, at file or CSwapFile if blank,
+// big enough to bring the swap up to CMinRequiredSwapMB. fstab is the filesystem table, CFstabFile if blank
+func PlanSwapFile(mi MemInfoStruct, file, fstab string) (SwapPlanStruct, error) {
+	if file == "" {
+		file = CSwapFile
+	}
+	if fstab == "" {
+		fstab = CFstabFile
+	}
+	plan := SwapPlanStruct{File: file, CurrentMB: mi.SwapTotalMB, NeededMB: NeededSwapMB(mi)}
+	if plan.NeededMB == 0 {
+		return plan, nil
+	}
+	if _, err := os.Lstat(file); err == nil {
+		return plan, fmt.Errorf("%v: %w", file, ErrSwapFileExists)
+	}
+	if free, err := diskFreeBytes(filepath.Dir(file)); err == nil && free < uint64(plan.NeededMB)*1024*1024 {
+		return plan, fmt.Errorf("only %d MB is free for a %d MB swap file", free/(1024*1024), plan.NeededMB)
+	}
+
+	mb := strconv.Itoa(plan.NeededMB)
+	plan.FstabLine = file + " none swap sw 0 0"
+	plan.Steps = []SwapStepStruct{
+		{
+			Description: "Create a " + mb + " MB swap file",
+			Args:        []string{"fallocate", "-l", mb + "M", file},
+			// Some filesystems can't fallocate a usable swap file
+			Fallback: []string{"dd", "if=/dev/zero", "of=" + file, "bs=1M", "count=" + mb},
+		},
+		{Description: "Make it readable only by root", Args: []string{"chmod", "600", file}},
+		{Description: "Format it as swap", Args: []string{"mkswap", file}},
+		{Description: "Start using it", Args: []string{"swapon", file}},
+		{
+			Description: "Keep using it after a reboot",
+			Args: []string{"sh", "-c", "grep -qxF " + shellQuote(plan.FstabLine) + " " + shellQuote(fstab) +
+				" || echo " + shellQuote(plan.FstabLine) + " >> " + shellQuote(fstab)},
+		},
+	}
+	return plan, nil
+}
+
+// Script - The plan as a shell script, for the user to run as root
+func (p SwapPlanStruct) Script() string {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	sb.WriteString("# Adds " + strconv.Itoa(p.NeededMB) + " MB of swap, please run as root e.g. sudo sh swap.sh\n")
+	sb.WriteString("set -e\n")
+	for _, s := range p.Steps {
+		sb.WriteString("\n# " + s.Description + "\n")
+		sb.WriteString(shellCommand(s.Args))
+		if len(s.Fallback) > 0 {
+			sb.WriteString(" || " + shellCommand(s.Fallback))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// DetectSwapPrivilege - Returns nothing if running as root, sudo -n if it's available, or ErrSwapNeedsRoot
+func DetectSwapPrivilege() ([]string, error) {
+	if os.Geteuid() == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("sudo"); err == nil {
+		return append([]string(nil), cSwapSudo...), nil
+	}
+	return nil, ErrSwapNeedsRoot
+}
+
+// ApplySwapPlan - Runs the plan's commands, and returns them as they were run. With opts.DryRun nothing is run
+func ApplySwapPlan(ctx context.Context, plan SwapPlanStruct, opts SwapApplyOptions) ([]string, error) {
+	prefix := opts.Prefix
+	if prefix == nil {
+		var err error
+		if prefix, err = DetectSwapPrivilege(); err != nil {
+			if !opts.DryRun {
+				return nil, err
+			}
+			prefix = append([]string(nil), cSwapSudo...)
+		}
+	}
+	if !opts.DryRun && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("adding swap is not supported on %v", runtime.GOOS)
+	}
+
+	var ran []string
+	run := func(args []string) error {
+		cmd := append(append([]string(nil), prefix...), args...)
+		ran = append(ran, shellCommand(cmd))
+		if opts.Out != nil {
+			fmt.Fprintln(opts.Out, shellCommand(cmd))
+		}
+		if opts.DryRun {
+			return nil
+		}
+		c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+		// So sudo's messages can be recognised
+		c.Env = append(os.Environ(), "LC_ALL=C")
+		out, err := c.CombinedOutput()
+		if err != nil && cmd[0] == "sudo" && strings.Contains(string(out), "password is required") {
+			return fmt.Errorf("%v: %w", shellCommand(cmd), ErrSwapNeedsPassword)
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v %s", shellCommand(cmd), err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	for _, s := range plan.Steps {
+		err := run(s.Args)
+		if err != nil && len(s.Fallback) > 0 && !errors.Is(err, ErrSwapNeedsPassword) {
+			err = run(s.Fallback)
+		}
+		if err != nil {
+			return ran, fmt.Errorf("unable to %v: %w", strings.ToLower(s.Description), err)
+		}
+	}
+	return ran, nil
+}
+
+func shellCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote - Quotes s for sh, if it needs it
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
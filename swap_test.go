@@ -0,0 +1,190 @@
+package gwcommon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNeededSwapMB(t *testing.T) {
+	tests := []struct {
+		swapMB int
+		want   int
+	}{
+		{swapMB: 0, want: CMinRequiredSwapMB},
+		{swapMB: 100, want: CMinRequiredSwapMB - 100},
+		{swapMB: CMinRequiredSwapMB - 1, want: 1},
+		{swapMB: CMinRequiredSwapMB, want: 0},
+		{swapMB: 8192, want: 0},
+	}
+	for _, tt := range tests {
+		if got := NeededSwapMB(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: tt.swapMB}); got != tt.want {
+			t.Errorf("NeededSwapMB(%d MB of swap) = %d, want %d", tt.swapMB, got, tt.want)
+		}
+	}
+}
+
+func TestPlanSwapFileEnough(t *testing.T) {
+	plan, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: 4096}, "", "")
+	if err != nil {
+		t.Fatalf("PlanSwapFile() error = %v", err)
+	}
+	if plan.NeededMB != 0 || len(plan.Steps) != 0 || plan.File != CSwapFile {
+		t.Errorf("PlanSwapFile() = %+v, want nothing to do", plan)
+	}
+}
+
+func TestPlanSwapFileExists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "swapfile")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024}, file, ""); !errors.Is(err, ErrSwapFileExists) {
+		t.Errorf("PlanSwapFile() error = %v, want %v", err, ErrSwapFileExists)
+	}
+}
+
+func TestSwapPlanScript(t *testing.T) {
+	// The folder doesn't exist, so the free space isn't checked
+	plan, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: 100}, "/gwtest-no-such-folder/swapfile", "/etc/fstab")
+	if err != nil {
+		t.Fatalf("PlanSwapFile() error = %v", err)
+	}
+	want := `#!/bin/sh
+# Adds 1948 MB of swap, please run as root e.g. sudo sh swap.sh
+set -e
+
+# Create a 1948 MB swap file
+fallocate -l 1948M /gwtest-no-such-folder/swapfile || dd if=/dev/zero of=/gwtest-no-such-folder/swapfile bs=1M count=1948
+
+# Make it readable only by root
+chmod 600 /gwtest-no-such-folder/swapfile
+
+# Format it as swap
+mkswap /gwtest-no-such-folder/swapfile
+
+# Start using it
+swapon /gwtest-no-such-folder/swapfile
+
+# Keep using it after a reboot
+sh -c 'grep -qxF '\''/gwtest-no-such-folder/swapfile none swap sw 0 0'\'' /etc/fstab || echo '\''/gwtest-no-such-folder/swapfile none swap sw 0 0'\'' >> /etc/fstab'
+`
+	if got := plan.Script(); got != want {
+		t.Errorf("Script() =\n%v\nwant\n%v", got, want)
+	}
+	if sh, err := exec.LookPath("sh"); err == nil {
+		cmd := exec.Command(sh, "-n")
+		cmd.Stdin = strings.NewReader(plan.Script())
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("sh -n: %v %s", err, out)
+		}
+	}
+}
+
+func TestApplySwapPlanDryRun(t *testing.T) {
+	plan, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: 100}, "/gwtest-no-such-folder/swapfile", "/etc/fstab")
+	if err != nil {
+		t.Fatalf("PlanSwapFile() error = %v", err)
+	}
+	// The fallback is only run if the first command fails, which it can't in a dry run
+	var commands []string
+	for _, s := range plan.Steps {
+		commands = append(commands, shellCommand(s.Args))
+	}
+
+	detected := ""
+	if os.Geteuid() != 0 {
+		detected = "sudo -n "
+	}
+	tests := []struct {
+		name   string
+		prefix []string
+		want   string
+	}{
+		{name: "detected", prefix: nil, want: detected},
+		{name: "none", prefix: []string{}, want: ""},
+		{name: "doas", prefix: []string{"doas"}, want: "doas "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ran, err := ApplySwapPlan(context.Background(), plan, SwapApplyOptions{DryRun: true, Prefix: tt.prefix, Out: &out})
+			if err != nil {
+				t.Fatalf("ApplySwapPlan() error = %v", err)
+			}
+			var want []string
+			for _, c := range commands {
+				want = append(want, tt.want+c)
+			}
+			if !reflect.DeepEqual(ran, want) {
+				t.Errorf("ApplySwapPlan() =\n%v\nwant\n%v", strings.Join(ran, "\n"), strings.Join(want, "\n"))
+			}
+			if got := out.String(); got != strings.Join(want, "\n")+"\n" {
+				t.Errorf("Out = %q", got)
+			}
+		})
+	}
+	// Nothing was created
+	if _, err := os.Stat(plan.File); !os.IsNotExist(err) {
+		t.Errorf("a dry run touched %v: %v", plan.File, err)
+	}
+}
+
+func TestApplySwapPlanFstab(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only runs on Linux")
+	}
+	dir := filepath.Join(t.TempDir(), "it's a folder")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fstab := filepath.Join(dir, "fstab")
+	plan, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: 100}, filepath.Join(dir, "swap file"), fstab)
+	if err != nil {
+		t.Fatalf("PlanSwapFile() error = %v", err)
+	}
+	// Only the fstab step, twice, to check the quoting and that the line is only added once
+	for i := 0; i < 2; i++ {
+		if _, err := ApplySwapPlan(context.Background(), SwapPlanStruct{Steps: plan.Steps[len(plan.Steps)-1:]}, SwapApplyOptions{Prefix: []string{}}); err != nil {
+			t.Fatalf("ApplySwapPlan() error = %v", err)
+		}
+	}
+	b, err := ioutil.ReadFile(fstab)
+	if err != nil || string(b) != plan.FstabLine+"\n" {
+		t.Errorf("fstab = %q, %v, want %q", b, err, plan.FstabLine+"\n")
+	}
+}
+
+func TestApplySwapPlanSudoPassword(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only runs on Linux")
+	}
+	// A sudo that wants a password, as sudo -n does when there's no cached credential
+	bin := t.TempDir()
+	sudo := "#!/bin/sh\necho 'sudo: a password is required' >&2\nexit 1\n"
+	if err := ioutil.WriteFile(filepath.Join(bin, "sudo"), []byte(sudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	plan, err := PlanSwapFile(MemInfoStruct{MemTotalMB: 1024, SwapTotalMB: 100}, filepath.Join(t.TempDir(), "swapfile"), "")
+	if err != nil {
+		t.Fatalf("PlanSwapFile() error = %v", err)
+	}
+	ran, err := ApplySwapPlan(context.Background(), plan, SwapApplyOptions{Prefix: cSwapSudo})
+	if !errors.Is(err, ErrSwapNeedsPassword) {
+		t.Fatalf("ApplySwapPlan() error = %v, want %v", err, ErrSwapNeedsPassword)
+	}
+	// It stops straight away, without trying the fallback
+	if len(ran) != 1 {
+		t.Errorf("ran %q, want only the first command", ran)
+	}
+}
@@ -0,0 +1,259 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CSystemdSystemUnitDir - Where system scope unit files are installed
+	CSystemdSystemUnitDir string = "/etc/systemd/system"
+	// CSystemdUserUnitDir - Where user scope unit files are installed, under the user's home folder
+	CSystemdUserUnitDir string = ".config/systemd/user"
+
+	cSystemdRestartSec     int = 30
+	cSystemdTimeoutStopSec int = 300
+)
+
+// SystemdScope - Whether a unit runs under the system manager or the user's own manager
+type SystemdScope int
+
+const (
+	// SSUser - Run under the user's manager, with systemctl --user
+	SSUser SystemdScope = iota
+	// SSSystem - Run under the system manager, which needs root to install
+	SSSystem
+)
+
+// SystemdUnitOptions - Where the binaries are, and who runs them
+type SystemdUnitOptions struct {
+	BinFolder string
+	DataDir   string // Passed to the daemon as -datadir if set, otherwise it uses the coin home folder
+	User      string // System scope only, the user to run as. Defaults to root, which isn't recommended
+}
+
+// SystemdUnitStruct - A generated unit file
+type SystemdUnitStruct struct {
+	Name    string // e.g. divid.service
+	Scope   SystemdScope
+	Content string
+}
+
+// GenerateDaemonUnit - Returns a unit that runs the coin daemon from opts.BinFolder, and stops it with the cli
+func GenerateDaemonUnit(pt ProjectType, scope SystemdScope, opts SystemdUnitOptions) (SystemdUnitStruct, error) {
+	files, err := GetCoinBinaryFiles(pt, OSTLinux)
+	if err != nil {
+		return SystemdUnitStruct{}, err
+	}
+	name, err := coinName(pt)
+	if err != nil {
+		return SystemdUnitStruct{}, err
+	}
+	if opts.BinFolder == "" {
+		return SystemdUnitStruct{}, errors.New("the bin folder is required")
+	}
+
+	var dataDir []string
+	if opts.DataDir != "" {
+		dataDir = []string{"-datadir=" + opts.DataDir}
+	}
+	// -daemon=0 keeps the daemon in the foreground, as Type=simple needs, even if its conf file sets daemon=1
+	daemon := append([]string{filepath.Join(opts.BinFolder, files[0]), "-daemon=0"}, dataDir...)
+	stop := append(append([]string{filepath.Join(opts.BinFolder, files[1])}, dataDir...), "stop")
+
+	var sb strings.Builder
+	writeSystemdUnitSection(&sb, scope, name+" daemon", nil)
+	fmt.Fprintf(&sb, "\n[Service]\n")
+	fmt.Fprintf(&sb, "Type=simple\n")
+	writeSystemdUser(&sb, scope, opts)
+	fmt.Fprintf(&sb, "ExecStart=%s\n", systemdCommand(daemon))
+	fmt.Fprintf(&sb, "ExecStop=%s\n", systemdCommand(stop))
+	fmt.Fprintf(&sb, "Restart=on-failure\n")
+	fmt.Fprintf(&sb, "RestartSec=%d\n", cSystemdRestartSec)
+	// Flushing the chain state to disk can take a while on slow devices
+	fmt.Fprintf(&sb, "TimeoutStopSec=%d\n", cSystemdTimeoutStopSec)
+	writeSystemdHardening(&sb, scope)
+	writeSystemdInstallSection(&sb, scope)
+
+	return SystemdUnitStruct{Name: files[0] + ".service", Scope: scope, Content: sb.String()}, nil
+}
+
+// GenerateServerUnit - Returns a unit that runs the wallet server from opts.BinFolder, started after the daemon
+func GenerateServerUnit(pt ProjectType, scope SystemdScope, opts SystemdUnitOptions) (SystemdUnitStruct, error) {
+	daemonFiles, err := GetCoinBinaryFiles(pt, OSTLinux)
+	if err != nil {
+		return SystemdUnitStruct{}, err
+	}
+	var server, app string
+	switch pt {
+	case PTDivi:
+		server, app = CAppServerFileBoxDivi, CAppNameServerBoxDivi
+	case PTPhore:
+		server, app = CAppServerFileBoxPhore, CAppNameServerBoxPhore
+	case PTPIVX:
+		server, app = CAppServerFileGoPIVX, CAppNameServerBoxPIVX
+	case PTTrezarcoin:
+		server, app = CAppServerFileBoxTrezarcoin, CAppNameServerBoxTrezarcoin
+	default:
+		return SystemdUnitStruct{}, errors.New("unable to determine ProjectType")
+	}
+	if opts.BinFolder == "" {
+		return SystemdUnitStruct{}, errors.New("the bin folder is required")
+	}
+
+	var sb strings.Builder
+	writeSystemdUnitSection(&sb, scope, app, []string{daemonFiles[0] + ".service"})
+	fmt.Fprintf(&sb, "\n[Service]\n")
+	fmt.Fprintf(&sb, "Type=simple\n")
+	writeSystemdUser(&sb, scope, opts)
+	fmt.Fprintf(&sb, "ExecStart=%s\n", systemdCommand([]string{filepath.Join(opts.BinFolder, server)}))
+	fmt.Fprintf(&sb, "Restart=on-failure\n")
+	fmt.Fprintf(&sb, "RestartSec=%d\n", cSystemdRestartSec)
+	writeSystemdHardening(&sb, scope)
+	writeSystemdInstallSection(&sb, scope)
+
+	return SystemdUnitStruct{Name: server + ".service", Scope: scope, Content: sb.String()}, nil
+}
+
+func writeSystemdUnitSection(sb *strings.Builder, scope SystemdScope, description string, after []string) {
+	// The user manager has no network-online.target
+	if scope == SSSystem {
+		after = append([]string{"network-online.target"}, after...)
+	}
+	fmt.Fprintf(sb, "[Unit]\n")
+	fmt.Fprintf(sb, "Description=%s\n", description)
+	if len(after) > 0 {
+		fmt.Fprintf(sb, "After=%s\n", strings.Join(after, " "))
+		fmt.Fprintf(sb, "Wants=%s\n", strings.Join(after, " "))
+	}
+}
+
+func writeSystemdUser(sb *strings.Builder, scope SystemdScope, opts SystemdUnitOptions) {
+	if scope == SSSystem && opts.User != "" {
+		fmt.Fprintf(sb, "User=%s\n", opts.User)
+	}
+}
+
+// writeSystemdHardening - The sandboxing options that still let the daemon use its data dir in the user's home.
+// Most need privileges the user manager doesn't have, so user units only get NoNewPrivileges
+func writeSystemdHardening(sb *strings.Builder, scope SystemdScope) {
+	fmt.Fprintf(sb, "NoNewPrivileges=true\n")
+	if scope != SSSystem {
+		return
+	}
+	for _, o := range []string{
+		"PrivateTmp=true",
+		"PrivateDevices=true",
+		"ProtectSystem=full",
+		"ProtectKernelTunables=true",
+		"ProtectKernelModules=true",
+		"ProtectControlGroups=true",
+		"RestrictSUIDSGID=true",
+		"MemoryDenyWriteExecute=true",
+	} {
+		fmt.Fprintf(sb, "%s\n", o)
+	}
+}
+
+func writeSystemdInstallSection(sb *strings.Builder, scope SystemdScope) {
+	fmt.Fprintf(sb, "\n[Install]\n")
+	if scope == SSSystem {
+		fmt.Fprintf(sb, "WantedBy=multi-user.target\n")
+	} else {
+		fmt.Fprintf(sb, "WantedBy=default.target\n")
+	}
+}
+
+// systemdCommand - Quotes the arguments of an Exec line where needed, and escapes systemd's % specifiers and $
+// variables so paths are taken literally. Variables aren't expanded in the command itself, so a $ there is left alone
+func systemdCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		a = strings.Replace(a, "%", "%%", -1)
+		if i > 0 {
+			a = strings.Replace(a, "$", "$$", -1)
+		}
+		if a != "" && !strings.ContainsAny(a, " \t\"'\\") {
+			quoted[i] = a
+			continue
+		}
+		a = strings.Replace(a, `\`, `\\`, -1)
+		quoted[i] = `"` + strings.Replace(a, `"`, `\"`, -1) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// GetSystemdUnitDir - Returns where unit files for the scope are installed
+func GetSystemdUnitDir(scope SystemdScope) (string, error) {
+	if scope == SSSystem {
+		return CSystemdSystemUnitDir, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(u.HomeDir, CSystemdUserUnitDir), nil
+}
+
+// InstallSystemdUnit - Writes the unit file and reloads systemd, returning where it was written
+func InstallSystemdUnit(ctx context.Context, unit SystemdUnitStruct) (string, error) {
+	dir, err := GetSystemdUnitDir(unit.Scope)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, unit.Name)
+	tmp, err := ioutil.TempFile(dir, "."+unit.Name+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(unit.Content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return "", err
+	}
+	return file, systemctl(ctx, unit.Scope, "daemon-reload")
+}
+
+// EnableSystemdUnit - Makes the unit start at boot, or login for user units, and with now starts it straight away
+func EnableSystemdUnit(ctx context.Context, scope SystemdScope, name string, now bool) error {
+	if now {
+		return systemctl(ctx, scope, "enable", "--now", name)
+	}
+	return systemctl(ctx, scope, "enable", name)
+}
+
+// DisableSystemdUnit - Stops the unit and stops it starting at boot
+func DisableSystemdUnit(ctx context.Context, scope SystemdScope, name string) error {
+	return systemctl(ctx, scope, "disable", "--now", name)
+}
+
+func systemctl(ctx context.Context, scope SystemdScope, args ...string) error {
+	if scope == SSUser {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %v: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package gwcommon
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden - Compares got with testdata/name, or rewrites it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	file := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%v differs, run go test -update if the change is intended\ngot:\n%v\nwant:\n%v", file, got, want)
+	}
+}
+
+func TestGenerateDaemonUnit(t *testing.T) {
+	tests := []struct {
+		golden string
+		scope  SystemdScope
+		opts   SystemdUnitOptions
+	}{
+		{golden: "divid-user.service", scope: SSUser, opts: SystemdUnitOptions{BinFolder: "/home/pi/boxdivi"}},
+		{
+			// User is ignored, the user manager already runs as the user
+			golden: "divid-user-datadir.service",
+			scope:  SSUser,
+			opts:   SystemdUnitOptions{BinFolder: "/home/pi/boxdivi", DataDir: "/mnt/ssd/.divi", User: "pi"},
+		},
+		{golden: "divid-system.service", scope: SSSystem, opts: SystemdUnitOptions{BinFolder: "/opt/boxdivi"}},
+		{
+			golden: "divid-system-datadir-user.service",
+			scope:  SSSystem,
+			opts:   SystemdUnitOptions{BinFolder: "/opt/boxdivi", DataDir: "/var/lib/divi", User: "divi"},
+		},
+		{
+			// A % would be a specifier, a $ in an argument a variable, and a space would split the argument
+			golden: "divid-system-escaped.service",
+			scope:  SSSystem,
+			opts:   SystemdUnitOptions{BinFolder: "/home/pi/100% $HOME/box divi", DataDir: `/mnt/$my "wallet"`, User: "pi"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			unit, err := GenerateDaemonUnit(PTDivi, tt.scope, tt.opts)
+			if err != nil {
+				t.Fatalf("GenerateDaemonUnit() error = %v", err)
+			}
+			if unit.Name != "divid.service" || unit.Scope != tt.scope {
+				t.Errorf("Name = %q, Scope = %v", unit.Name, unit.Scope)
+			}
+			checkGolden(t, tt.golden, unit.Content)
+		})
+	}
+}
+
+func TestGenerateServerUnit(t *testing.T) {
+	for _, scope := range []SystemdScope{SSUser, SSSystem} {
+		unit, err := GenerateServerUnit(PTDivi, scope, SystemdUnitOptions{BinFolder: "/home/pi/boxdivi", User: "pi"})
+		if err != nil {
+			t.Fatalf("GenerateServerUnit() error = %v", err)
+		}
+		golden := "boxdivis-user.service"
+		if scope == SSSystem {
+			golden = "boxdivis-system.service"
+		}
+		if unit.Name != "boxdivis.service" {
+			t.Errorf("Name = %q", unit.Name)
+		}
+		checkGolden(t, golden, unit.Content)
+	}
+}
+
+func TestGenerateUnitNoBinFolder(t *testing.T) {
+	if _, err := GenerateDaemonUnit(PTDivi, SSUser, SystemdUnitOptions{}); err == nil {
+		t.Error("GenerateDaemonUnit() without a bin folder should fail")
+	}
+	if _, err := GenerateServerUnit(PTDivi, SSUser, SystemdUnitOptions{}); err == nil {
+		t.Error("GenerateServerUnit() without a bin folder should fail")
+	}
+}
+
+func TestSystemdCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"/opt/boxdivi/divid", "-daemon=0"}, want: "/opt/boxdivi/divid -daemon=0"},
+		{args: []string{"/home/pi/box divi/divid"}, want: `"/home/pi/box divi/divid"`},
+		{args: []string{"/100%/divid"}, want: "/100%%/divid"},
+		{args: []string{"/$HOME/divid", "-datadir=/$HOME"}, want: "/$HOME/divid -datadir=/$$HOME"},
+		{args: []string{`/a "b"\c`}, want: `"/a \"b\"\\c"`},
+		{args: []string{""}, want: `""`},
+	}
+	for _, tt := range tests {
+		if got := systemdCommand(tt.args); got != tt.want {
+			t.Errorf("systemdCommand(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package gwcommon
 
 const (
-	cCoinNameTrezarcoin string = "Trezarcoin"
+	cCoinNameTrezarcoin    string = "Trezarcoin"
+	cCoinTickerTrezarcoin  string = "TZC"
+	cCoinGeckoIDTrezarcoin string = "trezarcoin"
+	cChainSizeMBTrezarcoin int    = 2000
 
 	// CTrezarcoinAppVersion - The app version of Trezarcoin
 	CTrezarcoinAppVersion string = "2.01"
@@ -28,6 +31,8 @@ const (
 	CTrezarcoinDFileWin   string = "trezarcoind.exe"
 	CTrezarcoinTxFile     string = "trezarcoin-tx"
 	CTrezarcoinTxFileWin  string = "trezarcoin-tx.exe"
+	CTrezarcoinRPCPort    string = "17299"
+	CTrezarcoinP2PPort    string = "17298"
 
 	// GoDivi - Only to be used by GoDeploy
 	CAppCLIFileBoxTrezarcoin             string = "boxtrezarcoin"
@@ -0,0 +1,134 @@
+//go:build !windows
+
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startTestDaemon - Runs script with a copy of sh that has a name of its own, so findProcess can tell it apart.
+// Returns the name, and the pid. It's killed when the test ends, if it's still running
+func startTestDaemon(t *testing.T, script string) (string, int) {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	b, err := ioutil.ReadFile(sh)
+	if err != nil {
+		t.Skip(err)
+	}
+	// Short enough that the kernel doesn't truncate it
+	name := fmt.Sprintf("gwtd%08d", rand.Intn(1e8))
+	daemon := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(daemon, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "-c", script)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Reaped as soon as it exits, as a zombie would still be found
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-done
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, _, err := findProcess(name); err == nil {
+			return name, cmd.Process.Pid
+		}
+		if time.Now().After(deadline) {
+			t.Skip("the process list doesn't show the test daemon")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	return err == nil && p.Signal(syscall.Signal(0)) == nil
+}
+
+func TestStopDaemonNotRunning(t *testing.T) {
+	pid, err := stopDaemon(context.Background(), "gwtest-not-running-coind", []string{"false"}, time.Second)
+	if pid != 0 || err != nil {
+		t.Errorf("stopDaemon() = %d, %v, want 0, nil", pid, err)
+	}
+}
+
+func TestStopDaemonWithCLI(t *testing.T) {
+	// SIGTERM is ignored, so it only stops if the cli is used, which sends SIGINT in place of the stop RPC
+	name, pid := startTestDaemon(t, `trap "" TERM; while :; do sleep 1; done`)
+	got, err := stopDaemon(context.Background(), name, []string{"kill", "-INT", strconv.Itoa(pid)}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("stopDaemon() error = %v", err)
+	}
+	if got != pid {
+		t.Errorf("stopDaemon() = %d, want %d", got, pid)
+	}
+}
+
+func TestStopDaemonCLIFails(t *testing.T) {
+	// The cli can't reach the daemon, so it's sent SIGTERM
+	name, pid := startTestDaemon(t, `while :; do sleep 1; done`)
+	got, err := stopDaemon(context.Background(), name, []string{"false"}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("stopDaemon() error = %v", err)
+	}
+	if got != pid {
+		t.Errorf("stopDaemon() = %d, want %d", got, pid)
+	}
+}
+
+func TestStopDaemonTimeout(t *testing.T) {
+	name, pid := startTestDaemon(t, `trap "" TERM; while :; do sleep 1; done`)
+	_, err := stopDaemon(context.Background(), name, nil, time.Second)
+	if !errors.Is(err, ErrDaemonStillRunning) {
+		t.Fatalf("stopDaemon() error = %v, want %v", err, ErrDaemonStillRunning)
+	}
+	// It's left to finish, never killed
+	if !isRunning(pid) {
+		t.Error("the daemon was killed")
+	}
+}
+
+func TestUninstallCoinDaemonStillRunning(t *testing.T) {
+	name, pid := startTestDaemon(t, `trap "" TERM; while :; do sleep 1; done`)
+	x := newUninstallFixture(t)
+	if err := writeInstallReceipt(x.bin, InstallReceiptStruct{Coin: "PHR", Files: []string{name, "phore-cli", "phore-tx"}}); err != nil {
+		t.Fatal(err)
+	}
+	opts := x.options(HFABackupAndDelete, "")
+	opts.StopTimeout = time.Second
+	if _, err := UninstallCoin(context.Background(), PTPhore, opts); err == nil {
+		t.Fatal("UninstallCoin() error = nil, want the daemon still running")
+	}
+	// Nothing is touched while the daemon has the wallet open
+	for _, f := range []string{filepath.Join(x.home, "wallet.dat"), filepath.Join(x.bin, "phore-cli")} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("%v: %v", f, err)
+		}
+	}
+	if !isRunning(pid) {
+		t.Error("the daemon was killed")
+	}
+}
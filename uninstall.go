@@ -0,0 +1,302 @@
+package gwcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	cUninstallStopTimeout = 2 * time.Minute
+	cUninstallStopPoll    = 500 * time.Millisecond
+	cBackupTimeFormat     = "2006-01-02-150405"
+)
+
+// ErrDaemonStillRunning - The coin daemon didn't stop in time, so nothing was uninstalled
+var ErrDaemonStillRunning = errors.New("the coin daemon is still running")
+
+// HomeFolderAction - What UninstallCoin does with the coin's home folder, which holds the wallet
+type HomeFolderAction int
+
+const (
+	// HFAKeep - Leave the home folder alone
+	HFAKeep HomeFolderAction = iota
+	// HFABackup - Back up the home folder, and keep it
+	HFABackup
+	// HFABackupAndDelete - Back up the home folder, then delete it
+	HFABackupAndDelete
+	// HFAAsk - Ask the user whether to back up, then whether to delete
+	HFAAsk
+)
+
+// UninstallOptions - What UninstallCoin removes, and from where
+type UninstallOptions struct {
+	BinFolder    string
+	HomeFolder   string // The coin's home folder e.g. ~/.phore, see GetCoinHomeFolder
+	HomeAction   HomeFolderAction
+	BackupFolder string        // Where home folder backups are written, defaults to the user's home folder
+	Path         PathOptions   // Whose shell startup files the bin folder is taken out of the PATH in
+	Prompter     *Prompter     // Used with HFAAsk, defaults to stdin and stdout
+	StopTimeout  time.Duration // How long to wait for the daemon to stop, defaults to cUninstallStopTimeout
+}
+
+// UninstallReportStruct - Everything UninstallCoin removed
+type UninstallReportStruct struct {
+	DaemonPID     int // The daemon that was stopped, 0 if it wasn't running
+	FilesRemoved  []string
+	PathFiles     []string // The shell startup files the bin folder was taken out of the PATH in
+	HomeBackup    string   // The home folder backup archive
+	HomeDeleted   bool
+	BinFolderGone bool
+	Warnings      []string
+}
+
+// UninstallCoin - Stops the coin daemon gracefully and removes what InstallCoinBinaries and AddProjectPath added. Only the files
+// in the install receipt are removed from BinFolder, and the home folder is kept unless opts.HomeAction says otherwise
+func UninstallCoin(ctx context.Context, pt ProjectType, opts UninstallOptions) (UninstallReportStruct, error) {
+	var report UninstallReportStruct
+
+	receipt, err := ReadInstallReceipt(opts.BinFolder)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("no install receipt, so no binaries will be removed: %v", err))
+	}
+
+	daemon := ""
+	if len(receipt.Files) > 0 {
+		daemon = receipt.Files[0]
+	} else if files, err := GetCoinBinaryFiles(pt, currentOSType()); err == nil {
+		daemon = files[0]
+	}
+	if daemon != "" {
+		timeout := opts.StopTimeout
+		if timeout <= 0 {
+			timeout = cUninstallStopTimeout
+		}
+		// Nothing else is touched if the daemon can't be stopped, as it still has the wallet open
+		cli := uninstallCLIStop(receipt, pt, opts)
+		if report.DaemonPID, err = stopDaemon(ctx, daemon, cli, timeout); err != nil {
+			return report, fmt.Errorf("unable to stop %v: %v", daemon, err)
+		}
+	}
+
+	if opts.HomeFolder != "" {
+		if err := uninstallHomeFolder(&report, opts); err != nil {
+			return report, err
+		}
+	}
+
+	for _, f := range receipt.Files {
+		// A receipt can only name files directly in the bin folder
+		if f != filepath.Base(f) || f == "." || f == ".." {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("skipped %q from the receipt", f))
+			continue
+		}
+		p := filepath.Join(opts.BinFolder, f)
+		if err := os.Remove(p); err != nil {
+			if !os.IsNotExist(err) {
+				report.Warnings = append(report.Warnings, err.Error())
+			}
+			continue
+		}
+		report.FilesRemoved = append(report.FilesRemoved, p)
+	}
+	if len(receipt.Files) > 0 {
+		p := filepath.Join(opts.BinFolder, CInstallReceiptFile)
+		if err := os.Remove(p); err == nil {
+			report.FilesRemoved = append(report.FilesRemoved, p)
+		}
+	}
+	// Only goes if nothing else has been put in there
+	if opts.BinFolder != "" && os.Remove(opts.BinFolder) == nil {
+		report.BinFolderGone = true
+	}
+
+	if opts.BinFolder != "" {
+		change, err := RemoveFromPath(opts.BinFolder, opts.Path)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unable to update the PATH: %v", err))
+		}
+		report.PathFiles = change.FilesChanged
+	}
+	return report, nil
+}
+
+// String - A summary of the report, for showing to the user
+func (r UninstallReportStruct) String() string {
+	var sb strings.Builder
+	if r.DaemonPID != 0 {
+		fmt.Fprintf(&sb, "Stopped the daemon (pid %d)\n", r.DaemonPID)
+	}
+	for _, f := range r.FilesRemoved {
+		fmt.Fprintf(&sb, "Removed %v\n", f)
+	}
+	if r.BinFolderGone {
+		sb.WriteString("Removed the empty bin folder\n")
+	}
+	for _, f := range r.PathFiles {
+		fmt.Fprintf(&sb, "Removed the bin folder from the PATH in %v\n", f)
+	}
+	if r.HomeBackup != "" {
+		fmt.Fprintf(&sb, "Backed up the home folder to %v\n", r.HomeBackup)
+	}
+	if r.HomeDeleted {
+		sb.WriteString("Deleted the home folder\n")
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&sb, "Warning: %v\n", w)
+	}
+	return sb.String()
+}
+
+func uninstallHomeFolder(report *UninstallReportStruct, opts UninstallOptions) error {
+	if _, err := os.Stat(opts.HomeFolder); os.IsNotExist(err) {
+		return nil
+	}
+
+	backup := opts.HomeAction == HFABackup || opts.HomeAction == HFABackupAndDelete
+	del := opts.HomeAction == HFABackupAndDelete
+	if opts.HomeAction == HFAAsk {
+		p := opts.Prompter
+		if p == nil {
+			p = defaultPrompter()
+		}
+		resp := p.getYesNoResp(fmt.Sprintf("\nWould you like to back up %v, which holds your wallet, first?", opts.HomeFolder))
+		backup = strings.HasPrefix(strings.ToLower(strings.TrimSpace(resp)), "y")
+		resp, _ = p.ReadLine(fmt.Sprintf("\nTo delete %v, type %v, or anything else to keep it: ", opts.HomeFolder, CUninstallConfirmationStr))
+		del = strings.TrimSpace(resp) == CUninstallConfirmationStr
+	}
+
+	if backup {
+		f, err := backupHomeFolder(opts.HomeFolder, opts.BackupFolder)
+		if err != nil {
+			// Don't delete a wallet that couldn't be backed up
+			return fmt.Errorf("unable to back up %v: %v", opts.HomeFolder, err)
+		}
+		report.HomeBackup = f
+	}
+	if del {
+		if err := os.RemoveAll(opts.HomeFolder); err != nil {
+			return err
+		}
+		report.HomeDeleted = true
+	}
+	return nil
+}
+
+// backupHomeFolder - Writes home to a tar.gz in folder, readable only by the user as it holds the wallet
+func backupHomeFolder(home, folder string) (string, error) {
+	if folder == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		folder = u.HomeDir
+	}
+	name := strings.TrimPrefix(filepath.Base(filepath.Clean(home)), ".") + "-backup-" + time.Now().Format(cBackupTimeFormat) + AFTarGz.Ext()
+
+	// Build it in a private folder, so it's never readable by anyone else
+	tmp, err := ioutil.TempDir(folder, ".backup-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	a, err := CreateArchive(filepath.Join(tmp, name), AFTarGz, []string{home})
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(a.File, 0600); err != nil {
+		return "", err
+	}
+	backup := filepath.Join(folder, name)
+	if err := os.Rename(a.File, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// stopDaemon - Asks the daemon to stop with the cli's stop command, or SIGTERM if the cli can't be run, then waits
+// up to timeout for it to exit. It's never killed, as it could be part way through writing the wallet.
+// Returns the pid stopped, or 0 if it definitely wasn't running
+func stopDaemon(ctx context.Context, daemon string, cli []string, timeout time.Duration) (int, error) {
+	pid, _, err := findProcess(daemon)
+	if err == errProcessNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to tell whether it's running: %v", err)
+	}
+
+	stopErr := errors.New("no cli to stop it with")
+	if len(cli) > 0 {
+		if out, err := exec.CommandContext(ctx, cli[0], cli[1:]...).CombinedOutput(); err != nil {
+			stopErr = fmt.Errorf("%v: %v %s", strings.Join(cli, " "), err, strings.TrimSpace(string(out)))
+		} else {
+			stopErr = nil
+		}
+	}
+	if stopErr != nil {
+		// Windows can't deliver SIGTERM, and TerminateProcess would be as bad as a kill
+		if runtime.GOOS == "windows" {
+			return pid, fmt.Errorf("unable to ask it to stop: %v", stopErr)
+		}
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			return pid, err
+		}
+		if err := p.Signal(syscall.SIGTERM); err != nil {
+			return pid, fmt.Errorf("unable to ask it to stop: %v, %v", stopErr, err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, _, err := findProcess(daemon); err == errProcessNotFound {
+			return pid, nil
+		}
+		select {
+		case <-ctx.Done():
+			return pid, ctx.Err()
+		case <-time.After(cUninstallStopPoll):
+		}
+	}
+	return pid, fmt.Errorf("%w after %v, please try again once it has finished", ErrDaemonStillRunning, timeout)
+}
+
+// uninstallCLIStop - The command that asks the daemon to stop, or nil if the cli isn't in the bin folder
+func uninstallCLIStop(receipt InstallReceiptStruct, pt ProjectType, opts UninstallOptions) []string {
+	files := receipt.Files
+	if len(files) < 2 {
+		files, _ = GetCoinBinaryFiles(pt, currentOSType())
+	}
+	if len(files) < 2 || opts.BinFolder == "" || files[1] != filepath.Base(files[1]) {
+		return nil
+	}
+	cli := filepath.Join(opts.BinFolder, files[1])
+	if !FileExists(cli) {
+		return nil
+	}
+	args := []string{cli}
+	if opts.HomeFolder != "" {
+		args = append(args, "-datadir="+opts.HomeFolder)
+	}
+	return append(args, "stop")
+}
+
+func currentOSType() OSType {
+	switch {
+	case runtime.GOOS == "windows":
+		return OSTWindows
+	case strings.HasPrefix(runtime.GOARCH, "arm"):
+		return OSTArm
+	}
+	return OSTLinux
+}
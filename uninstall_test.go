@@ -0,0 +1,245 @@
+package gwcommon
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// uninstallFixture - A bin folder installed from a receipt, a home folder with a wallet and a PATH entry, all in a
+// temp folder
+type uninstallFixture struct {
+	root, bin, home string
+	path            PathOptions
+}
+
+// newUninstallFixture - The daemon named in the receipt is never running, so UninstallCoin doesn't try to stop anything
+func newUninstallFixture(t *testing.T, extra ...string) uninstallFixture {
+	t.Helper()
+	root := t.TempDir()
+	x := uninstallFixture{
+		root: root,
+		bin:  filepath.Join(root, "boxphore"),
+		home: filepath.Join(root, ".phore"),
+		path: PathOptions{Home: root, Shell: "/bin/bash"},
+	}
+	files := []string{"gwtest-not-running-coind", "phore-cli", "phore-tx"}
+	if err := os.MkdirAll(x.bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range append(append([]string(nil), files...), extra...) {
+		if err := ioutil.WriteFile(filepath.Join(x.bin, f), []byte("bin\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeInstallReceipt(x.bin, InstallReceiptStruct{Coin: "PHR", Version: "1.0.0", Files: append(files, "../evil")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(x.home, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(x.home, "wallet.dat"), []byte("wallet"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToPath(x.bin, x.path); err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func (x uninstallFixture) options(action HomeFolderAction, input string) UninstallOptions {
+	return UninstallOptions{
+		BinFolder:    x.bin,
+		HomeFolder:   x.home,
+		HomeAction:   action,
+		BackupFolder: x.root,
+		Path:         x.path,
+		Prompter:     NewPrompterRW(strings.NewReader(input), ioutil.Discard),
+	}
+}
+
+// pathMentions - The rc files that still mention the bin folder
+func (x uninstallFixture) pathMentions(t *testing.T) []string {
+	t.Helper()
+	var found []string
+	for _, f := range allPathRCFiles(x.root) {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(b), x.bin) {
+			found = append(found, f)
+		}
+	}
+	return found
+}
+
+func TestUninstallCoinReceiptOnly(t *testing.T) {
+	x := newUninstallFixture(t, "boxphore")
+	report, err := UninstallCoin(context.Background(), PTPhore, x.options(HFAKeep, ""))
+	if err != nil {
+		t.Fatalf("UninstallCoin() error = %v", err)
+	}
+
+	var removed []string
+	for _, f := range report.FilesRemoved {
+		removed = append(removed, filepath.Base(f))
+	}
+	sort.Strings(removed)
+	want := []string{CInstallReceiptFile, "gwtest-not-running-coind", "phore-cli", "phore-tx"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("FilesRemoved = %v, want %v", removed, want)
+	}
+	// The file that isn't in the receipt stays, and so does the folder
+	if _, err := os.Stat(filepath.Join(x.bin, "boxphore")); err != nil {
+		t.Errorf("removed a file that isn't in the receipt: %v", err)
+	}
+	if report.BinFolderGone {
+		t.Error("BinFolderGone = true, but the folder isn't empty")
+	}
+	if report.DaemonPID != 0 {
+		t.Errorf("DaemonPID = %d, the daemon wasn't running", report.DaemonPID)
+	}
+	skipped := false
+	for _, w := range report.Warnings {
+		skipped = skipped || strings.Contains(w, `"../evil"`)
+	}
+	if !skipped {
+		t.Errorf("Warnings = %q, want the ../evil entry skipped", report.Warnings)
+	}
+	if _, err := os.Stat(filepath.Join(x.home, "wallet.dat")); err != nil {
+		t.Errorf("HFAKeep touched the wallet: %v", err)
+	}
+	if report.HomeBackup != "" || report.HomeDeleted {
+		t.Errorf("HomeBackup = %q, HomeDeleted = %v, want neither", report.HomeBackup, report.HomeDeleted)
+	}
+	// Windows' PATH isn't changed, see updatePath
+	if runtime.GOOS != "windows" && len(report.PathFiles) == 0 {
+		t.Error("PathFiles is empty, want the rc files the PATH was removed from")
+	}
+	if m := x.pathMentions(t); len(m) > 0 {
+		t.Errorf("the bin folder is still on the PATH in %v", m)
+	}
+}
+
+func TestUninstallCoinEmptiesBinFolder(t *testing.T) {
+	x := newUninstallFixture(t)
+	report, err := UninstallCoin(context.Background(), PTPhore, x.options(HFAKeep, ""))
+	if err != nil {
+		t.Fatalf("UninstallCoin() error = %v", err)
+	}
+	if !report.BinFolderGone {
+		t.Error("BinFolderGone = false, want the empty folder removed")
+	}
+	if _, err := os.Stat(x.bin); !os.IsNotExist(err) {
+		t.Errorf("bin folder still there: %v", err)
+	}
+}
+
+func TestUninstallCoinNoReceipt(t *testing.T) {
+	x := newUninstallFixture(t)
+	if err := os.Remove(filepath.Join(x.bin, CInstallReceiptFile)); err != nil {
+		t.Fatal(err)
+	}
+	report, err := UninstallCoin(context.Background(), PTPhore, x.options(HFAKeep, ""))
+	if err != nil {
+		t.Fatalf("UninstallCoin() error = %v", err)
+	}
+	if len(report.FilesRemoved) != 0 || report.BinFolderGone {
+		t.Errorf("FilesRemoved = %v, BinFolderGone = %v, want nothing removed without a receipt", report.FilesRemoved, report.BinFolderGone)
+	}
+	if len(report.Warnings) == 0 {
+		t.Error("Warnings is empty, want a warning about the missing receipt")
+	}
+}
+
+func TestUninstallCoinBackupAndDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		action HomeFolderAction
+		input  string
+	}{
+		{name: "HFABackupAndDelete", action: HFABackupAndDelete},
+		{name: "HFAAsk", action: HFAAsk, input: "y\n" + CUninstallConfirmationStr + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := newUninstallFixture(t)
+			report, err := UninstallCoin(context.Background(), PTPhore, x.options(tt.action, tt.input))
+			if err != nil {
+				t.Fatalf("UninstallCoin() error = %v", err)
+			}
+			if !report.HomeDeleted {
+				t.Error("HomeDeleted = false")
+			}
+			if _, err := os.Stat(x.home); !os.IsNotExist(err) {
+				t.Errorf("home folder still there: %v", err)
+			}
+			if filepath.Dir(report.HomeBackup) != x.root {
+				t.Fatalf("HomeBackup = %q, want it in %v", report.HomeBackup, x.root)
+			}
+			fi, err := os.Stat(report.HomeBackup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+				t.Errorf("backup mode = %v, want 0600 as it holds the wallet", fi.Mode().Perm())
+			}
+
+			dest := t.TempDir()
+			files, err := ExtractArchive(report.HomeBackup, dest, ExtractOptions{Only: []string{"wallet.dat"}})
+			if err != nil || len(files) != 1 {
+				t.Fatalf("ExtractArchive() = %v, %v, want wallet.dat", files, err)
+			}
+			if b, err := ioutil.ReadFile(files[0]); err != nil || string(b) != "wallet" {
+				t.Errorf("wallet.dat in the backup = %q, %v", b, err)
+			}
+		})
+	}
+}
+
+func TestUninstallCoinAskKeeps(t *testing.T) {
+	x := newUninstallFixture(t)
+	report, err := UninstallCoin(context.Background(), PTPhore, x.options(HFAAsk, "n\nconfirm\n"))
+	if err != nil {
+		t.Fatalf("UninstallCoin() error = %v", err)
+	}
+	// Only the exact confirmation deletes the wallet
+	if report.HomeBackup != "" || report.HomeDeleted {
+		t.Errorf("HomeBackup = %q, HomeDeleted = %v, want neither", report.HomeBackup, report.HomeDeleted)
+	}
+	if _, err := os.Stat(filepath.Join(x.home, "wallet.dat")); err != nil {
+		t.Errorf("wallet.dat: %v", err)
+	}
+}
+
+func TestUninstallCoinBackupFails(t *testing.T) {
+	x := newUninstallFixture(t)
+	opts := x.options(HFABackupAndDelete, "")
+	// A file where the backup folder should be
+	opts.BackupFolder = filepath.Join(x.root, "not-a-folder")
+	if err := ioutil.WriteFile(opts.BackupFolder, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := UninstallCoin(context.Background(), PTPhore, opts)
+	if err == nil {
+		t.Fatal("UninstallCoin() error = nil, want the backup to fail")
+	}
+	if report.HomeDeleted {
+		t.Error("HomeDeleted = true after the backup failed")
+	}
+	if _, err := os.Stat(filepath.Join(x.home, "wallet.dat")); err != nil {
+		t.Errorf("the wallet was deleted without a backup: %v", err)
+	}
+	// Nor is anything else removed
+	if len(report.FilesRemoved) != 0 {
+		t.Errorf("FilesRemoved = %v", report.FilesRemoved)
+	}
+}
@@ -0,0 +1,67 @@
+package gwcommon
+
+import (
+	"context"
+)
+
+// ReceiveAddressStruct - One of the wallet's own addresses, and what it has received
+type ReceiveAddressStruct struct {
+	Address       string
+	Label         string
+	Amount        Amount
+	Confirmations int64
+}
+
+// GetNewAddress - Returns a new receive address, labelled with label if not blank. Older daemons call the label an
+// account, but take it in the same place
+func (c *CoinRPCClient) GetNewAddress(ctx context.Context, label string) (string, error) {
+	var params []interface{}
+	if label != "" {
+		params = []interface{}{label}
+	}
+	var address string
+	if err := c.Call(ctx, "getnewaddress", params, &address); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// ListReceiveAddresses - Returns the wallet's addresses that have received coins with at least minConf confirmations,
+// and with includeEmpty, those that haven't received anything too
+func (c *CoinRPCClient) ListReceiveAddresses(ctx context.Context, minConf int, includeEmpty bool) ([]ReceiveAddressStruct, error) {
+	var received []struct {
+		Address       string `json:"address"`
+		Label         string `json:"label"`
+		Account       string `json:"account"`
+		Amount        Amount `json:"amount"`
+		Confirmations int64  `json:"confirmations"`
+	}
+	if err := c.Call(ctx, "listreceivedbyaddress", []interface{}{minConf, includeEmpty}, &received); err != nil {
+		return nil, err
+	}
+
+	addresses := make([]ReceiveAddressStruct, 0, len(received))
+	for _, r := range received {
+		label := r.Label
+		if label == "" {
+			label = r.Account
+		}
+		addresses = append(addresses, ReceiveAddressStruct{
+			Address:       r.Address,
+			Label:         label,
+			Amount:        r.Amount,
+			Confirmations: r.Confirmations,
+		})
+	}
+	return addresses, nil
+}
+
+// SetAddressLabel - Labels one of the wallet's addresses, using setlabel, or setaccount on daemons that still use
+// the legacy account API
+func (c *CoinRPCClient) SetAddressLabel(ctx context.Context, address, label string) error {
+	err := c.Call(ctx, "setlabel", []interface{}{address, label}, nil)
+	if IsRPCError(err, cRPCErrMethodNotFound) {
+		return c.Call(ctx, "setaccount", []interface{}{address, label}, nil)
+	}
+	return err
+}
@@ -0,0 +1,420 @@
+package gwcommon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cClientTimeout    = 60 * time.Second
+	cClientMaxBackoff = 30 * time.Second
+)
+
+// ErrNotPaired - There's no certificate fingerprint to check the server against, as the client hasn't been paired
+var ErrNotPaired = errors.New("not paired with the server, no certificate fingerprint has been recorded, please pair first")
+
+// WalletClient - Talks to a WalletServer over HTTPS, e.g. from the GUI to a headless wallet box on the LAN.
+// The server's self-signed certificate is pinned by its fingerprint rather than checked against a CA
+type WalletClient struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+
+	mu              sync.Mutex
+	certFingerprint string
+	pairingCert     string // The fingerprint seen while pairing, pinned once the pairing succeeds
+}
+
+// ServerError - Returned by WalletClient when the server responded with anything other than NoServerError
+type ServerError struct {
+	Request      string
+	Response     ServerResponse
+	ResponseDesc string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server request %v failed (%d): %v", e.Request, e.Response, e.ResponseDesc)
+}
+
+// NewWalletClient - Returns a WalletClient for the server at ServerIP:Port in the CLI config. Requests fail with
+// ErrNotPaired until a ServerCertFingerprint has been recorded, which only GenerateToken does, see PairWalletClient
+func NewWalletClient(cs CLIConfStruct) *WalletClient {
+	c := &WalletClient{
+		BaseURL:         "https://" + net.JoinHostPort(cs.ServerIP, cs.Port),
+		Token:           cs.Token,
+		certFingerprint: cs.ServerCertFingerprint,
+	}
+	c.HTTPClient = &http.Client{Timeout: cClientTimeout, Transport: newPinnedTransport(c.verifyConnection)}
+	return c
+}
+
+func newPinnedTransport(verify func(tls.ConnectionState) error) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// The certificate is self-signed, so it's checked by VerifyConnection instead
+			InsecureSkipVerify: true,
+			VerifyConnection:   verify,
+		},
+	}
+}
+
+// CertFingerprint - Returns the pinned certificate fingerprint, which after pairing is the one the server presented
+func (c *WalletClient) CertFingerprint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.certFingerprint
+}
+
+func (c *WalletClient) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("the server did not present a certificate")
+	}
+	fp := CertFingerprint(cs.PeerCertificates[0].Raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.certFingerprint == "" {
+		// Anyone could be presenting it, and the request would hand them the token
+		return ErrNotPaired
+	}
+	if fp != c.certFingerprint {
+		return &CertFingerprintMismatchError{Expected: c.certFingerprint, Got: fp}
+	}
+	return nil
+}
+
+// verifyPairing - As verifyConnection, except that with nothing pinned yet the certificate is trusted on first use.
+// It's only pinned if the pairing code is accepted
+func (c *WalletClient) verifyPairing(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("the server did not present a certificate")
+	}
+	fp := CertFingerprint(cs.PeerCertificates[0].Raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.certFingerprint == "" {
+		c.pairingCert = fp
+		return nil
+	}
+	if fp != c.certFingerprint {
+		return &CertFingerprintMismatchError{Expected: c.certFingerprint, Got: fp}
+	}
+	return nil
+}
+
+// PairWalletClient - Pairs with the server in the CLI config using the code it displays, then records the token and
+// the server's certificate fingerprint in the CLI config
+func PairWalletClient(ctx context.Context, pairingCode, clientName string) error {
+	cs, err := GetCLIConfStruct()
+	if err != nil {
+		return err
+	}
+
+	c := NewWalletClient(cs)
+	token, err := c.GenerateToken(ctx, pairingCode, clientName)
+	if err != nil {
+		return err
+	}
+
+	cs.Token = token
+	cs.ServerCertFingerprint = c.CertFingerprint()
+	if err := SetCLIConfStruct(cs); err != nil {
+		return fmt.Errorf("unable to SetCLIConfStruct: %v", err)
+	}
+	return nil
+}
+
+// GenerateToken - Exchanges the pairing code displayed by the server for a token, which is also stored in the client.
+// This is the only request that trusts the server's certificate if none has been pinned, and it pins it if the
+// code is accepted
+func (c *WalletClient) GenerateToken(ctx context.Context, pairingCode, clientName string) (string, error) {
+	// Its own connection, so one made without a pin is never reused for other requests
+	tr := newPinnedTransport(c.verifyPairing)
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Timeout: cClientTimeout, Transport: tr}
+
+	req := GenerateTokenReqStruct{PairingCode: pairingCode, ClientName: clientName}
+	var resp GenerateTokenRespStruct
+	if err := c.doWith(ctx, hc, http.MethodPost, cServerAPIPathServer+CServRequestGenerateToken, req, &resp); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	if c.certFingerprint == "" {
+		c.certFingerprint = c.pairingCert
+	}
+	c.pairingCert = ""
+	c.mu.Unlock()
+	c.Token = resp.Token
+	return resp.Token, nil
+}
+
+// ListClients - Returns the clients paired with the server
+func (c *WalletClient) ListClients(ctx context.Context) ([]ClientInfoStruct, error) {
+	var resp ListClientsRespStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathServer+CServRequestListClients, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Clients, nil
+}
+
+// RevokeClient - Revokes the token of the paired client with the ID
+func (c *WalletClient) RevokeClient(ctx context.Context, clientID string) error {
+	return c.do(ctx, http.MethodPost, cServerAPIPathServer+CServRequestRevokeClient, RevokeClientReqStruct{ClientID: clientID}, nil)
+}
+
+// ShutdownServer - Asks the server to shut down
+func (c *WalletClient) ShutdownServer(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, cServerAPIPathServer+CServRequestShutdownServer, nil, nil)
+}
+
+// GetWalletStatus - Returns one of the CWalletStatus constants e.g. CWalletStatusLocked
+func (c *WalletClient) GetWalletStatus(ctx context.Context) (string, error) {
+	var resp WalletStatusRespStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathWallet+CWalletRequestGetWalletStatus, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.WalletStatus, nil
+}
+
+// GetMasternodes - Returns the status of each masternode in the server's masternode.conf
+func (c *WalletClient) GetMasternodes(ctx context.Context) ([]MasternodeStatusStruct, error) {
+	var resp MasternodesRespStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathWallet+CWalletRequestGetMasternodes, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Masternodes, nil
+}
+
+// Send - Sends the amount to the address, or with DryRun only previews it. The passphrase is only needed if the
+// wallet is locked
+func (c *WalletClient) Send(ctx context.Context, req SendRequestStruct, passphrase string) (SendResultStruct, error) {
+	var res SendResultStruct
+	if err := c.do(ctx, http.MethodPost, cServerAPIPathWallet+CWalletRequestSend, SendReqStruct{req, passphrase}, &res); err != nil {
+		return SendResultStruct{}, err
+	}
+	return res, nil
+}
+
+// StartMasternode - Starts the masternode with the alias, the wallet needs to be unlocked
+func (c *WalletClient) StartMasternode(ctx context.Context, alias string) error {
+	return c.do(ctx, http.MethodPost, cServerAPIPathWallet+CWalletRequestStartMasternode, StartMasternodeReqStruct{Alias: alias}, nil)
+}
+
+// GetNewAddress - Returns a new receive address from the server's wallet, labelled with label if not blank
+func (c *WalletClient) GetNewAddress(ctx context.Context, label string) (string, error) {
+	var resp NewAddressRespStruct
+	if err := c.do(ctx, http.MethodPost, cServerAPIPathWallet+CWalletRequestGetNewAddress, NewAddressReqStruct{Label: label}, &resp); err != nil {
+		return "", err
+	}
+	return resp.Address, nil
+}
+
+// GetReceiveAddresses - Returns the server wallet's receive addresses, including those that haven't received anything
+func (c *WalletClient) GetReceiveAddresses(ctx context.Context) ([]ReceiveAddressStruct, error) {
+	var resp ReceiveAddressesRespStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathWallet+CWalletRequestGetReceiveAddresses, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Addresses, nil
+}
+
+// GetPrivateKey - Returns the wallet's recovery phrase
+func (c *WalletClient) GetPrivateKey(ctx context.Context) (string, error) {
+	var resp PrivateKeyRespStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathWallet+CWalletRequestGetPrivateKey, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.PrivateKey, nil
+}
+
+// GetStakingStatus - Returns whether the wallet is staking, and if not, why not
+func (c *WalletClient) GetStakingStatus(ctx context.Context) (StakingStatusStruct, error) {
+	var ss StakingStatusStruct
+	if err := c.do(ctx, http.MethodGet, cServerAPIPathWallet+CWalletRequestGetStakingStatus, nil, &ss); err != nil {
+		return StakingStatusStruct{}, err
+	}
+	return ss, nil
+}
+
+// GetStakingRewards - Returns the rewards between from and to, totalled per period in the time zone loc
+func (c *WalletClient) GetStakingRewards(ctx context.Context, from, to time.Time, period RewardPeriod, loc *time.Location) ([]StakingRewardsStruct, error) {
+	var rewards []StakingRewardsStruct
+	path := cServerAPIPathWallet + CWalletRequestGetStakingRewards + "?" + rewardsQuery(from, to, period, loc).Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, &rewards); err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
+
+// GetTransactions - Returns a page of the wallet's transactions matching the filter, newest first
+func (c *WalletClient) GetTransactions(ctx context.Context, filter TxFilter, offset, limit int) (TxPage, error) {
+	var page TxPage
+	path := cServerAPIPathWallet + CWalletRequestGetTransactions + "?" + filter.txQuery(offset, limit).Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return TxPage{}, err
+	}
+	return page, nil
+}
+
+// SetPrivSeedStored - Tells the server whether the user has stored their recovery seed
+func (c *WalletClient) SetPrivSeedStored(ctx context.Context, stored bool) error {
+	return c.do(ctx, http.MethodPost, cServerAPIPathWallet+CWalletRequestSetPrivSeedStored, SetPrivSeedStoredReqStruct{Stored: stored}, nil)
+}
+
+// SubscribeEvents - Calls fn with each wallet event from the server until ctx is done or fn returns an error,
+// reconnecting and resuming after the last event received if the connection drops. Pass 0 as lastID to only
+// receive new events
+func (c *WalletClient) SubscribeEvents(ctx context.Context, lastID uint64, fn func(WalletEvent) error) error {
+	// The stream is long lived, so it can't use HTTPClient's overall timeout
+	sc := &http.Client{Transport: c.HTTPClient.Transport}
+	backoff := time.Second
+
+	for {
+		var err error
+		lastID, err = c.streamEvents(ctx, sc, lastID, fn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var fnErr *eventHandlerError
+		if errors.As(err, &fnErr) {
+			return fnErr.err
+		}
+		var sErr *ServerError
+		var fpErr *CertFingerprintMismatchError
+		if errors.As(err, &sErr) || errors.As(err, &fpErr) || errors.Is(err, ErrNotPaired) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < cClientMaxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// eventHandlerError - Wraps an error returned by the SubscribeEvents callback, so it isn't retried
+type eventHandlerError struct {
+	err error
+}
+
+func (e *eventHandlerError) Error() string {
+	return e.err.Error()
+}
+
+func (c *WalletClient) streamEvents(ctx context.Context, sc *http.Client, lastID uint64, fn func(WalletEvent) error) (uint64, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+cServerAPIPathWallet+CWalletRequestEvents, nil)
+	if err != nil {
+		return lastID, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	}
+
+	resp, err := sc.Do(req)
+	if err != nil {
+		return lastID, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var sr ServerResponseStruct
+		if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+			return lastID, fmt.Errorf("unable to subscribe to events: %v", resp.Status)
+		}
+		return lastID, &ServerError{Request: sr.Request, Response: sr.Response, ResponseDesc: sr.ResponseDesc}
+	}
+
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var ev WalletEvent
+			err := json.Unmarshal([]byte(data.String()), &ev)
+			data.Reset()
+			if err != nil {
+				return lastID, fmt.Errorf("unable to decode event: %v", err)
+			}
+			if err := fn(ev); err != nil {
+				return lastID, &eventHandlerError{err}
+			}
+			if ev.Type != WETResync {
+				lastID = ev.ID
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return lastID, err
+	}
+	return lastID, io.ErrUnexpectedEOF
+}
+
+func (c *WalletClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	return c.doWith(ctx, c.HTTPClient, method, path, body, result)
+}
+
+func (c *WalletClient) doWith(ctx context.Context, hc *http.Client, method, path string, body, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var sr ServerResponseStruct
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return fmt.Errorf("unable to decode server response (%v): %v", resp.Status, err)
+	}
+	if sr.Response != NoServerError {
+		return &ServerError{Request: sr.Request, Response: sr.Response, ResponseDesc: sr.ResponseDesc}
+	}
+	if result != nil && len(sr.Data) > 0 {
+		return json.Unmarshal(sr.Data, result)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package gwcommon
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWalletServer - A stand-in WalletServer that only pairs and reports the wallet status, and records the
+// Authorization headers it was sent
+type testWalletServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	auths []string
+}
+
+// newTestWalletServer - Uses httptest's certificate, or with ownCert a newly generated one, so two servers can
+// present different certificates
+func newTestWalletServer(t *testing.T, ownCert bool) *testWalletServer {
+	s := &testWalletServer{}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.auths = append(s.auths, r.Header.Get("Authorization"))
+		s.mu.Unlock()
+
+		sr := ServerResponseStruct{Request: r.URL.Path, Response: NoServerError}
+		switch r.URL.Path {
+		case cServerAPIPathServer + CServRequestGenerateToken:
+			var req GenerateTokenReqStruct
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.PairingCode != "123456" {
+				sr.Response, sr.ResponseDesc = Unauthorised, "wrong pairing code"
+				break
+			}
+			sr.Data, _ = json.Marshal(GenerateTokenRespStruct{Token: "tok", ClientID: "c1"})
+		case cServerAPIPathWallet + CWalletRequestGetWalletStatus:
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				sr.Response = Unauthorised
+				break
+			}
+			sr.Data, _ = json.Marshal(WalletStatusRespStruct{WalletStatus: CWalletStatusLocked})
+		default:
+			sr.Response = UnknownRequest
+		}
+		json.NewEncoder(w).Encode(sr)
+	})
+
+	if !ownCert {
+		s.Server = httptest.NewTLSServer(h)
+	} else {
+		dir := t.TempDir()
+		certFile, keyFile, err := EnsureServerCertificate(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Server = httptest.NewUnstartedServer(h)
+		s.Server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		s.Server.StartTLS()
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testWalletServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.auths...)
+}
+
+func (s *testWalletServer) fingerprint() string {
+	return CertFingerprint(s.Certificate().Raw)
+}
+
+func (s *testWalletServer) client(t *testing.T, token, fingerprint string) *WalletClient {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWalletClient(CLIConfStruct{ServerIP: host, Port: port, Token: token, ServerCertFingerprint: fingerprint})
+}
+
+func TestWalletClientPairThenMismatch(t *testing.T) {
+	server := newTestWalletServer(t, false)
+	mitm := newTestWalletServer(t, true)
+	if server.fingerprint() == mitm.fingerprint() {
+		t.Fatal("the two servers have the same certificate")
+	}
+	ctx := context.Background()
+
+	c := server.client(t, "", "")
+	token, err := c.GenerateToken(ctx, "123456", "test")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	if token != "tok" || c.Token != "tok" {
+		t.Errorf("GenerateToken() = %q, Token = %q", token, c.Token)
+	}
+	if got := c.CertFingerprint(); got != server.fingerprint() {
+		t.Fatalf("CertFingerprint() = %v, want the server's %v", got, server.fingerprint())
+	}
+	if status, err := c.GetWalletStatus(ctx); err != nil || status != CWalletStatusLocked {
+		t.Fatalf("GetWalletStatus() = %q, %v", status, err)
+	}
+
+	// Something else answers at the server's address
+	c.BaseURL = mitm.URL
+	_, err = c.GetWalletStatus(ctx)
+	var fpErr *CertFingerprintMismatchError
+	if !errors.As(err, &fpErr) {
+		t.Fatalf("GetWalletStatus() error = %v, want a CertFingerprintMismatchError", err)
+	}
+	if fpErr.Expected != server.fingerprint() || fpErr.Got != mitm.fingerprint() {
+		t.Errorf("CertFingerprintMismatchError = %+v", fpErr)
+	}
+	// Pairing again doesn't replace the pin either
+	if _, err := c.GenerateToken(ctx, "123456", "test"); !errors.As(err, &fpErr) {
+		t.Errorf("GenerateToken() error = %v, want a CertFingerprintMismatchError", err)
+	}
+	if got := mitm.requests(); len(got) != 0 {
+		t.Errorf("the other server was sent %q", got)
+	}
+}
+
+func TestWalletClientUnpairedRefused(t *testing.T) {
+	server := newTestWalletServer(t, false)
+	ctx := context.Background()
+
+	// A token but no fingerprint, e.g. a config edited by hand
+	c := server.client(t, "tok", "")
+	if _, err := c.GetWalletStatus(ctx); !errors.Is(err, ErrNotPaired) {
+		t.Errorf("GetWalletStatus() error = %v, want %v", err, ErrNotPaired)
+	}
+	// Events aren't retried forever either
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := c.SubscribeEvents(ctx2, 0, func(WalletEvent) error { return nil }); !errors.Is(err, ErrNotPaired) {
+		t.Errorf("SubscribeEvents() error = %v, want %v", err, ErrNotPaired)
+	}
+	if got := server.requests(); len(got) != 0 {
+		t.Errorf("the token was sent without a pinned certificate: %q", got)
+	}
+	if c.CertFingerprint() != "" {
+		t.Errorf("CertFingerprint() = %v, a request that isn't pairing pinned it", c.CertFingerprint())
+	}
+}
+
+func TestWalletClientFailedPairingDoesNotPin(t *testing.T) {
+	server := newTestWalletServer(t, false)
+	ctx := context.Background()
+
+	c := server.client(t, "", "")
+	var sErr *ServerError
+	if _, err := c.GenerateToken(ctx, "000000", "test"); !errors.As(err, &sErr) || sErr.Response != Unauthorised {
+		t.Fatalf("GenerateToken() error = %v, want Unauthorised", err)
+	}
+	if c.CertFingerprint() != "" {
+		t.Errorf("CertFingerprint() = %v after the pairing code was refused", c.CertFingerprint())
+	}
+	if _, err := c.GetWalletStatus(ctx); !errors.Is(err, ErrNotPaired) {
+		t.Errorf("GetWalletStatus() error = %v, want %v", err, ErrNotPaired)
+	}
+}
@@ -0,0 +1,157 @@
+package gwcommon
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// CPasswordForbiddenChars - Characters that break the coin CLI's argument parsing when passed to encryptwallet
+	CPasswordForbiddenChars string = "\"'`\\$"
+
+	cPasswordMaxAttempts int = 3
+)
+
+// ErrPasswordAttemptsExceeded - The user failed to enter an acceptable password in the attempts allowed
+var ErrPasswordAttemptsExceeded = errors.New("unable to get a valid password after 3 attempts")
+
+//go:embed common-passwords.txt
+var commonPasswordsTxt string
+
+var commonPasswords = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, s := range strings.Split(commonPasswordsTxt, "\n") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			m[strings.ToLower(s)] = true
+		}
+	}
+	return m
+}()
+
+// PasswordPolicy - The rules a wallet encryption password has to meet
+type PasswordPolicy struct {
+	MinLength      int     // Minimum number of characters
+	MinEntropyBits float64 // Minimum estimated entropy, see EstimatePasswordEntropy
+	RejectCommon   bool    // Reject passwords found in the embedded common passwords list
+	ForbiddenChars string  // Characters that may not appear in the password
+}
+
+// DefaultPasswordPolicy - The policy used by Prompter unless told otherwise
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      10,
+	MinEntropyBits: 50,
+	RejectCommon:   true,
+	ForbiddenChars: CPasswordForbiddenChars,
+}
+
+// PasswordPolicyError - Returned when a password breaks the PasswordPolicy, with a reason for each rule broken
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// Check - Returns a *PasswordPolicyError explaining why pw is unacceptable, or nil if it's fine
+func (pp PasswordPolicy) Check(pw string) error {
+	var reasons []string
+
+	if pw == "" {
+		return &PasswordPolicyError{Reasons: []string{"the password cannot be empty"}}
+	}
+
+	if n := utf8.RuneCountInString(pw); n < pp.MinLength {
+		reasons = append(reasons, fmt.Sprintf("it must be at least %d characters long, but is only %d", pp.MinLength, n))
+	}
+
+	if pp.ForbiddenChars != "" {
+		var found []string
+		for _, r := range pp.ForbiddenChars {
+			if strings.ContainsRune(pw, r) {
+				found = append(found, string(r))
+			}
+		}
+		if len(found) > 0 {
+			reasons = append(reasons, fmt.Sprintf("it cannot contain %s as the coin CLI would misinterpret them", strings.Join(found, " ")))
+		}
+	}
+
+	if strings.TrimSpace(pw) != pw {
+		reasons = append(reasons, "it cannot start or end with a space, as these are easily lost when typed into a shell")
+	}
+	if strings.HasPrefix(pw, "-") {
+		reasons = append(reasons, "it cannot start with a -, as the coin CLI would treat it as an option")
+	}
+
+	if pp.RejectCommon && IsCommonPassword(pw) {
+		reasons = append(reasons, "it is one of the most commonly used passwords, and would be guessed quickly")
+	}
+
+	if e := EstimatePasswordEntropy(pw); e < pp.MinEntropyBits {
+		reasons = append(reasons, fmt.Sprintf("it is too predictable (estimated %.0f bits of entropy, %.0f required), try making it longer or mixing upper case, digits and symbols", e, pp.MinEntropyBits))
+	}
+
+	if len(reasons) > 0 {
+		return &PasswordPolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// IsCommonPassword - Returns true if pw, ignoring case, is in the embedded common passwords list
+func IsCommonPassword(pw string) bool {
+	return commonPasswords[strings.ToLower(pw)]
+}
+
+// EstimatePasswordEntropy - Returns a rough estimate in bits of the entropy of pw, based on the character classes used
+// and its length, with repeated characters not counted
+func EstimatePasswordEntropy(pw string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effLen := 0
+	var last rune = -1
+	for _, r := range pw {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+		if r != last {
+			effLen++
+		}
+		last = r
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effLen) * math.Log2(float64(pool))
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package gwcommon
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestNewPrompterFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString("Correct-Horse9battery\r\nignored\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// NewPrompter closes the descriptor it's given, so give it its own
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CPasswordFDEnvVar, strconv.Itoa(fd))
+	// The descriptor wins over the env var
+	t.Setenv(CPasswordEnvVar, "not this one")
+
+	p, err := NewPrompter()
+	if err != nil {
+		t.Fatalf("NewPrompter() error = %v", err)
+	}
+	if !p.NonInteractive {
+		t.Fatal("NewPrompter() should be non-interactive when the fd env var is set")
+	}
+	if p.Password != "Correct-Horse9battery" {
+		t.Errorf("Password = %q, want %q", p.Password, "Correct-Horse9battery")
+	}
+}
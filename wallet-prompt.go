@@ -0,0 +1,221 @@
+package gwcommon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+const (
+	// CPasswordEnvVar - If set, the wallet password is taken from this env var rather than prompting the user
+	CPasswordEnvVar string = "GWCOMMON_WALLET_PASSWORD"
+	// CPasswordFDEnvVar - If set to a file descriptor number, the wallet password is read from the first line of it
+	CPasswordFDEnvVar string = "GWCOMMON_WALLET_PASSWORD_FD"
+)
+
+// Prompter - Reads responses and passwords from the user, or from the environment when running non-interactively
+type Prompter struct {
+	In  io.Reader
+	Out io.Writer
+
+	// NonInteractive - If true, ReadPassword returns Password rather than prompting
+	NonInteractive bool
+	Password       string
+
+	// Policy - The rules that a new wallet encryption password has to meet
+	Policy PasswordPolicy
+
+	reader *bufio.Reader
+}
+
+var (
+	stdPrompter     *Prompter
+	stdPrompterOnce sync.Once
+)
+
+// NewPrompter - Returns a Prompter using stdin and stdout, which is non-interactive if CPasswordEnvVar or CPasswordFDEnvVar are set
+func NewPrompter() (*Prompter, error) {
+	p := NewPrompterRW(os.Stdin, os.Stdout)
+
+	if sfd, ok := os.LookupEnv(CPasswordFDEnvVar); ok {
+		fd, err := strconv.Atoi(sfd)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor in %v: %v", CPasswordFDEnvVar, sfd)
+		}
+		pw, err := readPasswordFromFD(fd)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read password from %v: %v", CPasswordFDEnvVar, err)
+		}
+		p.NonInteractive = true
+		p.Password = pw
+		return p, nil
+	}
+
+	if pw, ok := os.LookupEnv(CPasswordEnvVar); ok {
+		p.NonInteractive = true
+		p.Password = pw
+	}
+
+	return p, nil
+}
+
+// NewPrompterRW - Returns an interactive Prompter that reads from in and writes to out
+func NewPrompterRW(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{
+		In:     in,
+		Out:    out,
+		Policy: DefaultPasswordPolicy,
+		reader: bufio.NewReader(in),
+	}
+}
+
+// ReadLine - Displays the prompt and returns the line entered, without its line ending
+func (p *Prompter) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.Out, prompt)
+	s, err := p.reader.ReadString('\n')
+	if err != nil && !(err == io.EOF && s != "") {
+		return "", err
+	}
+	return trimLineEnding(s), nil
+}
+
+// ReadPassword - Displays the prompt and returns the password entered, without echoing it if reading from a terminal
+func (p *Prompter) ReadPassword(prompt string) (string, error) {
+	if p.NonInteractive {
+		return p.Password, nil
+	}
+
+	f, ok := p.In.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return p.ReadLine(prompt)
+	}
+
+	fmt.Fprint(p.Out, prompt)
+	b, err := term.ReadPassword(int(f.Fd()))
+	// The user's Enter isn't echoed either, so move on to the next line ourselves
+	fmt.Fprintln(p.Out)
+	if err != nil {
+		return "", err
+	}
+	return trimLineEnding(string(b)), nil
+}
+
+// GetEncryptWalletResp - Asks the user whether they would like to encrypt their wallet
+func (p *Prompter) GetEncryptWalletResp() string {
+	resp, _ := p.ReadLine(`Your wallet is currently UNENCRYPTED!
+
+It is *highly* recommended that you encrypt your wallet before proceeding any further.
+
+Encrypt it now?: (y/n)`)
+	return resp
+}
+
+// GetWalletEncryptionPassword - Asks the user for a new wallet password, which has to be entered twice and meet p.Policy
+func (p *Prompter) GetWalletEncryptionPassword() (string, error) {
+	if p.NonInteractive {
+		if err := p.Policy.Check(p.Password); err != nil {
+			return "", err
+		}
+		return p.Password, nil
+	}
+
+	for i := 0; i < cPasswordMaxAttempts; i++ {
+		epw1, err := p.ReadPassword("\nPlease enter a password to encrypt your wallet: ")
+		if err != nil {
+			return "", err
+		}
+		if err := p.Policy.Check(epw1); err != nil {
+			p.printPolicyError(err)
+			continue
+		}
+		epw2, err := p.ReadPassword("\nNow please re-enter your password: ")
+		if err != nil {
+			return "", err
+		}
+		if epw1 != epw2 {
+			fmt.Fprint(p.Out, "\nThe passwords don't match, please try again...\n")
+			continue
+		}
+		return epw1, nil
+	}
+	return "", ErrPasswordAttemptsExceeded
+}
+
+// GetWalletUnlockPassword - Retrieves the wallet unlock password that the user has entered
+func (p *Prompter) GetWalletUnlockPassword() string {
+	pw, _ := p.ReadPassword("\nPlease enter your wallet encryption password: ")
+	return pw
+}
+
+// GetRecoveryPhrase - Asks the user to type in their recovery phrase, re-asking until it passes ValidateMnemonic
+func (p *Prompter) GetRecoveryPhrase() (string, error) {
+	for i := 0; i < cPasswordMaxAttempts; i++ {
+		resp, err := p.ReadLine("\nPlease enter your recovery phrase, with the words separated by spaces: ")
+		if err != nil {
+			return "", err
+		}
+		if err := ValidateMnemonic(resp); err != nil {
+			fmt.Fprintf(p.Out, "\n%v\n", err)
+			continue
+		}
+		return NormaliseMnemonic(resp), nil
+	}
+	return "", errors.New("unable to get a valid recovery phrase after 3 attempts")
+}
+
+func (p *Prompter) printPolicyError(err error) {
+	ppe, ok := err.(*PasswordPolicyError)
+	if !ok {
+		fmt.Fprintf(p.Out, "\n%v\n", err)
+		return
+	}
+	fmt.Fprint(p.Out, "\nSorry, that password can't be used because:\n")
+	for _, r := range ppe.Reasons {
+		fmt.Fprintf(p.Out, "  - %s\n", r)
+	}
+	fmt.Fprint(p.Out, "Please try again...\n")
+}
+
+func (p *Prompter) getYesNoResp(msg string) string {
+	resp, _ := p.ReadLine(msg + " (y/n)")
+	return resp
+}
+
+// defaultPrompter - Returns the stdin/stdout Prompter used by the package level prompt functions
+func defaultPrompter() *Prompter {
+	stdPrompterOnce.Do(func() {
+		p, err := NewPrompter()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, falling back to an interactive prompt\n", err)
+			p = NewPrompterRW(os.Stdin, os.Stdout)
+		}
+		stdPrompter = p
+	})
+	return stdPrompter
+}
+
+func readPasswordFromFD(fd int) (string, error) {
+	f := os.NewFile(uintptr(fd), "password-fd")
+	if f == nil {
+		return "", fmt.Errorf("bad file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	s, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return trimLineEnding(s), nil
+}
+
+// trimLineEnding - Removes a trailing \n or \r\n, so Windows input doesn't leave a \r behind
+func trimLineEnding(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
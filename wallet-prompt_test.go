@@ -0,0 +1,144 @@
+package gwcommon
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrompterReadLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"lf", "yes\n", "yes"},
+		{"crlf", "yes\r\n", "yes"},
+		{"no line ending", "yes", "yes"},
+		{"blank crlf", "\r\n", ""},
+		{"only the first line", "first\r\nsecond\r\n", "first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := NewPrompterRW(strings.NewReader(tt.input), &out)
+			got, err := p.ReadLine("Continue? ")
+			if err != nil {
+				t.Fatalf("ReadLine() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadLine() = %q, want %q", got, tt.want)
+			}
+			if out.String() != "Continue? " {
+				t.Errorf("prompt = %q, want %q", out.String(), "Continue? ")
+			}
+		})
+	}
+}
+
+func TestPrompterReadLineEOF(t *testing.T) {
+	p := NewPrompterRW(strings.NewReader(""), ioutil.Discard)
+	if _, err := p.ReadLine("Continue? "); err != io.EOF {
+		t.Errorf("ReadLine() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestPrompterReadPasswordNonTerminal(t *testing.T) {
+	// Anything that isn't a terminal is read as a plain line, so passwords can be piped in
+	var out bytes.Buffer
+	p := NewPrompterRW(strings.NewReader("Correct-Horse9battery\r\n"), &out)
+	got, err := p.ReadPassword("Password: ")
+	if err != nil {
+		t.Fatalf("ReadPassword() error = %v", err)
+	}
+	if got != "Correct-Horse9battery" {
+		t.Errorf("ReadPassword() = %q, want %q", got, "Correct-Horse9battery")
+	}
+	if out.String() != "Password: " {
+		t.Errorf("prompt = %q, want %q", out.String(), "Password: ")
+	}
+}
+
+func TestPrompterReadPasswordPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString("Correct-Horse9battery\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	p := NewPrompterRW(r, ioutil.Discard)
+	got, err := p.ReadPassword("Password: ")
+	if err != nil {
+		t.Fatalf("ReadPassword() error = %v", err)
+	}
+	if got != "Correct-Horse9battery" {
+		t.Errorf("ReadPassword() = %q, want %q", got, "Correct-Horse9battery")
+	}
+}
+
+func TestPrompterGetWalletEncryptionPassword(t *testing.T) {
+	var out bytes.Buffer
+	// Too weak, then a mismatch, then a match
+	in := "password\r\nCorrect-Horse9battery\r\nCorrect-Horse9batterx\r\nCorrect-Horse9battery\r\nCorrect-Horse9battery\r\n"
+	p := NewPrompterRW(strings.NewReader(in), &out)
+	got, err := p.GetWalletEncryptionPassword()
+	if err != nil {
+		t.Fatalf("GetWalletEncryptionPassword() error = %v\n%s", err, out.String())
+	}
+	if got != "Correct-Horse9battery" {
+		t.Errorf("GetWalletEncryptionPassword() = %q, want %q", got, "Correct-Horse9battery")
+	}
+	if !strings.Contains(out.String(), "can't be used") || !strings.Contains(out.String(), "don't match") {
+		t.Errorf("expected the policy and mismatch messages, got:\n%s", out.String())
+	}
+}
+
+func TestNewPrompterEnv(t *testing.T) {
+	t.Setenv(CPasswordEnvVar, "Correct-Horse9battery")
+
+	p, err := NewPrompter()
+	if err != nil {
+		t.Fatalf("NewPrompter() error = %v", err)
+	}
+	if !p.NonInteractive {
+		t.Fatal("NewPrompter() should be non-interactive when the env var is set")
+	}
+	got, err := p.ReadPassword("Password: ")
+	if err != nil || got != "Correct-Horse9battery" {
+		t.Errorf("ReadPassword() = %q, %v, want %q", got, err, "Correct-Horse9battery")
+	}
+	got, err = p.GetWalletEncryptionPassword()
+	if err != nil || got != "Correct-Horse9battery" {
+		t.Errorf("GetWalletEncryptionPassword() = %q, %v, want %q", got, err, "Correct-Horse9battery")
+	}
+}
+
+func TestNewPrompterEnvWeakPassword(t *testing.T) {
+	t.Setenv(CPasswordEnvVar, "password")
+
+	p, err := NewPrompter()
+	if err != nil {
+		t.Fatalf("NewPrompter() error = %v", err)
+	}
+	if _, err := p.GetWalletEncryptionPassword(); err == nil {
+		t.Error("GetWalletEncryptionPassword() should apply the policy to the env var password")
+	}
+}
+
+func TestNewPrompterBadFD(t *testing.T) {
+	for _, fd := range []string{"abc", "-1"} {
+		t.Run(fd, func(t *testing.T) {
+			t.Setenv(CPasswordFDEnvVar, fd)
+			if _, err := NewPrompter(); err == nil {
+				t.Errorf("NewPrompter() with %v=%v should fail", CPasswordFDEnvVar, fd)
+			}
+		})
+	}
+}
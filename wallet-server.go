@@ -0,0 +1,545 @@
+package gwcommon
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cServerAPIPathServer string = "/api/v1/server/"
+	cServerAPIPathWallet string = "/api/v1/wallet/"
+	cServerTokenBytes    int    = 32
+	cServerMaxBodyBytes  int64  = 1 << 16
+	cServerWalletTimeout        = 30 * time.Second
+)
+
+var errMasternodesNotEnabled = errors.New("masternodes are not enabled on this server")
+
+// ServerResponseStruct - The JSON envelope returned by the server for every request
+type ServerResponseStruct struct {
+	Request      string
+	Response     ServerResponse
+	ResponseDesc string
+	Data         json.RawMessage `json:",omitempty"`
+}
+
+// GenerateTokenReqStruct - Body sent with CServRequestGenerateToken, the code is the one displayed by the server
+type GenerateTokenReqStruct struct {
+	PairingCode string
+	ClientName  string
+}
+
+// GenerateTokenRespStruct - Data returned by CServRequestGenerateToken
+type GenerateTokenRespStruct struct {
+	Token    string
+	ClientID string
+}
+
+// ClientInfoStruct - A paired client, as returned by CServRequestListClients
+type ClientInfoStruct struct {
+	ID       string
+	Name     string
+	Created  time.Time
+	LastSeen time.Time
+}
+
+// ListClientsRespStruct - Data returned by CServRequestListClients
+type ListClientsRespStruct struct {
+	Clients []ClientInfoStruct
+}
+
+// RevokeClientReqStruct - Body sent with CServRequestRevokeClient
+type RevokeClientReqStruct struct {
+	ClientID string
+}
+
+// WalletStatusRespStruct - Data returned by CWalletRequestGetWalletStatus
+type WalletStatusRespStruct struct {
+	WalletStatus string // One of the CWalletStatus constants
+}
+
+// PrivateKeyRespStruct - Data returned by CWalletRequestGetPrivateKey
+type PrivateKeyRespStruct struct {
+	PrivateKey string
+}
+
+// SetPrivSeedStoredReqStruct - Body sent with CWalletRequestSetPrivSeedStored
+type SetPrivSeedStoredReqStruct struct {
+	Stored bool
+}
+
+// serverError - Carries the ServerResponse that a failed request should be reported with
+type serverError struct {
+	resp ServerResponse
+	err  error
+}
+
+func (e *serverError) Error() string {
+	return e.err.Error()
+}
+
+type serverHandlerFunc func(r *http.Request) (interface{}, error)
+
+type serverRoute struct {
+	method      string
+	requireAuth bool
+	handler     serverHandlerFunc
+	stream      http.HandlerFunc // Used instead of handler for responses that aren't a single ServerResponseStruct
+}
+
+// MasternodesRespStruct - Data returned by CWalletRequestGetMasternodes
+type MasternodesRespStruct struct {
+	Masternodes []MasternodeStatusStruct
+}
+
+// StartMasternodeReqStruct - Body sent with CWalletRequestStartMasternode
+type StartMasternodeReqStruct struct {
+	Alias string
+}
+
+// NewAddressReqStruct - Body sent with CWalletRequestGetNewAddress
+type NewAddressReqStruct struct {
+	Label string
+}
+
+// NewAddressRespStruct - Data returned by CWalletRequestGetNewAddress
+type NewAddressRespStruct struct {
+	Address string
+}
+
+// ReceiveAddressesRespStruct - Data returned by CWalletRequestGetReceiveAddresses
+type ReceiveAddressesRespStruct struct {
+	Addresses []ReceiveAddressStruct
+}
+
+// SendReqStruct - Body sent with CWalletRequestSend, the passphrase is only needed if the wallet is locked.
+// SendResultStruct is returned
+type SendReqStruct struct {
+	SendRequestStruct
+	Passphrase string
+}
+
+// WalletServer - An http.Handler serving the server and wallet requests as JSON endpoints, for a headless wallet box
+type WalletServer struct {
+	// SaveConf - Persists config changes, defaults to SetServerConfStruct
+	SaveConf func(ServerConfStruct) error
+	// Events - If set, clients can subscribe to wallet events with CWalletRequestEvents
+	Events *EventBroker
+	// MasternodeConfFile - If set, clients can check and start the masternodes in it
+	MasternodeConfFile string
+
+	conf   ServerConfStruct
+	rpc    *CoinRPCClient
+	tokens *TokenStore
+	routes map[string]serverRoute
+	mu     sync.Mutex
+	srv    *http.Server
+	// streamsDone - Closed when srv starts shutting down, so the event streams end rather than holding it up
+	streamsDone chan struct{}
+}
+
+// NewWalletServer - Returns a WalletServer for the conf, which talks to the coin daemon via rpc and authenticates
+// clients against tokens
+func NewWalletServer(conf ServerConfStruct, rpc *CoinRPCClient, tokens *TokenStore) *WalletServer {
+	s := &WalletServer{
+		SaveConf: SetServerConfStruct,
+		conf:     conf,
+		rpc:      rpc,
+		tokens:   tokens,
+	}
+	s.routes = map[string]serverRoute{
+		cServerAPIPathServer + CServRequestGenerateToken:         {method: http.MethodPost, handler: s.handleGenerateToken},
+		cServerAPIPathServer + CServRequestListClients:           {method: http.MethodGet, requireAuth: true, handler: s.handleListClients},
+		cServerAPIPathServer + CServRequestRevokeClient:          {method: http.MethodPost, requireAuth: true, handler: s.handleRevokeClient},
+		cServerAPIPathServer + CServRequestShutdownServer:        {method: http.MethodPost, requireAuth: true, handler: s.handleShutdownServer},
+		cServerAPIPathWallet + CWalletRequestGetWalletStatus:     {method: http.MethodGet, requireAuth: true, handler: s.handleGetWalletStatus},
+		cServerAPIPathWallet + CWalletRequestGetMasternodes:      {method: http.MethodGet, requireAuth: true, handler: s.handleGetMasternodes},
+		cServerAPIPathWallet + CWalletRequestGetNewAddress:       {method: http.MethodPost, requireAuth: true, handler: s.handleGetNewAddress},
+		cServerAPIPathWallet + CWalletRequestGetPrivateKey:       {method: http.MethodGet, requireAuth: true, handler: s.handleGetPrivateKey},
+		cServerAPIPathWallet + CWalletRequestGetReceiveAddresses: {method: http.MethodGet, requireAuth: true, handler: s.handleGetReceiveAddresses},
+		cServerAPIPathWallet + CWalletRequestGetStakingRewards:   {method: http.MethodGet, requireAuth: true, handler: s.handleGetStakingRewards},
+		cServerAPIPathWallet + CWalletRequestGetStakingStatus:    {method: http.MethodGet, requireAuth: true, handler: s.handleGetStakingStatus},
+		cServerAPIPathWallet + CWalletRequestGetTransactions:     {method: http.MethodGet, requireAuth: true, handler: s.handleGetTransactions},
+		cServerAPIPathWallet + CWalletRequestSetPrivSeedStored:   {method: http.MethodPost, requireAuth: true, handler: s.handleSetPrivSeedStored},
+		cServerAPIPathWallet + CWalletRequestSend:                {method: http.MethodPost, requireAuth: true, handler: s.handleSend},
+		cServerAPIPathWallet + CWalletRequestStartMasternode:     {method: http.MethodPost, requireAuth: true, handler: s.handleStartMasternode},
+		cServerAPIPathWallet + CWalletRequestEvents:              {method: http.MethodGet, requireAuth: true, stream: s.handleEvents},
+	}
+	return s
+}
+
+// ListenAndServe - Serves requests over HTTPS on the configured Port until ShutdownServer is requested or Shutdown
+// is called, using the self-signed certificate alongside server.yaml, which is generated if needed
+func (s *WalletServer) ListenAndServe() error {
+	certFile, keyFile, err := EnsureServerCertificate(".")
+	if err != nil {
+		return err
+	}
+	return s.ListenAndServeTLS(certFile, keyFile)
+}
+
+// ListenAndServeTLS - As ListenAndServe, but with the certificate and key files given
+func (s *WalletServer) ListenAndServeTLS(certFile, keyFile string) error {
+	s.mu.Lock()
+	s.srv = &http.Server{
+		Addr:              ":" + s.conf.Port,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	// Shutdown waits for every request to finish, and an event stream only finishes when its client goes away
+	done := make(chan struct{})
+	var once sync.Once
+	s.srv.RegisterOnShutdown(func() { once.Do(func() { close(done) }) })
+	s.streamsDone = done
+	srv := s.srv
+	s.mu.Unlock()
+
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown - Gracefully stops the server started by ListenAndServe
+func (s *WalletServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// shuttingDown - Returns a channel that's closed once the server starts shutting down, or nil if it isn't listening
+func (s *WalletServer) shuttingDown() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streamsDone
+}
+
+func (s *WalletServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	route, ok := s.routes[r.URL.Path]
+	if !ok {
+		writeServerResponse(w, request, nil, &serverError{UnknownRequest, errors.New("unknown request")})
+		return
+	}
+	if r.Method != route.method {
+		writeServerResponse(w, request, nil, &serverError{MalformedRequest, errors.New("request must be a " + route.method)})
+		return
+	}
+	if route.requireAuth && !s.authorised(r) {
+		writeServerResponse(w, request, nil, &serverError{Unauthorised, errors.New("missing or invalid token")})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cServerMaxBodyBytes)
+	if route.stream != nil {
+		route.stream(w, r)
+		return
+	}
+	data, err := route.handler(r)
+	writeServerResponse(w, request, data, err)
+}
+
+// StartPairing - Returns a pairing code for the server to display, which a new client exchanges for a token
+func (s *WalletServer) StartPairing() (string, time.Time, error) {
+	return s.tokens.StartPairing()
+}
+
+func (s *WalletServer) authorised(r *http.Request) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	_, ok := s.tokens.Authenticate(auth[len(prefix):])
+	return ok
+}
+
+// handleGenerateToken - Exchanges the pairing code displayed by the server for a token
+func (s *WalletServer) handleGenerateToken(r *http.Request) (interface{}, error) {
+	var req GenerateTokenReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+	if req.ClientName == "" {
+		return nil, &serverError{MalformedRequest, errors.New("a ClientName is required")}
+	}
+
+	token, tc, err := s.tokens.Pair(req.PairingCode, req.ClientName)
+	if err == ErrPairingCodeInvalid {
+		return nil, &serverError{Unauthorised, err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GenerateTokenRespStruct{Token: token, ClientID: tc.ID}, nil
+}
+
+func (s *WalletServer) handleListClients(r *http.Request) (interface{}, error) {
+	var resp ListClientsRespStruct
+	for _, c := range s.tokens.Clients() {
+		resp.Clients = append(resp.Clients, ClientInfoStruct{
+			ID:       c.ID,
+			Name:     c.Name,
+			Created:  c.Created,
+			LastSeen: c.LastSeen,
+		})
+	}
+	return resp, nil
+}
+
+func (s *WalletServer) handleRevokeClient(r *http.Request) (interface{}, error) {
+	var req RevokeClientReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+	if err := s.tokens.Revoke(req.ClientID); err == ErrTokenClientNotFound {
+		return nil, &serverError{MalformedRequest, err}
+	} else if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (s *WalletServer) handleShutdownServer(r *http.Request) (interface{}, error) {
+	// Shut down once the response has been written, otherwise the client would never get it
+	go s.Shutdown(context.Background())
+	return nil, nil
+}
+
+func (s *WalletServer) handleGetWalletStatus(r *http.Request) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	ws, err := s.rpc.GetWalletSecurityStatus(ctx)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return WalletStatusRespStruct{WalletStatus: ws}, nil
+}
+
+func (s *WalletServer) handleGetPrivateKey(r *http.Request) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	pk, err := s.rpc.GetRecoveryPhrase(ctx)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return PrivateKeyRespStruct{PrivateKey: pk}, nil
+}
+
+func (s *WalletServer) handleGetMasternodes(r *http.Request) (interface{}, error) {
+	if s.MasternodeConfFile == "" {
+		return nil, &serverError{UnknownRequest, errMasternodesNotEnabled}
+	}
+	entries, err := ReadMasternodeConf(s.MasternodeConfFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	statuses, err := s.rpc.GetMasternodeStatuses(ctx, entries)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return MasternodesRespStruct{Masternodes: statuses}, nil
+}
+
+func (s *WalletServer) handleStartMasternode(r *http.Request) (interface{}, error) {
+	if s.MasternodeConfFile == "" {
+		return nil, &serverError{UnknownRequest, errMasternodesNotEnabled}
+	}
+	var req StartMasternodeReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	if err := s.rpc.StartMasternode(ctx, req.Alias); err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return nil, nil
+}
+
+func (s *WalletServer) handleGetNewAddress(r *http.Request) (interface{}, error) {
+	var req NewAddressReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	address, err := s.rpc.GetNewAddress(ctx, req.Label)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return NewAddressRespStruct{Address: address}, nil
+}
+
+func (s *WalletServer) handleGetReceiveAddresses(r *http.Request) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	addresses, err := s.rpc.ListReceiveAddresses(ctx, 0, true)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return ReceiveAddressesRespStruct{Addresses: addresses}, nil
+}
+
+func (s *WalletServer) handleSend(r *http.Request) (interface{}, error) {
+	var req SendReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	res, err := s.rpc.Send(ctx, req.SendRequestStruct, req.Passphrase)
+	switch {
+	case err == ErrInvalidAddress || err == ErrWalletPassphraseRequired:
+		return nil, &serverError{MalformedRequest, err}
+	case errors.Is(err, ErrWalletRelockFailed):
+		// The coins have gone, so the client needs the txid, with RelockError saying the wallet is still unlocked
+		return res, nil
+	case err != nil:
+		return nil, walletServerError(ctx, err)
+	}
+	return res, nil
+}
+
+func (s *WalletServer) handleGetStakingStatus(r *http.Request) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	ss, err := s.rpc.GetStakingStatus(ctx)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return ss, nil
+}
+
+// handleGetStakingRewards - The range, period and time zone are passed in the query, see rewardsQuery
+func (s *WalletServer) handleGetStakingRewards(r *http.Request) (interface{}, error) {
+	from, to, period, loc, err := parseRewardsQuery(r.URL.Query())
+	if err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	rewards, err := s.rpc.GetStakingRewards(ctx, from, to, period, loc)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return rewards, nil
+}
+
+// handleGetTransactions - The filter and page are passed in the query, see TxFilter.txQuery
+func (s *WalletServer) handleGetTransactions(r *http.Request) (interface{}, error) {
+	filter, offset, limit, err := parseTxQuery(r.URL.Query())
+	if err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cServerWalletTimeout)
+	defer cancel()
+
+	page, err := s.rpc.GetTransactions(ctx, filter, offset, limit)
+	if err != nil {
+		return nil, walletServerError(ctx, err)
+	}
+	return page, nil
+}
+
+func (s *WalletServer) handleSetPrivSeedStored(r *http.Request) (interface{}, error) {
+	var req SetPrivSeedStoredReqStruct
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &serverError{MalformedRequest, err}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conf := s.conf
+	conf.UserConfirmedSeedRecovery = req.Stored
+	if err := s.SaveConf(conf); err != nil {
+		return nil, err
+	}
+	s.conf = conf
+	return nil, nil
+}
+
+// walletServerError - Works out whether the wallet timed out or returned an error
+func walletServerError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return &serverError{WalletDidNotRespondInTime, err}
+	}
+	return &serverError{WalletError, err}
+}
+
+func writeServerResponse(w http.ResponseWriter, request string, data interface{}, err error) {
+	sr := ServerResponseStruct{Request: request, Response: NoServerError}
+	status := http.StatusOK
+
+	if err != nil {
+		sr.Response = InternalError
+		var serr *serverError
+		if errors.As(err, &serr) {
+			sr.Response = serr.resp
+		}
+		sr.ResponseDesc = err.Error()
+		status = serverResponseHTTPStatus(sr.Response)
+	} else if data != nil {
+		b, merr := json.Marshal(data)
+		if merr != nil {
+			sr.Response = InternalError
+			sr.ResponseDesc = merr.Error()
+			status = http.StatusInternalServerError
+		} else {
+			sr.Data = b
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sr)
+}
+
+func serverResponseHTTPStatus(sr ServerResponse) int {
+	switch sr {
+	case MalformedRequest:
+		return http.StatusBadRequest
+	case Unauthorised:
+		return http.StatusUnauthorized
+	case UnknownRequest:
+		return http.StatusNotFound
+	case WalletDidNotRespondInTime:
+		return http.StatusGatewayTimeout
+	case WalletError:
+		return http.StatusBadGateway
+	case InternalError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusOK
+	}
+}
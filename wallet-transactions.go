@@ -0,0 +1,430 @@
+package gwcommon
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cTxPageSizeDefault int    = 50
+	cTxPageSizeMax     int    = 500
+	cTxFetchBatch      int    = 500
+	cTxCacheTTL               = time.Minute
+	cDefaultCurrency   string = "USD"
+	cTaxDateFormat     string = "2006-01-02 15:04:05 UTC"
+)
+
+// TxCategory - The kind of a WalletTransaction, normalised across the coins
+type TxCategory string
+
+const (
+	TxCategorySend             TxCategory = "send"
+	TxCategoryReceive          TxCategory = "receive"
+	TxCategoryStake            TxCategory = "stake"
+	TxCategoryMasternodeReward TxCategory = "masternode"
+	TxCategoryOther            TxCategory = "other"
+)
+
+// WalletTransaction - One entry of the wallet's transaction history. A transaction paying several of the wallet's
+// addresses has one entry per output
+type WalletTransaction struct {
+	TxID          string
+	Vout          int
+	Address       string
+	Category      TxCategory
+	RawCategory   string // The category as reported by the daemon e.g. stake_reward
+	Amount        Amount // Negative for sends
+	Fee           Amount // Negative, only reported for sends
+	Confirmations int64
+	BlockHash     string
+	Time          time.Time
+}
+
+// TxFilter - Restricts the transactions returned by GetTransactions
+type TxFilter struct {
+	Categories []TxCategory // All categories if empty
+	From       time.Time    // Inclusive, unbounded if zero
+	To         time.Time    // Exclusive, unbounded if zero
+}
+
+// TxPage - A page of transactions, newest first
+type TxPage struct {
+	Transactions []WalletTransaction
+	Offset       int
+	Limit        int
+	Total        int // The number of transactions matching the filter
+}
+
+// txListCache - The wallet's transactions fetched so far, newest first, kept so that paging through them doesn't
+// fetch them all again for every page. It's only used while key matches the wallet
+type txListCache struct {
+	key      txCacheKey
+	fetched  time.Time
+	txs      []WalletTransaction
+	complete bool // All of them have been fetched
+}
+
+// txCacheKey - A new transaction changes the newest entry, and a new block the height and so the confirmations
+type txCacheKey struct {
+	height        int64
+	txid          string
+	vout          int
+	category      string
+	confirmations int64
+}
+
+// FiatRateSource - Returns the value of one coin in the fiat currency e.g. GBP at the time given
+type FiatRateSource interface {
+	FiatRate(ctx context.Context, pt ProjectType, currency string, at time.Time) (float64, error)
+}
+
+// rpcTransaction - An entry from listtransactions, or the details of gettransaction
+type rpcTransaction struct {
+	TxID          string `json:"txid"`
+	Vout          int    `json:"vout"`
+	Address       string `json:"address"`
+	Category      string `json:"category"`
+	Amount        Amount `json:"amount"`
+	Fee           Amount `json:"fee"`
+	Confirmations int64  `json:"confirmations"`
+	Generated     bool   `json:"generated"`
+	BlockHash     string `json:"blockhash"`
+	BlockTime     int64  `json:"blocktime"`
+	Time          int64  `json:"time"`
+}
+
+// Matches - Returns true if the transaction passes the filter
+func (f TxFilter) Matches(tx WalletTransaction) bool {
+	if !f.From.IsZero() && tx.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !tx.Time.Before(f.To) {
+		return false
+	}
+	if len(f.Categories) == 0 {
+		return true
+	}
+	for _, c := range f.Categories {
+		if c == tx.Category {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTransactions - Returns a page of the wallet's transactions matching the filter, newest first. A limit of 0
+// uses cTxPageSizeDefault
+func (c *CoinRPCClient) GetTransactions(ctx context.Context, filter TxFilter, offset, limit int) (TxPage, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = cTxPageSizeDefault
+	}
+
+	matched, err := c.listTransactions(ctx, filter)
+	if err != nil {
+		return TxPage{}, err
+	}
+
+	page := TxPage{Offset: offset, Limit: limit, Total: len(matched)}
+	if offset < len(matched) {
+		end := offset + limit
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Transactions = matched[offset:end]
+	}
+	return page, nil
+}
+
+// listTransactions - Returns all of the wallet's transactions matching the filter, newest first. They're fetched in
+// batches as needed and cached, so the following pages are served without fetching the history again
+func (c *CoinRPCClient) listTransactions(ctx context.Context, filter TxFilter) ([]WalletTransaction, error) {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	if err := c.checkTxCache(ctx); err != nil {
+		return nil, err
+	}
+	tc := c.txCache
+
+	// The daemon can only page newest first without filtering, so everything in range has to be looked at
+	var matched []WalletTransaction
+	for start := 0; ; start += cTxFetchBatch {
+		if len(tc.txs) < start+cTxFetchBatch && !tc.complete {
+			if err := c.fetchTxBatch(ctx, tc); err != nil {
+				return nil, err
+			}
+		}
+		end := start + cTxFetchBatch
+		if end > len(tc.txs) {
+			end = len(tc.txs)
+		}
+
+		reachedFrom := true
+		for _, tx := range tc.txs[start:end] {
+			if filter.From.IsZero() || !tx.Time.Before(filter.From) {
+				reachedFrom = false
+			}
+			if filter.Matches(tx) {
+				matched = append(matched, tx)
+			}
+		}
+
+		if (end == len(tc.txs) && tc.complete) || (!filter.From.IsZero() && reachedFrom) {
+			return matched, nil
+		}
+	}
+}
+
+// checkTxCache - Starts a new cache if the wallet has changed since c.txCache was fetched, or it's too old.
+// Must be called with c.txMu held
+func (c *CoinRPCClient) checkTxCache(ctx context.Context) error {
+	var key txCacheKey
+	if err := c.Call(ctx, "getblockcount", nil, &key.height); err != nil {
+		return err
+	}
+	var newest []rpcTransaction
+	if err := c.Call(ctx, "listtransactions", []interface{}{"*", 1, 0}, &newest); err != nil {
+		return err
+	}
+	if len(newest) > 0 {
+		n := newest[0]
+		key.txid, key.vout, key.category, key.confirmations = n.TxID, n.Vout, n.Category, n.Confirmations
+	}
+
+	if c.txCache == nil || c.txCache.key != key || time.Since(c.txCache.fetched) > cTxCacheTTL {
+		c.txCache = &txListCache{key: key, fetched: time.Now()}
+	}
+	return nil
+}
+
+// fetchTxBatch - Adds the next cTxFetchBatch transactions to the cache. Must be called with c.txMu held
+func (c *CoinRPCClient) fetchTxBatch(ctx context.Context, tc *txListCache) error {
+	var batch []rpcTransaction
+	if err := c.Call(ctx, "listtransactions", []interface{}{"*", cTxFetchBatch, len(tc.txs)}, &batch); err != nil {
+		return err
+	}
+	// Each batch is listed oldest first
+	for i := len(batch) - 1; i >= 0; i-- {
+		tc.txs = append(tc.txs, batch[i].walletTransaction())
+	}
+	tc.complete = len(batch) < cTxFetchBatch
+	return nil
+}
+
+// GetTransaction - Returns the wallet's entries for the transaction with the txid
+func (c *CoinRPCClient) GetTransaction(ctx context.Context, txid string) ([]WalletTransaction, error) {
+	var gt struct {
+		rpcTransaction
+		Details []rpcTransaction `json:"details"`
+	}
+	if err := c.Call(ctx, "gettransaction", []interface{}{txid}, &gt); err != nil {
+		return nil, err
+	}
+
+	var txs []WalletTransaction
+	for _, d := range gt.Details {
+		// The details only carry the per output fields
+		d.TxID = gt.TxID
+		d.Confirmations = gt.Confirmations
+		d.Generated = d.Generated || gt.Generated
+		d.BlockHash = gt.BlockHash
+		d.BlockTime = gt.BlockTime
+		d.Time = gt.Time
+		txs = append(txs, d.walletTransaction())
+	}
+	return txs, nil
+}
+
+func (rt rpcTransaction) walletTransaction() WalletTransaction {
+	t := rt.BlockTime
+	if t == 0 {
+		t = rt.Time
+	}
+	return WalletTransaction{
+		TxID:          rt.TxID,
+		Vout:          rt.Vout,
+		Address:       rt.Address,
+		Category:      normaliseTxCategory(rt.Category, rt.Generated),
+		RawCategory:   rt.Category,
+		Amount:        rt.Amount,
+		Fee:           rt.Fee,
+		Confirmations: rt.Confirmations,
+		BlockHash:     rt.BlockHash,
+		Time:          time.Unix(t, 0).UTC(),
+	}
+}
+
+// normaliseTxCategory - Each coin names its reward categories differently. PIVX and Phore list masternode rewards as
+// generated receives, while their stakes are listed as generate or stake
+func normaliseTxCategory(category string, generated bool) TxCategory {
+	switch category {
+	case "send":
+		return TxCategorySend
+	case "receive":
+		if generated {
+			return TxCategoryMasternodeReward
+		}
+		return TxCategoryReceive
+	case "stake", "stake_reward", "generate", "immature":
+		return TxCategoryStake
+	case "mn_reward", "masternode", "masternode reward":
+		return TxCategoryMasternodeReward
+	default:
+		return TxCategoryOther
+	}
+}
+
+// ExportTransactionsCSV - Writes the transactions as CSV, with amounts in coins
+func ExportTransactionsCSV(w io.Writer, txs []WalletTransaction) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Date", "TxID", "Vout", "Category", "Address", "Amount", "Fee", "Confirmations"}); err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err := cw.Write([]string{
+			tx.Time.UTC().Format(time.RFC3339),
+			tx.TxID,
+			strconv.Itoa(tx.Vout),
+			string(tx.Category),
+			tx.Address,
+			tx.Amount.String(),
+			tx.Fee.String(),
+			strconv.FormatInt(tx.Confirmations, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportTransactionsTaxCSV - Writes the transactions in the universal CSV layout accepted by most crypto tax tools
+// e.g. Koinly, with the value of each in the CLI config Currency at the time of the transaction. rates may be nil,
+// in which case the values are left blank
+func ExportTransactionsTaxCSV(ctx context.Context, w io.Writer, cs CLIConfStruct, rates FiatRateSource, txs []WalletTransaction) error {
+	ticker, err := GetCoinTicker(cs.ProjectType)
+	if err != nil {
+		return err
+	}
+	currency := strings.ToUpper(cs.Currency)
+	if currency == "" {
+		currency = cDefaultCurrency
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+		"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"}); err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		row := make([]string, 12)
+		row[0] = tx.Time.UTC().Format(cTaxDateFormat)
+
+		abs, err := tx.Amount.Abs()
+		if err != nil {
+			return err
+		}
+		if tx.Amount < 0 {
+			row[1], row[2] = abs.String(), ticker
+		} else {
+			row[3], row[4] = abs.String(), ticker
+		}
+		if tx.Fee != 0 {
+			fee, err := tx.Fee.Abs()
+			if err != nil {
+				return err
+			}
+			row[5], row[6] = fee.String(), ticker
+		}
+
+		if rates != nil {
+			rate, err := rates.FiatRate(ctx, cs.ProjectType, currency, tx.Time)
+			if err != nil {
+				return fmt.Errorf("unable to get the %v rate for %v: %v", currency, tx.Time.Format(cTaxDateFormat), err)
+			}
+			row[7] = abs.FormatFiat(rate, 2)
+			row[8] = currency
+		}
+
+		switch tx.Category {
+		case TxCategoryStake:
+			row[9] = "staking"
+		case TxCategoryMasternodeReward:
+			row[9] = "reward"
+		}
+		row[10] = tx.Address
+		row[11] = tx.TxID
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// txQuery - Encodes the filter and page as the query of a CWalletRequestGetTransactions request
+func (f TxFilter) txQuery(offset, limit int) url.Values {
+	q := url.Values{}
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("limit", strconv.Itoa(limit))
+	if len(f.Categories) > 0 {
+		cats := make([]string, len(f.Categories))
+		for i, c := range f.Categories {
+			cats[i] = string(c)
+		}
+		q.Set("category", strings.Join(cats, ","))
+	}
+	if !f.From.IsZero() {
+		q.Set("from", f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		q.Set("to", f.To.UTC().Format(time.RFC3339))
+	}
+	return q
+}
+
+// parseTxQuery - Decodes the query of a CWalletRequestGetTransactions request
+func parseTxQuery(q url.Values) (f TxFilter, offset, limit int, err error) {
+	if s := q.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return TxFilter{}, 0, 0, errors.New("invalid offset: " + s)
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 || limit > cTxPageSizeMax {
+			return TxFilter{}, 0, 0, fmt.Errorf("limit must be between 0 and %d", cTxPageSizeMax)
+		}
+	}
+	if s := q.Get("category"); s != "" {
+		for _, c := range strings.Split(s, ",") {
+			switch tc := TxCategory(c); tc {
+			case TxCategorySend, TxCategoryReceive, TxCategoryStake, TxCategoryMasternodeReward, TxCategoryOther:
+				f.Categories = append(f.Categories, tc)
+			default:
+				return TxFilter{}, 0, 0, errors.New("unknown category: " + c)
+			}
+		}
+	}
+	if s := q.Get("from"); s != "" {
+		if f.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return TxFilter{}, 0, 0, errors.New("invalid from date: " + s)
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if f.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return TxFilter{}, 0, 0, errors.New("invalid to date: " + s)
+		}
+	}
+	return f, offset, limit, nil
+}
@@ -0,0 +1,156 @@
+package gwcommon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTxTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// txWallet - The history of the stand-in wallet for the transaction tests, oldest first as the daemon keeps it
+type txWallet struct {
+	mu      sync.Mutex
+	height  int64
+	txs     []map[string]interface{}
+	batches int // listtransactions calls fetching a batch, rather than the newest entry
+}
+
+func (w *txWallet) addTxs(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := 0; i < n; i++ {
+		k := len(w.txs)
+		w.txs = append(w.txs, map[string]interface{}{
+			"txid":          fmt.Sprintf("tx%d", k),
+			"category":      "receive",
+			"amount":        1,
+			"confirmations": 10,
+			"time":          testTxTime.Add(time.Duration(k) * time.Minute).Unix(),
+		})
+	}
+}
+
+func (w *txWallet) fetches() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.batches
+}
+
+func newTxStub(t *testing.T, w *txWallet) *rpcStub {
+	return newRPCStub(t, map[string]func([]interface{}) (interface{}, *RPCError){
+		"getblockcount": func([]interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return w.height, nil
+		},
+		"listtransactions": func(p []interface{}) (interface{}, *RPCError) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			count, skip := int(p[1].(float64)), int(p[2].(float64))
+			if count > 1 {
+				w.batches++
+			}
+			end := len(w.txs) - skip
+			if end < 0 {
+				end = 0
+			}
+			start := end - count
+			if start < 0 {
+				start = 0
+			}
+			return w.txs[start:end], nil
+		},
+	})
+}
+
+func TestGetTransactionsPages(t *testing.T) {
+	w := &txWallet{height: 100}
+	w.addTxs(2*cTxFetchBatch + 200)
+	rpc := newTxStub(t, w).client()
+	ctx := context.Background()
+
+	page, err := rpc.GetTransactions(ctx, TxFilter{}, 0, 50)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if page.Total != 1200 || len(page.Transactions) != 50 || page.Transactions[0].TxID != "tx1199" || page.Transactions[49].TxID != "tx1150" {
+		t.Fatalf("GetTransactions() = Total %d, %d transactions", page.Total, len(page.Transactions))
+	}
+	if n := w.fetches(); n != 3 {
+		t.Errorf("fetched %d batches, want 3", n)
+	}
+
+	// The next pages come from the cache
+	for _, offset := range []int{50, 1150, 1200} {
+		page, err = rpc.GetTransactions(ctx, TxFilter{}, offset, 50)
+		if err != nil {
+			t.Fatalf("GetTransactions() error = %v", err)
+		}
+		if page.Total != 1200 || (offset < 1200 && page.Transactions[0].TxID != fmt.Sprintf("tx%d", 1199-offset)) {
+			t.Errorf("GetTransactions(offset %d) = Total %d, %d transactions", offset, page.Total, len(page.Transactions))
+		}
+	}
+	if n := w.fetches(); n != 3 {
+		t.Errorf("fetched %d batches, want the later pages from the cache", n)
+	}
+
+	// A filter over the cached history doesn't fetch it again either
+	page, err = rpc.GetTransactions(ctx, TxFilter{Categories: []TxCategory{TxCategorySend}}, 0, 50)
+	if err != nil || page.Total != 0 || w.fetches() != 3 {
+		t.Errorf("GetTransactions() sends = Total %d, %v, fetched %d batches", page.Total, err, w.fetches())
+	}
+}
+
+func TestGetTransactionsCacheRefreshed(t *testing.T) {
+	w := &txWallet{height: 100}
+	w.addTxs(10)
+	rpc := newTxStub(t, w).client()
+	ctx := context.Background()
+
+	if _, err := rpc.GetTransactions(ctx, TxFilter{}, 0, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new transaction
+	w.addTxs(1)
+	page, err := rpc.GetTransactions(ctx, TxFilter{}, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 11 || page.Transactions[0].TxID != "tx10" || w.fetches() != 2 {
+		t.Errorf("after a new transaction, Total = %d, newest %v, fetched %d batches", page.Total, page.Transactions[0].TxID, w.fetches())
+	}
+
+	// A new block, so the confirmations have changed
+	w.mu.Lock()
+	w.height++
+	w.mu.Unlock()
+	if _, err := rpc.GetTransactions(ctx, TxFilter{}, 5, 5); err != nil {
+		t.Fatal(err)
+	}
+	if n := w.fetches(); n != 3 {
+		t.Errorf("fetched %d batches, want the history fetched again after a new block", n)
+	}
+}
+
+func TestGetTransactionsFrom(t *testing.T) {
+	w := &txWallet{height: 100}
+	w.addTxs(2*cTxFetchBatch + 200)
+	rpc := newTxStub(t, w).client()
+
+	from := testTxTime.Add(1000 * time.Minute)
+	page, err := rpc.GetTransactions(context.Background(), TxFilter{From: from}, 0, 500)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if page.Total != 200 || page.Transactions[199].TxID != "tx1000" {
+		t.Errorf("GetTransactions() = Total %d", page.Total)
+	}
+	// The second batch is all before From, so the oldest isn't fetched
+	if n := w.fetches(); n != 2 {
+		t.Errorf("fetched %d batches, want 2", n)
+	}
+}